@@ -0,0 +1,56 @@
+package bgcodego
+
+import (
+	"slices"
+	"sync"
+)
+
+var (
+	keyAliasesMu sync.RWMutex
+
+	// keyAliases maps canonical metadata keys, as written by current
+	// PrusaSlicer releases, to the names other slicers and older releases
+	// use for the same value.
+	keyAliases = map[string][]string{
+		"estimated printing time (normal mode)": {"estimated printing time"},
+		"total filament used [g]":               {"total filament weight [g]"},
+	}
+)
+
+// RegisterKeyAlias makes metadata lookups by the canonical key, such as
+// Metadata.Lookup and Metadata.EstimatedTime, fall back to alias, for
+// slicers that name the value differently. Aliases are tried in the order
+// they are registered.
+func RegisterKeyAlias(key, alias string) {
+	keyAliasesMu.Lock()
+	defer keyAliasesMu.Unlock()
+	if key == alias || slices.Contains(keyAliases[key], alias) {
+		return
+	}
+	keyAliases[key] = append(slices.Clip(keyAliases[key]), alias)
+}
+
+// KeyAliases returns the aliases of a canonical metadata key.
+func KeyAliases(key string) []string {
+	keyAliasesMu.RLock()
+	defer keyAliasesMu.RUnlock()
+	return slices.Clone(keyAliases[key])
+}
+
+// keyNames returns a canonical key followed by its aliases.
+func keyNames(key string) []string {
+	keyAliasesMu.RLock()
+	defer keyAliasesMu.RUnlock()
+	return append([]string{key}, keyAliases[key]...)
+}
+
+// Lookup returns the value of a canonical key, or of its first alias found,
+// looking in the print, printer, file and slicer metadata in turn.
+func (m *Metadata) Lookup(key string) (string, bool) {
+	tv := &typedValues{tables: []KeyValues{m.Print, m.Printer, m.File, m.Slicer}}
+	kv, name, ok := tv.lookup(key)
+	if !ok {
+		return "", false
+	}
+	return kv.First(name), true
+}
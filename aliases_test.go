@@ -0,0 +1,66 @@
+package bgcodego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetadata_Lookup(t *testing.T) {
+	m := decodeFixture(t).Metadata()
+	if v, ok := m.Lookup("printer_model"); !ok || v != "MINI" {
+		t.Errorf("Lookup(printer_model) = %q, %v", v, ok)
+	}
+	if v, ok := m.Lookup("Producer"); !ok || v == "" {
+		t.Errorf("Lookup(Producer) = %q, %v", v, ok)
+	}
+	if _, ok := m.Lookup("missing"); ok {
+		t.Error("found missing key")
+	}
+
+	older := &Metadata{Printer: KeyValues{{Key: "estimated printing time", Value: "1h 2m 3s"}, {Key: "filament_colour", Value: "#FF8000"}}}
+	if v, ok := older.Lookup("estimated printing time (normal mode)"); !ok || v != "1h 2m 3s" {
+		t.Errorf("Lookup by alias = %q, %v", v, ok)
+	}
+	d, err := older.EstimatedTime()
+	checkErr(t, err)
+	if want := time.Hour + 2*time.Minute + 3*time.Second; d != want {
+		t.Errorf("EstimatedTime() = %v, want %v", d, want)
+	}
+	pm, err := older.PrinterMetadata()
+	checkErr(t, err)
+	if diff := cmp.Diff([]string{"#FF8000"}, pm.ExtruderColour); diff != "" {
+		t.Errorf("ExtruderColour mismatch (-want +got):\n%s", diff)
+	}
+	if v, ok := older.Lookup("extruder_colour"); ok {
+		t.Errorf("Lookup(extruder_colour) = %q, want no match for filament_colour", v)
+	}
+	if _, err := (&Metadata{}).EstimatedTime(); err == nil {
+		t.Error("expected error on missing estimated time")
+	}
+}
+
+func TestRegisterKeyAlias(t *testing.T) {
+	const key, alias = "test canonical key", "test alias"
+	t.Cleanup(func() {
+		keyAliasesMu.Lock()
+		delete(keyAliases, key)
+		keyAliasesMu.Unlock()
+	})
+	RegisterKeyAlias(key, alias)
+	RegisterKeyAlias(key, alias)
+	RegisterKeyAlias(key, key)
+	aliases := KeyAliases(key)
+	if diff := cmp.Diff([]string{alias}, aliases); diff != "" {
+		t.Errorf("KeyAliases() mismatch (-want +got):\n%s", diff)
+	}
+	aliases[0] = "modified"
+	if KeyAliases(key)[0] != alias {
+		t.Error("KeyAliases() returned the table itself")
+	}
+	m := &Metadata{Slicer: KeyValues{{Key: alias, Value: "42"}}}
+	if v, ok := m.Lookup(key); !ok || v != "42" {
+		t.Errorf("Lookup() = %q, %v", v, ok)
+	}
+}
@@ -0,0 +1,352 @@
+// Package analysis computes print statistics from G-code, such as the
+// estimated print time and the filament used by each tool.
+//
+//	stats, err := analysis.Analyze(fd)
+//	fmt.Println(stats.PrintTime, stats.Layers, stats.FilamentLength(), "mm")
+//
+// Analyzer is an io.Writer, so that statistics can be collected while a
+// BGCode file is converted:
+//
+//	a := analysis.New()
+//	err := bgcodego.ParseTo(io.MultiWriter(out, a), fd)
+package analysis
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"cirello.io/bgcodego"
+)
+
+// DefaultFilamentDiameter is the diameter, in millimeters, assumed for tools
+// whose filament diameter is not declared by the slicer configuration.
+const DefaultFilamentDiameter = 1.75
+
+// Stats reports the statistics of G-code.
+type Stats struct {
+	// PrintTime is estimated from the length and feed rate of moves, plus
+	// dwells. Acceleration is not taken into account, and neither is the
+	// time spent heating or homing.
+	PrintTime time.Duration
+
+	// Layers counts ;LAYER_CHANGE markers or, when there are none, the
+	// distinct heights at which filament was extruded.
+	Layers int
+
+	// Filament reports the filament used by each tool, indexed by tool
+	// number.
+	Filament []Filament
+}
+
+// Filament reports the filament used by a tool.
+type Filament struct {
+	Length   float64 // Length in millimeters, net of retractions
+	Volume   float64 // Volume in cubic millimeters
+	Diameter float64 // Diameter in millimeters
+}
+
+// FilamentLength is the length of filament used by all tools, in
+// millimeters.
+func (s *Stats) FilamentLength() float64 {
+	var total float64
+	for _, f := range s.Filament {
+		total += f.Length
+	}
+	return total
+}
+
+// FilamentVolume is the volume of filament used by all tools, in cubic
+// millimeters.
+func (s *Stats) FilamentVolume() float64 {
+	var total float64
+	for _, f := range s.Filament {
+		total += f.Volume
+	}
+	return total
+}
+
+// Analyze computes the statistics of the BGCode input r, streaming its
+// G-code through an Analyzer.
+func Analyze(r io.Reader, opts ...bgcodego.DecodeOption) (*Stats, error) {
+	a := New()
+	if err := bgcodego.ParseTo(a, r, opts...); err != nil {
+		return nil, err
+	}
+	return a.Stats(), nil
+}
+
+// AnalyzeFile computes the statistics of the G-code of a decoded file,
+// taking filament diameters from its slicer metadata.
+func AnalyzeFile(f *bgcodego.File) *Stats {
+	a := New()
+	if f.SlicerMetadata != nil {
+		a.setDiameters(f.SlicerMetadata.Values.First("filament_diameter"))
+	}
+	for _, bg := range f.GCode {
+		io.WriteString(a, bg.Body)
+	}
+	return a.Stats()
+}
+
+// Analyzer collects the statistics of the G-code written to it. Filament
+// diameters are taken from "; filament_diameter = ..." comments, as written
+// by PrusaSlicer along with its configuration, wherever they appear.
+type Analyzer struct {
+	partial []byte
+
+	pos          [4]float64 // X, Y, Z and E
+	relative     bool       // G91
+	relativeE    bool       // M83
+	feedRate     float64    // mm/min
+	tool         int
+	seconds      float64
+	lengths      []float64
+	diameters    []float64
+	layerMarkers int
+	extrudedZ    map[float64]struct{}
+}
+
+// New returns an Analyzer of G-code that starts with absolute positioning
+// and tool 0 selected.
+func New() *Analyzer {
+	return &Analyzer{extrudedZ: make(map[float64]struct{})}
+}
+
+// Write analyzes the complete lines of p, and buffers any trailing partial
+// line until the next write.
+func (a *Analyzer) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			a.partial = append(a.partial, p...)
+			break
+		}
+		if len(a.partial) > 0 {
+			a.partial = append(a.partial, p[:i]...)
+			a.line(string(a.partial))
+			a.partial = a.partial[:0]
+		} else {
+			a.line(string(p[:i]))
+		}
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Stats reports the statistics of the G-code written so far. A trailing
+// line without a line ending is taken as complete.
+func (a *Analyzer) Stats() *Stats {
+	if len(a.partial) > 0 {
+		a.line(string(a.partial))
+		a.partial = a.partial[:0]
+	}
+	s := &Stats{
+		PrintTime: time.Duration(a.seconds * float64(time.Second)),
+		Layers:    a.layerMarkers,
+		Filament:  make([]Filament, len(a.lengths)),
+	}
+	if s.Layers == 0 {
+		s.Layers = len(a.extrudedZ)
+	}
+	for tool, length := range a.lengths {
+		d := DefaultFilamentDiameter
+		if tool < len(a.diameters) && a.diameters[tool] > 0 {
+			d = a.diameters[tool]
+		}
+		s.Filament[tool] = Filament{
+			Length:   length,
+			Volume:   length * math.Pi * d * d / 4,
+			Diameter: d,
+		}
+	}
+	return s
+}
+
+func (a *Analyzer) line(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	code, comment, _ := strings.Cut(line, ";")
+	if comment != "" {
+		a.comment(comment)
+	}
+	words := parseWords(code)
+	if len(words) == 0 {
+		return
+	}
+	cmd := words[0]
+	switch {
+	case cmd.letter == 'T' && cmd.value >= 0:
+		a.tool = int(cmd.value)
+		return
+	case cmd.letter != 'G' && cmd.letter != 'M':
+		return
+	}
+	switch code := strconv.FormatFloat(cmd.value, 'f', -1, 64); string(cmd.letter) + code {
+	case "G0", "G1":
+		a.move(words[1:], 0)
+	case "G2":
+		a.move(words[1:], -1)
+	case "G3":
+		a.move(words[1:], 1)
+	case "G4":
+		for _, w := range words[1:] {
+			if math.IsNaN(w.value) {
+				continue
+			}
+			switch w.letter {
+			case 'P':
+				a.seconds += w.value / 1000
+			case 'S':
+				a.seconds += w.value
+			}
+		}
+	case "G28":
+		all := len(words) == 1
+		for i, axis := range "XYZ" {
+			if all || hasWord(words[1:], byte(axis)) {
+				a.pos[i] = 0
+			}
+		}
+	case "G90":
+		a.relative, a.relativeE = false, false
+	case "G91":
+		a.relative, a.relativeE = true, true
+	case "G92":
+		for _, w := range words[1:] {
+			if i := strings.IndexByte("XYZE", w.letter); i >= 0 && !math.IsNaN(w.value) {
+				a.pos[i] = w.value
+			}
+		}
+	case "M82":
+		a.relativeE = false
+	case "M83":
+		a.relativeE = true
+	}
+}
+
+func (a *Analyzer) comment(comment string) {
+	switch {
+	case strings.HasPrefix(comment, "LAYER_CHANGE"):
+		a.layerMarkers++
+	case strings.HasPrefix(comment, " filament_diameter ="):
+		a.setDiameters(strings.TrimPrefix(comment, " filament_diameter ="))
+	}
+}
+
+func (a *Analyzer) setDiameters(values string) {
+	a.diameters = a.diameters[:0]
+	for _, v := range strings.Split(values, ",") {
+		d, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		a.diameters = append(a.diameters, d)
+	}
+}
+
+// move accounts for a linear move, or for an arc move clockwise (dir -1) or
+// counterclockwise (dir 1) around the center given by the I and J offsets.
+func (a *Analyzer) move(words []word, dir int) {
+	target := a.pos
+	var i, j float64
+	for _, w := range words {
+		if math.IsNaN(w.value) {
+			continue
+		}
+		switch w.letter {
+		case 'X', 'Y', 'Z':
+			axis := w.letter - 'X'
+			if a.relative {
+				target[axis] += w.value
+			} else {
+				target[axis] = w.value
+			}
+		case 'E':
+			if a.relativeE {
+				target[3] += w.value
+			} else {
+				target[3] = w.value
+			}
+		case 'F':
+			a.feedRate = w.value
+		case 'I':
+			i = w.value
+		case 'J':
+			j = w.value
+		}
+	}
+	dx, dy, dz := target[0]-a.pos[0], target[1]-a.pos[1], target[2]-a.pos[2]
+	dist := math.Sqrt(dx*dx + dy*dy + dz*dz)
+	if dir != 0 {
+		cx, cy := a.pos[0]+i, a.pos[1]+j
+		start := math.Atan2(a.pos[1]-cy, a.pos[0]-cx)
+		end := math.Atan2(target[1]-cy, target[0]-cx)
+		sweep := (end - start) * float64(dir)
+		if sweep <= 0 {
+			sweep += 2 * math.Pi
+		}
+		arc := math.Hypot(i, j) * sweep
+		dist = math.Sqrt(arc*arc + dz*dz)
+	}
+	de := target[3] - a.pos[3]
+	if dist == 0 {
+		dist = math.Abs(de)
+	}
+	if a.feedRate > 0 {
+		a.seconds += dist / a.feedRate * 60
+	}
+	if de != 0 {
+		for len(a.lengths) <= a.tool {
+			a.lengths = append(a.lengths, 0)
+		}
+		a.lengths[a.tool] += de
+		if de > 0 && dist > 0 {
+			a.extrudedZ[target[2]] = struct{}{}
+		}
+	}
+	a.pos = target
+}
+
+// word is a letter and number pair of a G-code command, such as X10.5. The
+// number is NaN when missing or malformed.
+type word struct {
+	letter byte
+	value  float64
+}
+
+// parseWords splits G-code into words, whether or not they are separated by
+// spaces.
+func parseWords(code string) []word {
+	var words []word
+	for i := 0; i < len(code); {
+		c := code[i]
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if c < 'A' || c > 'Z' {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(code) && strings.IndexByte("+-.0123456789", code[j]) >= 0 {
+			j++
+		}
+		v, err := strconv.ParseFloat(code[i+1:j], 64)
+		if err != nil {
+			v = math.NaN()
+		}
+		words = append(words, word{letter: c, value: v})
+		i = j
+	}
+	return words
+}
+
+func hasWord(words []word, letter byte) bool {
+	for _, w := range words {
+		if w.letter == letter {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package analysis
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cirello.io/bgcodego"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const fixture = "../_testdata/mini_cube_b.bgcode"
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	gcode := strings.Join([]string{
+		"G90",
+		"M83",
+		"G1 Z0.2 F600",          // 0.2mm at 10mm/s
+		"G1 X30 Y40 E2 F3000",   // 50mm at 50mm/s
+		"G1 E-0.5 F1800",        // retraction, 0.5mm at 30mm/s
+		"G4 P500",               // dwell
+		"T1",                    //
+		"G92 E0",                //
+		"G1 X30 Y40 E+.5",       // unretraction, in place
+		"G3 X30 Y40 I-10 J0 E1", // full circle of radius 10
+		";LAYER_CHANGE",
+		"G91",
+		"G1 Z0.2",
+		"g1 x10e1 ; lowercase, no spaces",
+		"; filament_diameter = 1.75,2.85",
+	}, "\n")
+	a := New()
+	// Split lines across writes.
+	for _, chunk := range []string{gcode[:7], gcode[7:100], gcode[100:]} {
+		a.Write([]byte(chunk))
+	}
+	got := a.Stats()
+	seconds := 0.2/10 + 50.0/50 + 0.5/30 + 0.5 + 0.5/30 + 2*math.Pi*10/30 + 0.2/30 + 10.0/30
+	want := &Stats{
+		PrintTime: time.Duration(seconds * float64(time.Second)),
+		Layers:    1,
+		Filament: []Filament{
+			{Length: 1.5, Volume: 1.5 * math.Pi * 1.75 * 1.75 / 4, Diameter: 1.75},
+			{Length: 2.5, Volume: 2.5 * math.Pi * 2.85 * 2.85 / 4, Diameter: 2.85},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateApprox(0, 1e-9), cmpopts.EquateApproxTime(time.Millisecond)); diff != "" {
+		t.Errorf("Stats() mismatch (-want +got):\n%s", diff)
+	}
+	if total := got.FilamentLength(); math.Abs(total-4) > 1e-9 {
+		t.Errorf("unexpected total filament length: %v", total)
+	}
+}
+
+func TestAnalyzer_layersWithoutMarkers(t *testing.T) {
+	a := New()
+	a.Write([]byte("G1 Z0.2\nG1 X10 E1\nG1 Z0.4\nG1 X0\nG1 Z0.6\nG1 X10 E2\nG1 X0 E3\nG1 Z10\n"))
+	if got := a.Stats().Layers; got != 2 {
+		t.Errorf("unexpected layer count: %d", got)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	fd, err := os.Open(fixture)
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	got, err := Analyze(fd)
+	checkErr(t, err)
+	f, err := bgcodego.DecodeFile(fixture)
+	checkErr(t, err)
+	if diff := cmp.Diff(got, AnalyzeFile(f)); diff != "" {
+		t.Errorf("AnalyzeFile() mismatch (-Analyze +AnalyzeFile):\n%s", diff)
+	}
+
+	if got.Layers != len(f.Layers()) {
+		t.Errorf("unexpected layer count: %d, want %d", got.Layers, len(f.Layers()))
+	}
+	// PrusaSlicer reports 986.61mm, 2.37cm3 and 32m 6s, which includes
+	// acceleration.
+	if len(got.Filament) != 1 || math.Abs(got.Filament[0].Length-986.61) > 5 || math.Abs(got.Filament[0].Volume/1000-2.37) > 0.01 {
+		t.Errorf("unexpected filament usage: %+v", got.Filament)
+	}
+	if got.PrintTime < 15*time.Minute || got.PrintTime > 32*time.Minute {
+		t.Errorf("unexpected print time: %v", got.PrintTime)
+	}
+}
@@ -0,0 +1,94 @@
+package bgcodego
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNoBGCodeInArchive is returned when a zip-based container, such as a 3MF
+// project, holds no BGCode payload.
+var ErrNoBGCodeInArchive = errors.New("no BGCode payload in archive")
+
+// FindInArchive locates the BGCode payload of a zip-based container, such as
+// a sliced 3MF project exported by PrusaSlicer. Entries with the .bgcode
+// extension are preferred; otherwise, the first entry starting with the
+// BGCode magic number is returned, whatever its name.
+func FindInArchive(zr *zip.Reader) (*zip.File, error) {
+	for _, zf := range zr.File {
+		if !zf.FileInfo().IsDir() && strings.EqualFold(path.Ext(zf.Name), ".bgcode") {
+			return zf, nil
+		}
+	}
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		ok, err := hasMagicNumber(zf)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", zf.Name, err)
+		}
+		if ok {
+			return zf, nil
+		}
+	}
+	return nil, ErrNoBGCodeInArchive
+}
+
+func hasMagicNumber(zf *zip.File) (bool, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	var hdr [4]byte
+	if _, err := io.ReadFull(rc, hdr[:]); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return string(hdr[:]) == "GCDE", nil
+}
+
+// openArchive opens the BGCode payload of the zip-based container in r, and
+// reports its size.
+func openArchive(r io.ReaderAt, size int64) (io.ReadCloser, int64, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot open archive: %w", err)
+	}
+	zf, err := FindInArchive(zr)
+	if err != nil {
+		return nil, 0, err
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot read %s: %w", zf.Name, err)
+	}
+	return rc, int64(zf.UncompressedSize64), nil
+}
+
+// DecodeArchive decodes the BGCode payload of a zip-based container of the
+// given size, as located by FindInArchive.
+func DecodeArchive(r io.ReaderAt, size int64, opts ...DecodeOption) (*File, error) {
+	rc, _, err := openArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return Decode(rc, opts...)
+}
+
+// ParseArchive converts the BGCode payload of a zip-based container of the
+// given size into ASCII G-code, as Parse does.
+func ParseArchive(r io.ReaderAt, size int64, opts ...DecodeOption) (string, error) {
+	rc, _, err := openArchive(r, size)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return Parse(rc, opts...)
+}
@@ -0,0 +1,63 @@
+package bgcodego
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestParseArchive(t *testing.T) {
+	fixture, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	want, err := Parse(bytes.NewReader(fixture))
+	checkErr(t, err)
+	newArchive := func(t *testing.T, files map[string][]byte, names ...string) *bytes.Reader {
+		t.Helper()
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, name := range names {
+			w, err := zw.Create(name)
+			checkErr(t, err)
+			_, err = w.Write(files[name])
+			checkErr(t, err)
+		}
+		checkErr(t, zw.Close())
+		return bytes.NewReader(buf.Bytes())
+	}
+	files := map[string][]byte{
+		"3D/3dmodel.model":        []byte("<model/>"),
+		"Metadata/plate_1.gcode":  fixture,
+		"Metadata/plate_1.bgcode": fixture,
+		"Metadata/empty":          nil,
+	}
+	tests := []struct {
+		name  string
+		names []string
+	}{
+		{"by extension", []string{"3D/3dmodel.model", "Metadata/plate_1.bgcode"}},
+		{"by magic number", []string{"3D/3dmodel.model", "Metadata/empty", "Metadata/plate_1.gcode"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newArchive(t, files, tt.names...)
+			got, err := ParseArchive(r, r.Size())
+			checkErr(t, err)
+			if got != want {
+				t.Error("ParseArchive() does not match Parse()")
+			}
+		})
+	}
+	t.Run("no payload", func(t *testing.T) {
+		r := newArchive(t, files, "3D/3dmodel.model", "Metadata/empty")
+		if _, err := DecodeArchive(r, r.Size()); !errors.Is(err, ErrNoBGCodeInArchive) {
+			t.Errorf("DecodeArchive() error = %v, want ErrNoBGCodeInArchive", err)
+		}
+	})
+	t.Run("not an archive", func(t *testing.T) {
+		if _, err := DecodeArchive(bytes.NewReader(fixture), int64(len(fixture))); err == nil {
+			t.Error("DecodeArchive() succeeded on a bare BGCode file")
+		}
+	})
+}
@@ -0,0 +1,221 @@
+// Package bgcodehttp serves the conversion of BGCode files into G-code over
+// HTTP.
+//
+//	http.Handle("/convert", &bgcodehttp.Handler{MaxBytes: 64 << 20})
+//
+// BGCode is uploaded with POST or PUT, either as the request body or as the
+// "file" field of a multipart form, and the converted G-code is streamed back
+// as it is decoded. Inputs are spooled into a temporary file first, so that
+// their blocks may come in any order.
+package bgcodehttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"cirello.io/bgcodego"
+)
+
+// ContentType is the media type of the G-code served by Handler.
+const ContentType = "text/x-gcode"
+
+// Handler converts BGCode into G-code.
+type Handler struct {
+	// Client fetches the BGCode input named by the "url" query parameter of
+	// GET requests. Proxying is disabled when Client is nil, as it lets
+	// callers reach any address the server can reach.
+	Client *http.Client
+
+	// MaxBytes limits the size of inputs. Zero means no limit.
+	MaxBytes int64
+
+	// Options are used for decoding every input.
+	Options []bgcodego.DecodeOption
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		body     io.ReadCloser
+		filename string
+		err      error
+	)
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		body, filename, err = h.upload(w, r)
+	case http.MethodGet, http.MethodHead:
+		body, filename, err = h.proxy(r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusCode(err))
+		return
+	}
+	defer body.Close()
+	if h.MaxBytes > 0 {
+		body = http.MaxBytesReader(w, body, h.MaxBytes)
+	}
+	if v := r.URL.Query().Get("filename"); v != "" {
+		filename = v
+	}
+	in, err := spool(body)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode(err))
+		return
+	}
+	defer func() {
+		in.Close()
+		os.Remove(in.Name())
+	}()
+	ow := &outputWriter{w: w, filename: outputName(filename)}
+	if err := bgcodego.ParseTo(ow, in, h.Options...); err != nil {
+		if !ow.started {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+		// The status line is already out: abort the response, so that
+		// clients do not mistake the truncated G-code for a complete one.
+		panic(http.ErrAbortHandler)
+	}
+	ow.start()
+}
+
+// spool copies the input into a temporary file. Being seekable, the file lets
+// ParseTo take blocks due before the G-code that are placed after it.
+func spool(body io.Reader) (*os.File, error) {
+	f, err := os.CreateTemp("", "bgcodehttp-*.bgcode")
+	if err != nil {
+		return nil, &httpError{http.StatusInternalServerError, fmt.Errorf("cannot spool input: %w", err)}
+	}
+	_, err = io.Copy(f, body)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("cannot spool input: %w", err)
+	}
+	return f, nil
+}
+
+// upload returns the BGCode uploaded in the request body, or in the "file"
+// field of a multipart form.
+func (h *Handler) upload(w http.ResponseWriter, r *http.Request) (io.ReadCloser, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, "", nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", badRequest(err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, "", badRequest(errors.New(`missing "file" field`))
+		} else if err != nil {
+			return nil, "", badRequest(err)
+		}
+		if part.FormName() == "file" {
+			return part, part.FileName(), nil
+		}
+		part.Close()
+	}
+}
+
+// proxy fetches the BGCode named by the "url" query parameter.
+func (h *Handler) proxy(r *http.Request) (io.ReadCloser, string, error) {
+	if h.Client == nil {
+		return nil, "", &httpError{http.StatusMethodNotAllowed, errors.New("proxying is disabled: upload the file with POST")}
+	}
+	u, err := url.Parse(r.URL.Query().Get("url"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, "", badRequest(errors.New(`"url" must be an absolute http or https URL`))
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", badRequest(err)
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, "", &httpError{http.StatusBadGateway, fmt.Errorf("cannot fetch input: %w", err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", &httpError{http.StatusBadGateway, fmt.Errorf("cannot fetch input: %s", resp.Status)}
+	}
+	return resp.Body, path.Base(u.Path), nil
+}
+
+// outputWriter sets the response headers before the first write.
+type outputWriter struct {
+	w        http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (ow *outputWriter) start() {
+	if ow.started {
+		return
+	}
+	ow.started = true
+	hdr := ow.w.Header()
+	hdr.Set("Content-Type", ContentType)
+	hdr.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": ow.filename}))
+	hdr.Set("X-Content-Type-Options", "nosniff")
+}
+
+func (ow *outputWriter) Write(p []byte) (int, error) {
+	ow.start()
+	return ow.w.Write(p)
+}
+
+// outputName derives the name of the G-code file from the name of the BGCode
+// input.
+func outputName(filename string) string {
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if filename == "." || filename == "/" {
+		return "output.gcode"
+	}
+	if ext := path.Ext(filename); strings.EqualFold(ext, ".bgcode") || strings.EqualFold(ext, ".bgc") {
+		filename = strings.TrimSuffix(filename, ext)
+	}
+	return filename + ".gcode"
+}
+
+type httpError struct {
+	code int
+	err  error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+func (e *httpError) Unwrap() error { return e.err }
+
+func badRequest(err error) error {
+	return &httpError{http.StatusBadRequest, err}
+}
+
+func statusCode(err error) int {
+	var he *httpError
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.As(err, &he):
+		return he.code
+	case errors.As(err, &mbe), errors.Is(err, bgcodego.ErrLimitExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, bgcodego.ErrNotBGCode):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
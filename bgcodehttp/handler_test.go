@@ -0,0 +1,149 @@
+package bgcodehttp
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"cirello.io/bgcodego"
+)
+
+const fixture = "../_testdata/mini_cube_b.bgcode"
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	data, err := os.ReadFile(fixture)
+	checkErr(t, err)
+	want, err := bgcodego.Parse(bytes.NewReader(data))
+	checkErr(t, err)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/files/mini_cube_b.bgcode" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(origin.Close)
+
+	multipartBody := &bytes.Buffer{}
+	mw := multipart.NewWriter(multipartBody)
+	checkErr(t, mw.WriteField("comment", "ignored"))
+	fw, err := mw.CreateFormFile("file", "mini_cube_b.bgcode")
+	checkErr(t, err)
+	_, err = fw.Write(data)
+	checkErr(t, err)
+	checkErr(t, mw.Close())
+
+	tests := []struct {
+		name        string
+		handler     *Handler
+		method      string
+		target      string
+		contentType string
+		body        []byte
+		wantCode    int
+		wantName    string
+	}{
+		{"raw upload", &Handler{}, http.MethodPost, "/?filename=cube.bgcode", "application/octet-stream", data, http.StatusOK, "cube.gcode"},
+		{"unnamed upload", &Handler{}, http.MethodPut, "/", "", data, http.StatusOK, "output.gcode"},
+		{"multipart upload", &Handler{}, http.MethodPost, "/", mw.FormDataContentType(), multipartBody.Bytes(), http.StatusOK, "mini_cube_b.gcode"},
+		{"proxy", &Handler{Client: origin.Client()}, http.MethodGet, "/?url=" + url.QueryEscape(origin.URL+"/files/mini_cube_b.bgcode"), "", nil, http.StatusOK, "mini_cube_b.gcode"},
+		{"proxy disabled", &Handler{}, http.MethodGet, "/?url=" + url.QueryEscape(origin.URL+"/files/mini_cube_b.bgcode"), "", nil, http.StatusMethodNotAllowed, ""},
+		{"proxy not found", &Handler{Client: origin.Client()}, http.MethodGet, "/?url=" + url.QueryEscape(origin.URL+"/missing"), "", nil, http.StatusBadGateway, ""},
+		{"proxy bad scheme", &Handler{Client: origin.Client()}, http.MethodGet, "/?url=file:///etc/passwd", "", nil, http.StatusBadRequest, ""},
+		{"not bgcode", &Handler{}, http.MethodPost, "/", "", []byte("G1 X1\nG1 X2\nG1 X3\n"), http.StatusUnsupportedMediaType, ""},
+		{"truncated header", &Handler{}, http.MethodPost, "/", "", data[:40], http.StatusUnprocessableEntity, ""},
+		{"too large", &Handler{MaxBytes: 1024}, http.MethodPost, "/", "", data, http.StatusRequestEntityTooLarge, ""},
+		{"limit exceeded", &Handler{Options: []bgcodego.DecodeOption{bgcodego.WithMaxBlocks(2)}}, http.MethodPost, "/", "", data, http.StatusRequestEntityTooLarge, ""},
+		{"bad method", &Handler{}, http.MethodDelete, "/", "", nil, http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != ContentType {
+				t.Errorf("Content-Type = %q, want %q", got, ContentType)
+			}
+			if got, want := rec.Header().Get("Content-Disposition"), `attachment; filename=`+tt.wantName; got != want {
+				t.Errorf("Content-Disposition = %q, want %q", got, want)
+			}
+			if rec.Body.String() != want {
+				t.Error("unexpected G-code")
+			}
+		})
+	}
+}
+
+func TestHandler_abortsTruncatedOutput(t *testing.T) {
+	data, err := os.ReadFile(fixture)
+	checkErr(t, err)
+	srv := httptest.NewServer(&Handler{})
+	t.Cleanup(srv.Close)
+	resp, err := http.Post(srv.URL, "application/octet-stream", bytes.NewReader(data[:len(data)-100]))
+	checkErr(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("truncated output read without error")
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	tests := map[string]string{
+		"":                   "output.gcode",
+		"cube.bgcode":        "cube.gcode",
+		"CUBE.BGCODE":        "CUBE.gcode",
+		"cube.bgc":           "cube.gcode",
+		"cube":               "cube.gcode",
+		`C:\prints\a.bgcode`: "a.gcode",
+		"../../etc/passwd":   "passwd.gcode",
+	}
+	for in, want := range tests {
+		if got := outputName(in); got != want {
+			t.Errorf("outputName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHandler_lateBlock(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := bgcodego.NewWriter(buf)
+	checkErr(t, err)
+	checkErr(t, w.WriteFileMetadata(bgcodego.KeyValues{{Key: "Producer", Value: "x"}}))
+	checkErr(t, w.WriteGCode("G1 X1\n"))
+	checkErr(t, w.WritePrinterMetadata(bgcodego.KeyValues{{Key: "printer_model", Value: "MINI"}}))
+	want, err := bgcodego.Parse(bytes.NewReader(buf.Bytes()))
+	checkErr(t, err)
+
+	rec := httptest.NewRecorder()
+	(&Handler{}).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(buf.Bytes())))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if rec.Body.String() != want {
+		t.Errorf("unexpected G-code:\n%s", rec.Body)
+	}
+}
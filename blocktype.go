@@ -0,0 +1,49 @@
+package bgcodego
+
+import (
+	"io"
+	"sync"
+)
+
+// BlockParser decodes the contents of a block. Parse reads the block
+// parameters and data that follow the block header, whose sizes are
+// hdr.ParametersSize() and hdr.Length(); whatever it leaves unread is
+// skipped.
+type BlockParser interface {
+	Parse(r io.Reader, hdr *BlockHeader) error
+	BlockRenderer
+}
+
+type blockType struct {
+	name     string
+	newBlock func() BlockParser
+}
+
+var (
+	blockTypesMu sync.RWMutex
+	blockTypes   = map[BlockHeaderType]blockType{}
+)
+
+// RegisterBlockType makes a block type unknown to the specification
+// decodable, such as vendor-specific or future block types. Blocks of this
+// type are read with 2 bytes of parameters, as metadata and G-code blocks
+// are, and gathered in File.Custom once decoded. The block types defined by
+// the specification cannot be replaced.
+func RegisterBlockType(bht BlockHeaderType, name string, newBlock func() BlockParser) {
+	if builtinBlock(bht) != nil {
+		panic("bgcodego: cannot replace block type " + bht.String())
+	}
+	if newBlock == nil {
+		panic("bgcodego: RegisterBlockType with nil constructor")
+	}
+	blockTypesMu.Lock()
+	defer blockTypesMu.Unlock()
+	blockTypes[bht] = blockType{name: name, newBlock: newBlock}
+}
+
+func lookupBlockType(bht BlockHeaderType) (blockType, bool) {
+	blockTypesMu.RLock()
+	defer blockTypesMu.RUnlock()
+	bt, ok := blockTypes[bht]
+	return bt, ok
+}
@@ -0,0 +1,87 @@
+package bgcodego
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// vendorBlock is a block type unknown to the specification, for testing the
+// registry.
+type vendorBlock struct {
+	body string
+}
+
+func (vb *vendorBlock) Parse(r io.Reader, hdr *BlockHeader) error {
+	if _, err := io.CopyN(io.Discard, r, int64(hdr.ParametersSize())); err != nil {
+		return err
+	}
+	data := make([]byte, hdr.Length())
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	data, err := hdr.Inflate(data)
+	if err != nil {
+		return err
+	}
+	vb.body = string(data)
+	return nil
+}
+
+func (vb *vendorBlock) Render() string {
+	return "; vendor block = " + vb.body + "\n"
+}
+
+// lazyBlock reads nothing, leaving the block contents to be skipped.
+type lazyBlock struct{}
+
+func (lazyBlock) Parse(io.Reader, *BlockHeader) error { return nil }
+func (lazyBlock) Render() string                      { return "" }
+
+func TestRegisterBlockType(t *testing.T) {
+	const vendor BlockHeaderType = 99
+	future, err := os.ReadFile("_testdata/future_block.bgcode")
+	checkErr(t, err)
+	if vendor.IsValid() {
+		t.Fatal("unexpected valid block type before registration")
+	}
+	t.Cleanup(func() {
+		blockTypesMu.Lock()
+		defer blockTypesMu.Unlock()
+		delete(blockTypes, vendor)
+	})
+
+	RegisterBlockType(vendor, "Vendor", func() BlockParser { return &vendorBlock{} })
+	if !vendor.IsValid() || vendor.String() != "Vendor" {
+		t.Errorf("unexpected registered block type: %v", vendor)
+	}
+	f, err := Decode(strings.NewReader(string(future)))
+	checkErr(t, err)
+	if len(f.Custom) != 1 || len(f.Warnings) != 0 {
+		t.Fatalf("unexpected custom blocks: %#v (warnings: %v)", f.Custom, f.Warnings)
+	}
+	vb, ok := f.Custom[0].(*vendorBlock)
+	if !ok {
+		t.Fatalf("unexpected custom block type: %T", f.Custom[0])
+	}
+	if !strings.Contains(f.Render(), vb.Render()) {
+		t.Error("custom block missing from rendered output")
+	}
+
+	RegisterBlockType(vendor, "Vendor", func() BlockParser { return lazyBlock{} })
+	f, err = Decode(strings.NewReader(string(future)))
+	checkErr(t, err)
+	if len(f.Custom) != 1 {
+		t.Fatalf("unexpected custom blocks: %#v", f.Custom)
+	}
+}
+
+func TestRegisterBlockType_builtin(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic when replacing a built-in block type")
+		}
+	}()
+	RegisterBlockType(BlockHeaderTypeGCode, "GCode", func() BlockParser { return lazyBlock{} })
+}
@@ -0,0 +1,67 @@
+package bgcodego
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GCodeHash returns the hex-encoded SHA-256 digest of the decoded G-code of
+// all G-code blocks, regardless of how they were compressed or encoded.
+func (f *File) GCodeHash() string {
+	h := sha256.New()
+	for _, gcode := range f.GCode {
+		h.Write([]byte(gcode.Body))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Canonical returns a normalized textual representation of the file, meant
+// for comparisons in tests. Metadata is sorted by key, thumbnails are
+// reduced to their digests and sorted, and the G-code is decoded. Two files
+// that differ only in compression, checksums, encoding or block order have
+// the same canonical form.
+func (f *File) Canonical() string {
+	out := &strings.Builder{}
+	canonicalValues := func(section string, values KeyValues) {
+		fmt.Fprintf(out, "[%s]\n", section)
+		sorted := slices.Clone(values)
+		slices.SortStableFunc(sorted, func(a, b KeyValue) int {
+			return cmp.Compare(a.Key, b.Key)
+		})
+		for _, kv := range sorted {
+			fmt.Fprintf(out, "%s = %s\n", kv.Key, kv.Value)
+		}
+	}
+	if f.FileMetadata != nil {
+		canonicalValues("file", f.FileMetadata.Values)
+	}
+	if f.PrinterMetadata != nil {
+		canonicalValues("printer", f.PrinterMetadata.Values)
+	}
+	if f.PrintMetadata != nil {
+		canonicalValues("print", f.PrintMetadata.Values)
+	}
+	if f.SlicerMetadata != nil {
+		canonicalValues("slicer", f.SlicerMetadata.Values)
+	}
+	thumbnails := make([]string, 0, len(f.Thumbnails))
+	for _, thumbnail := range f.Thumbnails {
+		digest := sha256.Sum256(thumbnail.Body)
+		thumbnails = append(thumbnails, fmt.Sprintf("[thumbnail %dx%d %v]\nsha256 = %x\n", thumbnail.Width(), thumbnail.Height(), thumbnail.Format(), digest))
+	}
+	slices.Sort(thumbnails)
+	for _, thumbnail := range thumbnails {
+		fmt.Fprint(out, thumbnail)
+	}
+	if len(f.GCode) > 0 {
+		fmt.Fprintf(out, "[gcode]\nsha256 = %s\nlines = %d\n", f.GCodeHash(), f.GCodeLineCount())
+		for _, gcode := range f.GCode {
+			fmt.Fprint(out, gcode.Body)
+		}
+	}
+	return out.String()
+}
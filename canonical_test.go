@@ -0,0 +1,52 @@
+package bgcodego
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFile_Canonical(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	reordered, err := os.ReadFile("_testdata/reordered_first_block.bgcode")
+	checkErr(t, err)
+
+	t.Run("block order", func(t *testing.T) {
+		a, err := Decode(bytes.NewReader(bgcode[:410]))
+		checkErr(t, err)
+		b, err := Decode(bytes.NewReader(reordered))
+		checkErr(t, err)
+		if diff := cmp.Diff(a.Canonical(), b.Canonical()); diff != "" {
+			t.Errorf("Canonical() mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("metadata and thumbnail order", func(t *testing.T) {
+		a, err := Decode(bytes.NewReader(bgcode))
+		checkErr(t, err)
+		b, err := Decode(bytes.NewReader(bgcode))
+		checkErr(t, err)
+		b.Thumbnails[0], b.Thumbnails[1] = b.Thumbnails[1], b.Thumbnails[0]
+		values := b.PrintMetadata.Values
+		values[0], values[1] = values[1], values[0]
+		if diff := cmp.Diff(a.Canonical(), b.Canonical()); diff != "" {
+			t.Errorf("Canonical() mismatch (-want +got):\n%s", diff)
+		}
+		if !strings.Contains(a.Canonical(), "[gcode]\nsha256 = "+a.GCodeHash()+"\n") {
+			t.Error("expected the G-code digest in the canonical form")
+		}
+	})
+	t.Run("semantic difference", func(t *testing.T) {
+		a, err := Decode(bytes.NewReader(bgcode))
+		checkErr(t, err)
+		b, err := Decode(bytes.NewReader(bgcode))
+		checkErr(t, err)
+		b.PrintMetadata.Values[0].Value += "0"
+		if a.Canonical() == b.Canonical() {
+			t.Error("expected different canonical forms")
+		}
+	})
+}
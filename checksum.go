@@ -0,0 +1,79 @@
+package bgcodego
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"sync"
+)
+
+// Checksum implements a block checksum algorithm.
+type Checksum struct {
+	// Name is reported by ChecksumType.String.
+	Name string
+
+	// New returns a hash whose Sum is the block footer, as stored in the
+	// file. The size of the footer is the Size of the hash.
+	New func() hash.Hash
+}
+
+var (
+	checksumsMu sync.RWMutex
+	checksums   = map[ChecksumType]Checksum{
+		ChecksumTypeCRC32: {
+			Name: "CRC32",
+			New: func() hash.Hash {
+				return crc32Footer{crc32.NewIEEE()}
+			},
+		},
+	}
+)
+
+// crc32Footer stores the CRC32 in little-endian order, as the specification
+// requires, instead of the big-endian order of hash/crc32.
+type crc32Footer struct{ hash.Hash32 }
+
+func (c crc32Footer) Sum(b []byte) []byte {
+	return binary.LittleEndian.AppendUint32(b, c.Sum32())
+}
+
+// RegisterChecksum makes a checksum algorithm available for decoding and
+// encoding files, replacing any algorithm previously registered with the
+// same identifier. It is meant for experimenting with algorithms that future
+// revisions of the specification may add. ChecksumTypeNone cannot be
+// replaced.
+func RegisterChecksum(ct ChecksumType, c Checksum) {
+	if ct == ChecksumTypeNone {
+		panic("bgcodego: cannot register ChecksumTypeNone")
+	}
+	if c.New == nil {
+		panic("bgcodego: RegisterChecksum with nil New")
+	}
+	checksumsMu.Lock()
+	defer checksumsMu.Unlock()
+	checksums[ct] = c
+}
+
+func lookupChecksum(ct ChecksumType) (Checksum, bool) {
+	checksumsMu.RLock()
+	defer checksumsMu.RUnlock()
+	c, ok := checksums[ct]
+	return c, ok
+}
+
+// newHash returns the hash computing the block checksums, or nil for
+// ChecksumTypeNone and unknown checksum types.
+func (ct ChecksumType) newHash() hash.Hash {
+	if c, ok := lookupChecksum(ct); ok {
+		return c.New()
+	}
+	return nil
+}
+
+// Size reports the size in bytes of the footer appended to every block.
+func (ct ChecksumType) Size() int {
+	if h := ct.newHash(); h != nil {
+		return h.Size()
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"hash/adler32"
+	"io"
+	"testing"
+)
+
+func TestRegisterChecksum(t *testing.T) {
+	const adler ChecksumType = 100
+	if adler.IsValid() || adler.Size() != 0 {
+		t.Fatal("unexpected valid checksum before registration")
+	}
+	if ChecksumTypeCRC32.Size() != 4 || ChecksumTypeNone.Size() != 0 {
+		t.Error("unexpected built-in checksum sizes")
+	}
+	f := decodeFixture(t)
+	if _, err := Marshal(f, WithChecksumType(adler)); err == nil {
+		t.Error("expected error for unregistered checksum")
+	}
+
+	RegisterChecksum(adler, Checksum{
+		Name: "Adler32",
+		New:  func() hash.Hash { return adler32.New() },
+	})
+	t.Cleanup(func() {
+		checksumsMu.Lock()
+		defer checksumsMu.Unlock()
+		delete(checksums, adler)
+	})
+	if !adler.IsValid() || adler.String() != "Adler32" || adler.Size() != 4 {
+		t.Errorf("unexpected registered checksum: %v", adler)
+	}
+	bgcode, err := Marshal(f, WithChecksumType(adler))
+	checkErr(t, err)
+	got, err := Decode(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	if got.Header.ChecksumType != adler {
+		t.Errorf("unexpected checksum type: %v", got.Header.ChecksumType)
+	}
+	if got.Render() != f.Render() {
+		t.Error("unexpected round trip output")
+	}
+	vr, err := NewVerifyingReader(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	_, err = io.Copy(io.Discard, vr)
+	checkErr(t, err)
+
+	bgcode[len(bgcode)-1] ^= 0xFF
+	if _, err := Decode(bytes.NewReader(bgcode)); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("expected ErrBadChecksum, got: %v", err)
+	}
+}
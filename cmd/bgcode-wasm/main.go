@@ -0,0 +1,70 @@
+//go:build js && wasm
+
+// Command bgcode-wasm exposes the conversion of BGCode files to JavaScript,
+// so that browser tools can preview them client-side. Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o bgcode.wasm ./cmd/bgcode-wasm
+//
+// and load it with the wasm_exec.js shipped with Go. It defines a global
+// bgcode object whose functions take the file contents as a Uint8Array and
+// return an object holding either the result in its "output" field, or a
+// message in its "error" field:
+//
+//	bgcode.parse(data)      // G-code, as a string
+//	bgcode.parseBytes(data) // G-code, as a Uint8Array
+//	bgcode.metadata(data)   // metadata tables, as a JSON string
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"syscall/js"
+
+	"cirello.io/bgcodego"
+)
+
+func main() {
+	js.Global().Set("bgcode", js.ValueOf(map[string]any{
+		"parse": wrap(func(data []byte) (any, error) {
+			return bgcodego.ParseBytes(data)
+		}),
+		"parseBytes": wrap(func(data []byte) (any, error) {
+			gcode, err := bgcodego.AppendGCode(nil, bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			ret := js.Global().Get("Uint8Array").New(len(gcode))
+			js.CopyBytesToJS(ret, gcode)
+			return ret, nil
+		}),
+		"metadata": wrap(func(data []byte) (any, error) {
+			m, err := bgcodego.DecodeMetadata(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			out, err := json.Marshal(m)
+			return string(out), err
+		}),
+	}))
+	select {}
+}
+
+// wrap adapts fn to a JavaScript function taking a Uint8Array.
+func wrap(fn func(data []byte) (any, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) != 1 || !args[0].InstanceOf(js.Global().Get("Uint8Array")) {
+			return result(nil, errors.New("expected a single Uint8Array argument"))
+		}
+		data := make([]byte, args[0].Length())
+		js.CopyBytesToGo(data, args[0])
+		return result(fn(data))
+	})
+}
+
+func result(output any, err error) map[string]any {
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	return map[string]any{"output": output}
+}
@@ -0,0 +1,519 @@
+// Command bgcode converts and inspects BGCode files. The convert command
+// turns BGCode into G-code, and G-code into BGCode. BGCode compressed with
+// gzip or embedded in a zip-based container, such as a sliced 3MF project,
+// is converted as well. The cat command is a filter, streaming G-code out of
+// BGCode read from standard input, for pipelines that only accept G-code,
+// such as OctoPrint preprocessors and Klipper virtual SD cards.
+//
+// Usage:
+//
+//	bgcode convert file.bgcode [-o file.gcode] [-metadata file.ini] [-skip-unknown] [-no-thumbnails] [-klipper] [-progress]
+//	bgcode convert file.bgcode.gz [-o file.gcode] [-skip-unknown] [-no-thumbnails] [-klipper] [-progress]
+//	bgcode convert file.3mf [-o file.gcode] [-skip-unknown] [-no-thumbnails] [-klipper] [-progress]
+//	bgcode convert file.gcode [-o file.bgcode] [-compress] [-meatpack]
+//	bgcode cat [-skip-unknown] [-no-thumbnails] [-klipper] [file.bgcode ...]
+//	bgcode info file.bgcode [-json]
+//	bgcode extract-thumbnails file.bgcode [-d dir] [-format png|jpg|qoi]
+//	bgcode extract-config file.bgcode [-o file.ini]
+//	bgcode extract-gcode file.bgcode [-o file.gcode] [-lines from-to] [-layers from-to]
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"cirello.io/bgcodego"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("bgcode: ")
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+const usage = `usage:
+	bgcode convert file.bgcode [-o file.gcode] [-metadata file.ini] [-skip-unknown] [-no-thumbnails] [-klipper] [-progress]
+	bgcode convert file.bgcode.gz [-o file.gcode] [-skip-unknown] [-no-thumbnails] [-klipper] [-progress]
+	bgcode convert file.3mf [-o file.gcode] [-skip-unknown] [-no-thumbnails] [-klipper] [-progress]
+	bgcode convert file.gcode [-o file.bgcode] [-compress] [-meatpack]
+	bgcode cat [-skip-unknown] [-no-thumbnails] [-klipper] [file.bgcode ...]
+	bgcode info file.bgcode [-json]
+	bgcode extract-thumbnails file.bgcode [-d dir] [-format png|jpg|qoi]
+	bgcode extract-config file.bgcode [-o file.ini]
+	bgcode extract-gcode file.bgcode [-o file.gcode] [-lines from-to] [-layers from-to]`
+
+var errUsage = errors.New(usage)
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "convert":
+		return convert(args, stdout)
+	case "cat":
+		return cat(args, stdout)
+	case "info":
+		return info(args, stdout)
+	case "extract-thumbnails":
+		return extractThumbnails(args, stdout)
+	case "extract-config":
+		return extractConfig(args, stdout)
+	case "extract-gcode":
+		return extractGCode(args, stdout)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+}
+
+// parseArgs parses flags that may appear before or after the single
+// positional argument of a command, and returns that argument.
+func parseArgs(fs *flag.FlagSet, args []string) (string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", fmt.Errorf("%s: %w\n%s", fs.Name(), err, usage)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != 1 {
+		return "", errUsage
+	}
+	return positional[0], nil
+}
+
+func convert(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	output := fs.String("o", "", "output file (default: standard output)")
+	skipUnknown := fs.Bool("skip-unknown", false, "skip blocks of unknown type when converting from BGCode")
+	noThumbnails := fs.Bool("no-thumbnails", false, "leave thumbnails out when converting from BGCode")
+	klipper := fs.Bool("klipper", false, "adapt the G-code to Klipper when converting from BGCode")
+	compress := fs.Bool("compress", false, "compress all metadata and G-code blocks with Deflate when converting to BGCode")
+	meatpack := fs.Bool("meatpack", false, "encode G-code with Meatpack when converting to BGCode")
+	progress := fs.Bool("progress", false, "report progress on standard error when converting from BGCode")
+	metadata := fs.String("metadata", "", "write the metadata to this file as INI, and the G-code alone to the output, when converting from BGCode")
+	input, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	fd, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	br := bufio.NewReader(fd)
+	magic, _ := br.Peek(4)
+	if *metadata != "" && string(magic) != "GCDE" {
+		return fmt.Errorf("convert: -metadata requires BGCode input\n%s", usage)
+	}
+	convert := func(w io.Writer) error {
+		var decodeOpts []bgcodego.DecodeOption
+		if *skipUnknown {
+			decodeOpts = append(decodeOpts, bgcodego.WithSkipUnknownBlocks())
+		}
+		if *noThumbnails {
+			decodeOpts = append(decodeOpts, bgcodego.WithRenderOptions(bgcodego.WithoutThumbnails()))
+		}
+		if *klipper {
+			decodeOpts = append(decodeOpts, bgcodego.WithRenderOptions(bgcodego.WithKlipper()))
+		}
+		if *progress {
+			decodeOpts = append(decodeOpts, bgcodego.WithProgress(progressReporter(stderr)))
+			defer fmt.Fprintln(stderr)
+		}
+		if strings.HasPrefix(string(magic), "\x1f\x8b") {
+			return bgcodego.ParseTo(w, br, append(decodeOpts, bgcodego.WithContainerDetection())...)
+		}
+		switch string(magic) {
+		case "GCDE":
+			if fi, err := fd.Stat(); err == nil && fi.Mode().IsRegular() {
+				decodeOpts = append(decodeOpts, bgcodego.WithTotalSize(fi.Size()))
+			}
+			if *metadata != "" {
+				return convertSplit(w, *metadata, br, decodeOpts)
+			}
+			return bgcodego.ParseTo(w, br, decodeOpts...)
+		case "PK\x03\x04":
+			return convertArchive(w, fd, decodeOpts)
+		}
+		format, err := bgcodego.DetectReader(br)
+		if err != nil {
+			return err
+		}
+		if format != bgcodego.FormatGCode {
+			return fmt.Errorf("cannot convert %s: %w", input, bgcodego.ErrUnknownFormat)
+		}
+		var opts []bgcodego.EncodeOption
+		if *compress {
+			opts = append(opts, bgcodego.WithCompression(bgcodego.BlockHeaderCompressionDeflate))
+		}
+		if *meatpack {
+			opts = append(opts, bgcodego.WithGCodeEncoding(bgcodego.GCodeEncodingMeatpackWithComments))
+		}
+		return bgcodego.Transcode(w, br, opts...)
+	}
+	if *output == "" {
+		return convert(stdout)
+	}
+	return writeFile(*output, convert)
+}
+
+// writeFile creates the file at path with the output of write. The output is
+// written to a temporary file in the same directory, renamed to path once
+// complete, so that a failed conversion leaves no partial file behind.
+func writeFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// convertSplit converts BGCode into G-code written to w, and metadata written
+// to the INI file at path.
+func convertSplit(w io.Writer, path string, r io.Reader, opts []bgcodego.DecodeOption) error {
+	return writeFile(path, func(metadata io.Writer) error {
+		return bgcodego.ParseSplit(w, metadata, r, opts...)
+	})
+}
+
+// convertArchive converts the BGCode payload of a zip-based container, such
+// as a 3MF project, into G-code.
+func convertArchive(w io.Writer, fd *os.File, opts []bgcodego.DecodeOption) error {
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(fd, fi.Size())
+	if err != nil {
+		return err
+	}
+	zf, err := bgcodego.FindInArchive(zr)
+	if err != nil {
+		return err
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	opts = append(opts, bgcodego.WithTotalSize(int64(zf.UncompressedSize64)))
+	return bgcodego.ParseTo(w, rc, opts...)
+}
+
+// cat streams the G-code of the named files, or of standard input when no
+// file or "-" is named, to stdout. ASCII G-code, as well as BGCode compressed
+// with gzip, is accepted too.
+func cat(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("cat", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	skipUnknown := fs.Bool("skip-unknown", false, "skip blocks of unknown type")
+	noThumbnails := fs.Bool("no-thumbnails", false, "leave thumbnails out")
+	klipper := fs.Bool("klipper", false, "adapt the G-code to Klipper")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w\n%s", fs.Name(), err, usage)
+	}
+	opts := []bgcodego.DecodeOption{bgcodego.WithContainerDetection()}
+	if *skipUnknown {
+		opts = append(opts, bgcodego.WithSkipUnknownBlocks())
+	}
+	if *noThumbnails {
+		opts = append(opts, bgcodego.WithRenderOptions(bgcodego.WithoutThumbnails()))
+	}
+	if *klipper {
+		opts = append(opts, bgcodego.WithRenderOptions(bgcodego.WithKlipper()))
+	}
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	bw := bufio.NewWriter(stdout)
+	for _, input := range inputs {
+		if err := catFile(bw, input, opts); err != nil {
+			bw.Flush()
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func catFile(w io.Writer, input string, opts []bgcodego.DecodeOption) error {
+	if input == "-" {
+		if err := bgcodego.ConvertToGCode(w, stdin, opts...); err != nil {
+			return fmt.Errorf("standard input: %w", err)
+		}
+		return nil
+	}
+	fd, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	if err := bgcodego.ConvertToGCode(w, fd, opts...); err != nil {
+		return fmt.Errorf("%s: %w", input, err)
+	}
+	return nil
+}
+
+// stdin is read by the cat command.
+var stdin io.Reader = os.Stdin
+
+// stderr receives progress reports.
+var stderr io.Writer = os.Stderr
+
+// progressReporter returns a progress callback that keeps a single status
+// line up to date on w.
+func progressReporter(w io.Writer) func(bgcodego.ProgressEvent) {
+	return func(ev bgcodego.ProgressEvent) {
+		if ev.TotalBytes > 0 {
+			fmt.Fprintf(w, "\r%3d%% %d blocks, last %v", ev.BytesRead*100/ev.TotalBytes, ev.Blocks, ev.BlockType)
+			return
+		}
+		fmt.Fprintf(w, "\r%d bytes %d blocks, last %v", ev.BytesRead, ev.Blocks, ev.BlockType)
+	}
+}
+
+func info(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	input, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	fd, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	report, err := bgcodego.Inspect(bufio.NewReader(fd))
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(report)
+	}
+	fmt.Fprintf(stdout, "version: %d\n", report.Version)
+	fmt.Fprintf(stdout, "checksum: %v\n", report.ChecksumType)
+	var warnings []string
+	for _, b := range report.Blocks {
+		if !b.Type.IsValid() {
+			warnings = append(warnings, fmt.Sprintf("block #%d at offset %d: skipped block of unknown type %d", b.Index, b.Offset, b.Type))
+			continue
+		}
+		fmt.Fprintf(stdout, "block #%d at offset %d: %v, compression %v, %d bytes (%d uncompressed)",
+			b.Index, b.Offset, b.Type, b.Compression, b.CompressedSize, b.UncompressedSize)
+		if t := b.Thumbnail; t != nil {
+			fmt.Fprintf(stdout, ", %v %dx%d", t.Format, t.Width, t.Height)
+		}
+		if b.Checksum == bgcodego.ChecksumMismatch {
+			fmt.Fprint(stdout, ", checksum mismatch")
+		}
+		fmt.Fprintln(stdout)
+	}
+	types := make([]bgcodego.BlockHeaderType, 0, len(report.Stats.ByType))
+	for bht := range report.Stats.ByType {
+		types = append(types, bht)
+	}
+	slices.Sort(types)
+	for _, bht := range types {
+		printTotals(stdout, bht.String(), report.Stats.ByType[bht])
+	}
+	printTotals(stdout, "total", report.Stats.BlockTotals)
+	for _, w := range warnings {
+		fmt.Fprintln(stdout, "warning:", w)
+	}
+	return nil
+}
+
+func printTotals(w io.Writer, name string, bt bgcodego.BlockTotals) {
+	fmt.Fprintf(w, "%s: %d blocks, %d bytes (%d uncompressed), ratio %.2f\n",
+		name, bt.Blocks, bt.CompressedSize, bt.UncompressedSize, bt.CompressionRatio())
+}
+
+func extractThumbnails(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("extract-thumbnails", flag.ContinueOnError)
+	dir := fs.String("d", ".", "output directory")
+	format := fs.String("format", "", "re-encode thumbnails in this format (png, jpg or qoi)")
+	input, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	var convertTo bgcodego.BlockThumbnailFormat
+	if *format != "" {
+		convertTo, err = parseThumbnailFormat(*format)
+		if err != nil {
+			return err
+		}
+	}
+	fd, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	thumbnails, err := bgcodego.Thumbnails(fd)
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	for _, thumbnail := range thumbnails {
+		if *format != "" {
+			thumbnail, err = thumbnail.Convert(convertTo)
+			if err != nil {
+				return err
+			}
+		}
+		name := fmt.Sprintf("%s_%dx%d.%s", base, thumbnail.Width(), thumbnail.Height(), strings.ToLower(thumbnail.Format().String()))
+		path := filepath.Join(*dir, name)
+		if err := os.WriteFile(path, thumbnail.Body, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, path)
+	}
+	return nil
+}
+
+func extractConfig(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("extract-config", flag.ContinueOnError)
+	output := fs.String("o", "", "output file (default: standard output)")
+	input, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	fd, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	f, err := bgcodego.Decode(bufio.NewReader(fd), bgcodego.WithOnlyTypes(bgcodego.BlockHeaderTypeSlicerMetadata))
+	if err != nil {
+		return err
+	}
+	config, err := f.SlicerConfig()
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return config.WriteINI(stdout)
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := config.WriteINI(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func extractGCode(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("extract-gcode", flag.ContinueOnError)
+	output := fs.String("o", "", "output file (default: standard output)")
+	lines := fs.String("lines", "", "extract this zero-based, inclusive range of lines, such as 100-200")
+	layers := fs.String("layers", "", "extract this zero-based, inclusive range of layers, such as 10-25")
+	input, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *lines != "" && *layers != "" {
+		return fmt.Errorf("extract-gcode: -lines and -layers are mutually exclusive\n%s", usage)
+	}
+	fd, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	f, err := bgcodego.Decode(bufio.NewReader(fd), bgcodego.WithOnlyTypes(bgcodego.BlockHeaderTypeGCode))
+	if err != nil {
+		return err
+	}
+	var gcode string
+	switch {
+	case *layers != "":
+		start, end, err := parseRange(*layers, len(f.Layers())-1)
+		if err != nil {
+			return err
+		}
+		gcode, err = f.GCodeLayerRange(start, end)
+		if err != nil {
+			return err
+		}
+	default:
+		start, end, err := parseRange(*lines, f.GCodeLineCount()-1)
+		if err != nil {
+			return err
+		}
+		gcode, err = f.GCodeLineRange(start, end)
+		if err != nil {
+			return err
+		}
+	}
+	if *output == "" {
+		_, err := io.WriteString(stdout, gcode)
+		return err
+	}
+	return os.WriteFile(*output, []byte(gcode), 0o644)
+}
+
+// parseRange parses a range such as 10-25. Either end may be left out, to
+// start from 0 or to stop at last.
+func parseRange(s string, last int) (start, end int, err error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		from, to = s, s
+	}
+	start, end = 0, last
+	if from != "" {
+		if start, err = strconv.Atoi(from); err != nil {
+			return 0, 0, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+	}
+	if to != "" {
+		if end, err = strconv.Atoi(to); err != nil {
+			return 0, 0, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+	}
+	return start, end, nil
+}
+
+func parseThumbnailFormat(name string) (bgcodego.BlockThumbnailFormat, error) {
+	for _, format := range []bgcodego.BlockThumbnailFormat{bgcodego.BlockThumbnailFormatPNG, bgcodego.BlockThumbnailFormatJPG, bgcodego.BlockThumbnailFormatQOI} {
+		if strings.EqualFold(name, format.String()) {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown thumbnail format %q\n%s", name, usage)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cirello.io/bgcodego"
+)
+
+const fixture = "../../_testdata/mini_cube_b.bgcode"
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	fd, err := os.Open(fixture)
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	want, err := bgcodego.Parse(fd)
+	checkErr(t, err)
+
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"convert", fixture}, stdout))
+	if stdout.String() != want {
+		t.Error("unexpected output on stdout")
+	}
+
+	output := filepath.Join(t.TempDir(), "mini_cube_b.gcode")
+	checkErr(t, run([]string{"convert", fixture, "-o", output}, &bytes.Buffer{}))
+	got, err := os.ReadFile(output)
+	checkErr(t, err)
+	if string(got) != want {
+		t.Error("unexpected output file")
+	}
+}
+
+func TestConvert_noThumbnails(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"convert", "-no-thumbnails", fixture}, stdout))
+	if strings.Contains(stdout.String(), "; thumbnail begin") {
+		t.Error("thumbnails rendered")
+	}
+	if !strings.Contains(stdout.String(), "; prusaslicer_config = begin") {
+		t.Error("slicer configuration missing")
+	}
+}
+
+func TestConvert_metadata(t *testing.T) {
+	data, err := os.ReadFile(fixture)
+	checkErr(t, err)
+	wantGCode, wantMetadata := &bytes.Buffer{}, &bytes.Buffer{}
+	checkErr(t, bgcodego.ParseSplit(wantGCode, wantMetadata, bytes.NewReader(data)))
+
+	metadata := filepath.Join(t.TempDir(), "mini_cube_b.ini")
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"convert", "-metadata", metadata, fixture}, stdout))
+	if stdout.String() != wantGCode.String() {
+		t.Error("unexpected output on stdout")
+	}
+	got, err := os.ReadFile(metadata)
+	checkErr(t, err)
+	if string(got) != wantMetadata.String() {
+		t.Error("unexpected metadata file")
+	}
+}
+
+func TestConvert_failure(t *testing.T) {
+	data, err := os.ReadFile(fixture)
+	checkErr(t, err)
+	dir := t.TempDir()
+	truncated := filepath.Join(dir, "truncated.bgcode")
+	checkErr(t, os.WriteFile(truncated, data[:len(data)/2], 0o644))
+	output, metadata := filepath.Join(dir, "out.gcode"), filepath.Join(dir, "out.ini")
+	if err := run([]string{"convert", "-o", output, "-metadata", metadata, truncated}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for truncated input")
+	}
+	entries, err := os.ReadDir(dir)
+	checkErr(t, err)
+	if len(entries) != 1 {
+		t.Errorf("failed conversion left files behind: %v", entries)
+	}
+
+	gcode := strings.TrimSuffix(fixture, ".bgcode") + ".gcode"
+	if err := run([]string{"convert", "-metadata", metadata, gcode}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "usage:") {
+		t.Errorf("expected usage error for -metadata with G-code input, got: %v", err)
+	}
+}
+
+func TestConvert_progress(t *testing.T) {
+	progress := &bytes.Buffer{}
+	stderr = progress
+	t.Cleanup(func() { stderr = os.Stderr })
+	checkErr(t, run([]string{"convert", "-progress", fixture}, &bytes.Buffer{}))
+	if got, want := progress.String(), "\r100% 16 blocks, last GCode\n"; !strings.HasSuffix(got, want) {
+		t.Errorf("progress ends with %q, want %q", got[max(0, len(got)-40):], want)
+	}
+	if got := strings.Count(progress.String(), "\r"); got != 16 {
+		t.Errorf("got %d progress updates, want 16", got)
+	}
+}
+
+func TestConvert_archive(t *testing.T) {
+	data, err := os.ReadFile(fixture)
+	checkErr(t, err)
+	want, err := bgcodego.Parse(bytes.NewReader(data))
+	checkErr(t, err)
+	input := filepath.Join(t.TempDir(), "mini_cube_b.3mf")
+	fd, err := os.Create(input)
+	checkErr(t, err)
+	zw := zip.NewWriter(fd)
+	w, err := zw.Create("Metadata/plate_1.bgcode")
+	checkErr(t, err)
+	_, err = w.Write(data)
+	checkErr(t, err)
+	checkErr(t, zw.Close())
+	checkErr(t, fd.Close())
+
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"convert", input}, stdout))
+	if stdout.String() != want {
+		t.Error("unexpected output on stdout")
+	}
+}
+
+func TestConvert_gzip(t *testing.T) {
+	data, err := os.ReadFile(fixture)
+	checkErr(t, err)
+	want, err := bgcodego.Parse(bytes.NewReader(data))
+	checkErr(t, err)
+	input := filepath.Join(t.TempDir(), "mini_cube_b.bgcode.gz")
+	fd, err := os.Create(input)
+	checkErr(t, err)
+	gw := gzip.NewWriter(fd)
+	_, err = gw.Write(data)
+	checkErr(t, err)
+	checkErr(t, gw.Close())
+	checkErr(t, fd.Close())
+
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"convert", input}, stdout))
+	if stdout.String() != want {
+		t.Error("unexpected output on stdout")
+	}
+}
+
+func TestConvert_toBGCode(t *testing.T) {
+	dir := t.TempDir()
+	gcode := filepath.Join(dir, "mini_cube_b.gcode")
+	checkErr(t, run([]string{"convert", fixture, "-o", gcode}, &bytes.Buffer{}))
+	bgcode := filepath.Join(dir, "mini_cube_b.bgcode")
+	checkErr(t, run([]string{"convert", "-compress", "-meatpack", gcode, "-o", bgcode}, &bytes.Buffer{}))
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"convert", bgcode}, stdout))
+	want, err := os.ReadFile(gcode)
+	checkErr(t, err)
+	if stdout.String() != string(want) {
+		t.Error("unexpected round trip output")
+	}
+}
+
+func TestConvert_unknownFormat(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "image.png")
+	checkErr(t, os.WriteFile(input, []byte("\x89PNG\r\n\x1a\n"), 0o644))
+	if err := run([]string{"convert", input}, &bytes.Buffer{}); err == nil || !errors.Is(err, bgcodego.ErrUnknownFormat) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCat(t *testing.T) {
+	data, err := os.ReadFile(fixture)
+	checkErr(t, err)
+	want, err := bgcodego.Parse(bytes.NewReader(data))
+	checkErr(t, err)
+	gcode := filepath.Join(t.TempDir(), "mini_cube_b.gcode")
+	checkErr(t, os.WriteFile(gcode, []byte(want), 0o644))
+	t.Cleanup(func() { stdin = os.Stdin })
+
+	stdin = bytes.NewReader(data)
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"cat"}, stdout))
+	if stdout.String() != want {
+		t.Error("unexpected output for standard input")
+	}
+
+	stdin = bytes.NewReader(data)
+	stdout.Reset()
+	checkErr(t, run([]string{"cat", fixture, "-", gcode}, stdout))
+	if stdout.String() != want+want+want {
+		t.Error("unexpected output for concatenated inputs")
+	}
+
+	stdin = bytes.NewReader(data)
+	stdout.Reset()
+	checkErr(t, run([]string{"cat", "-no-thumbnails"}, stdout))
+	if strings.Contains(stdout.String(), "; thumbnail begin") {
+		t.Error("thumbnails rendered")
+	}
+
+	stdin = bytes.NewReader(data)
+	stdout.Reset()
+	checkErr(t, run([]string{"cat", "-klipper", "-", gcode}, stdout))
+	if strings.Count(stdout.String(), "\n; M862.3") != 2 || strings.Contains(stdout.String(), "\nM862") {
+		t.Error("G-code not adapted to Klipper")
+	}
+
+	stdin = strings.NewReader("\x89PNG\r\n\x1a\n")
+	if err := run([]string{"cat"}, &bytes.Buffer{}); !errors.Is(err, bgcodego.ErrUnknownFormat) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"info", fixture}, stdout))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 25 {
+		t.Fatalf("expected 25 lines, got %d:\n%s", len(lines), stdout)
+	}
+	const want = "block #2 at offset 410: Thumbnail, compression None, 461 bytes (461 uncompressed), PNG 16x16"
+	if lines[4] != want {
+		t.Errorf("unexpected thumbnail line: %q", lines[4])
+	}
+	const total = "total: 16 blocks, 148972 bytes (369669 uncompressed), ratio 2.48"
+	if lines[24] != total {
+		t.Errorf("unexpected total line: %q", lines[24])
+	}
+}
+
+func TestInfo_json(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"info", "-json", fixture}, stdout))
+	var report bgcodego.Report
+	checkErr(t, json.Unmarshal(stdout.Bytes(), &report))
+	if len(report.Blocks) != 16 || report.Blocks[2].Thumbnail == nil {
+		t.Errorf("unexpected report:\n%s", stdout)
+	}
+}
+
+func TestInfo_unknownBlock(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"info", "../../_testdata/future_block.bgcode"}, stdout))
+	const want = "warning: block #1 at offset 51: skipped block of unknown type 99\n"
+	if !strings.HasSuffix(stdout.String(), want) {
+		t.Errorf("unexpected output:\n%s", stdout)
+	}
+}
+
+func TestExtractThumbnails(t *testing.T) {
+	dir := t.TempDir()
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"extract-thumbnails", "-d", dir, fixture}, stdout))
+	for _, name := range []string{"mini_cube_b_16x16.png", "mini_cube_b_220x124.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	checkErr(t, run([]string{"extract-thumbnails", "-d", dir, "-format", "qoi", fixture}, stdout))
+	qoi, err := os.ReadFile(filepath.Join(dir, "mini_cube_b_220x124.qoi"))
+	checkErr(t, err)
+	if !bytes.HasPrefix(qoi, []byte("qoif")) {
+		t.Errorf("unexpected QOI thumbnail: %q", qoi[:min(len(qoi), 16)])
+	}
+	if err := run([]string{"extract-thumbnails", "-d", dir, "-format", "gif", fixture}, stdout); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestExtractConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.ini")
+	checkErr(t, run([]string{"extract-config", "-o", path, fixture}, &bytes.Buffer{}))
+	fd, err := os.Open(path)
+	checkErr(t, err)
+	defer fd.Close()
+	config, err := bgcodego.ParseSlicerConfig(fd)
+	checkErr(t, err)
+	if got := config.Values.First("printer_model"); got != "MINI" {
+		t.Errorf("unexpected printer_model: %q", got)
+	}
+}
+
+func TestRun_usage(t *testing.T) {
+	for _, args := range [][]string{nil, {"unknown"}, {"convert"}, {"info", "a", "b"}, {"convert", "-x", fixture}} {
+		if err := run(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
+
+func TestExtractGCode(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	checkErr(t, run([]string{"extract-gcode", "-layers", "5", fixture}, stdout))
+	if !strings.HasPrefix(stdout.String(), ";LAYER_CHANGE\n;Z:0.95\n") || strings.Count(stdout.String(), ";LAYER_CHANGE") != 1 {
+		t.Errorf("unexpected layer:\n%.80s", stdout)
+	}
+
+	path := filepath.Join(t.TempDir(), "rest.gcode")
+	checkErr(t, run([]string{"extract-gcode", "-o", path, "-lines", "25849-", fixture}, &bytes.Buffer{}))
+	rest, err := os.ReadFile(path)
+	checkErr(t, err)
+	if string(rest) != "M84\nM73 P100 R0\n" {
+		t.Errorf("unexpected lines: %q", rest)
+	}
+
+	for _, args := range [][]string{{"-lines", "1-2", "-layers", "1"}, {"-lines", "a-2"}, {"-layers", "3-1"}} {
+		if err := run(append([]string{"extract-gcode", fixture}, args...), &bytes.Buffer{}); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+
+	empty := &bytes.Buffer{}
+	w, err := bgcodego.NewWriter(empty)
+	checkErr(t, err)
+	checkErr(t, w.WriteFileMetadata(bgcodego.KeyValues{{Key: "Producer", Value: "x"}}))
+	path = filepath.Join(t.TempDir(), "empty.bgcode")
+	checkErr(t, os.WriteFile(path, empty.Bytes(), 0o644))
+	if err := run([]string{"extract-gcode", path}, &bytes.Buffer{}); !errors.Is(err, bgcodego.ErrNoGCode) {
+		t.Errorf("expected ErrNoGCode, got: %v", err)
+	}
+	if err := run([]string{"extract-gcode", "-layers", "0-", path}, &bytes.Buffer{}); !errors.Is(err, bgcodego.ErrNoLayers) {
+		t.Errorf("expected ErrNoLayers, got: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package bgcodego
+
+import (
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+
+	"cirello.io/bgcodego/internal/heatshrink"
+)
+
+// Compression implements a block compression algorithm.
+type Compression struct {
+	// Name is reported by BlockHeaderCompression.String.
+	Name string
+
+	// NewReader wraps r with a streaming decompressor.
+	NewReader func(r io.Reader) (io.Reader, error)
+
+	// NewWriter wraps w with a streaming compressor. It may be nil for
+	// algorithms that are only decoded.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	compressionsMu sync.RWMutex
+	compressions   = map[BlockHeaderCompression]Compression{
+		BlockHeaderCompressionDeflate: {
+			Name: "Deflate",
+			NewReader: func(r io.Reader) (io.Reader, error) {
+				zr, err := zlib.NewReader(r)
+				if err != nil {
+					return nil, err
+				}
+				return zlibReader{zr}, nil
+			},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return zlib.NewWriter(w), nil
+			},
+		},
+		BlockHeaderCompressionHeatshrink114: heatshrinkCompression("Heatshrink114", 11, 4),
+		BlockHeaderCompressionHeatshrink124: heatshrinkCompression("Heatshrink124", 12, 4),
+	}
+)
+
+func heatshrinkCompression(name string, window, lookahead uint8) Compression {
+	return Compression{
+		Name: name,
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			return heatshrinkReader{heatshrink.NewReader(r, window, lookahead)}, nil
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return heatshrink.NewWriter(w, window, lookahead), nil
+		},
+	}
+}
+
+// heatshrinkReader adapts the heatshrink decompressor to resetReader.
+type heatshrinkReader struct{ *heatshrink.Reader }
+
+func (hr heatshrinkReader) Reset(r io.Reader) error {
+	hr.Reader.Reset(r)
+	return nil
+}
+
+// zlibReader adapts the zlib decompressor to resetReader.
+type zlibReader struct{ io.ReadCloser }
+
+func (zr zlibReader) Reset(r io.Reader) error {
+	return zr.ReadCloser.(zlib.Resetter).Reset(r, nil)
+}
+
+// RegisterCompression makes a compression algorithm available for decoding
+// and encoding blocks, replacing any algorithm previously registered with
+// the same identifier. It is meant for experimenting with algorithms that
+// future revisions of the specification may add. BlockHeaderCompressionNone
+// cannot be replaced.
+func RegisterCompression(bhc BlockHeaderCompression, c Compression) {
+	if bhc == BlockHeaderCompressionNone {
+		panic("bgcodego: cannot register BlockHeaderCompressionNone")
+	}
+	if c.NewReader == nil {
+		panic("bgcodego: RegisterCompression with nil NewReader")
+	}
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	compressions[bhc] = c
+	inflaterPools.Delete(bhc)
+}
+
+func lookupCompression(bhc BlockHeaderCompression) (Compression, bool) {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+	c, ok := compressions[bhc]
+	return c, ok
+}
+
+// compressor wraps w with a streaming compressor for the given algorithm.
+func compressor(bhc BlockHeaderCompression, w io.Writer) (io.WriteCloser, error) {
+	c, ok := lookupCompression(bhc)
+	if !ok || c.NewWriter == nil {
+		return nil, fmt.Errorf("cannot write blocks: %w", &UnsupportedCompressionError{Compression: bhc})
+	}
+	return c.NewWriter(w)
+}
@@ -0,0 +1,118 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// xorReader and xorWriter implement a toy compression for testing the
+// registry.
+type xorReader struct{ r io.Reader }
+
+func (xr xorReader) Read(p []byte) (int, error) {
+	n, err := xr.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= 0xAA
+	}
+	return n, err
+}
+
+type xorWriter struct{ w io.Writer }
+
+func (xw xorWriter) Write(p []byte) (int, error) {
+	q := bytes.Clone(p)
+	for i := range q {
+		q[i] ^= 0xAA
+	}
+	return xw.w.Write(q)
+}
+
+func (xw xorWriter) Close() error { return nil }
+
+func TestRegisterCompression(t *testing.T) {
+	const xor BlockHeaderCompression = 100
+	if xor.IsValid() {
+		t.Fatal("unexpected valid compression before registration")
+	}
+	f := decodeFixture(t)
+	if _, err := Marshal(f, WithCompression(xor)); err == nil {
+		t.Error("expected error for unregistered compression")
+	}
+
+	RegisterCompression(xor, Compression{
+		Name: "XOR",
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			return xorReader{r}, nil
+		},
+	})
+	t.Cleanup(func() {
+		compressionsMu.Lock()
+		defer compressionsMu.Unlock()
+		delete(compressions, xor)
+	})
+	if !xor.IsValid() || xor.String() != "XOR" {
+		t.Errorf("unexpected registered compression: %v", xor)
+	}
+	if _, err := Marshal(f, WithCompression(xor)); err == nil {
+		t.Error("expected error for decode-only compression")
+	}
+
+	RegisterCompression(xor, Compression{
+		Name: "XOR",
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			return xorReader{r}, nil
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return xorWriter{w}, nil
+		},
+	})
+	bgcode, err := Marshal(f, WithCompression(xor))
+	checkErr(t, err)
+	got, err := Decode(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	if got.Render() != f.Render() {
+		t.Error("unexpected round trip output")
+	}
+
+	compressionsMu.Lock()
+	delete(compressions, xor)
+	compressionsMu.Unlock()
+	if _, err := Decode(bytes.NewReader(bgcode)); err == nil || errors.Is(err, ErrBadChecksum) {
+		t.Errorf("expected unknown compression error, got: %v", err)
+	}
+}
+
+func BenchmarkInflate(b *testing.B) {
+	gcode, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	gcode = gcode[:min(len(gcode), 64<<10)] // about the size of a G-code block
+	for _, bhc := range []BlockHeaderCompression{BlockHeaderCompressionDeflate, BlockHeaderCompressionHeatshrink114, BlockHeaderCompressionHeatshrink124} {
+		b.Run(bhc.String(), func(b *testing.B) {
+			compressed := &bytes.Buffer{}
+			w, err := compressor(bhc, compressed)
+			if err != nil {
+				b.Fatal(err)
+			}
+			w.Write(gcode)
+			if err := w.Close(); err != nil {
+				b.Fatal(err)
+			}
+			bh := &BlockHeader{}
+			bh.basic.Compression = bhc
+			bh.basic.UncompressedSize = uint32(len(gcode))
+			bh.extended.CompressedSize = uint32(compressed.Len())
+			b.SetBytes(int64(len(gcode)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bh.Inflate(compressed.Bytes()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package bgcodego
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// SlicerConfig is the slicer configuration of a print, as PrusaSlicer
+// embeds it in the slicer metadata block. Keys keep their order, so that the
+// configuration is written back the way it was read.
+type SlicerConfig struct {
+	Values KeyValues
+}
+
+// SlicerConfig returns a copy of the configuration held by the slicer
+// metadata block.
+func (f *File) SlicerConfig() (*SlicerConfig, error) {
+	if f.SlicerMetadata == nil {
+		return nil, errors.New("missing slicer metadata block")
+	}
+	return &SlicerConfig{Values: slices.Clone(f.SlicerMetadata.Values)}, nil
+}
+
+// ParseSlicerConfig reads a configuration either as a standalone .ini file,
+// made of "key = value" lines, or as embedded in G-code, between the
+// "; prusaslicer_config = begin" and "; prusaslicer_config = end" markers.
+// Blank lines and lines starting with "#" are skipped.
+func ParseSlicerConfig(r io.Reader) (*SlicerConfig, error) {
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read slicer config: %w", err)
+	}
+	lines := strings.Split(string(text), "\n")
+	embedded := false
+	if begin := slices.IndexFunc(lines, func(line string) bool { return trimEOL(line) == "; prusaslicer_config = begin" }); begin >= 0 {
+		lines = lines[begin+1:]
+		end := slices.IndexFunc(lines, func(line string) bool { return trimEOL(line) == "; prusaslicer_config = end" })
+		if end < 0 {
+			return nil, errors.New("cannot parse slicer config: missing end marker")
+		}
+		lines, embedded = lines[:end], true
+	}
+	c := &SlicerConfig{}
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if embedded {
+			line = strings.TrimSpace(strings.TrimPrefix(line, ";"))
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("cannot parse slicer config: malformed line %d: %q", i+1, line)
+		}
+		c.Values.Append(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+	return c, nil
+}
+
+// Block returns a slicer metadata block holding the configuration, so that
+// it can be put back in a file.
+func (c *SlicerConfig) Block() *BlockSlicerMetadata {
+	return &BlockSlicerMetadata{Values: slices.Clone(c.Values)}
+}
+
+// WriteGCode writes the configuration in the "; key = value" format
+// PrusaSlicer embeds at the end of G-code, markers included.
+func (c *SlicerConfig) WriteGCode(w io.Writer) error {
+	_, err := io.WriteString(w, c.Block().Render())
+	return err
+}
+
+// WriteINI writes the configuration as a standalone .ini file, as PrusaSlicer
+// exports and imports its profiles.
+func (c *SlicerConfig) WriteINI(w io.Writer) error {
+	out := &strings.Builder{}
+	for _, kv := range c.Values {
+		fmt.Fprintf(out, "%s = %s\n", kv.Key, kv.Value)
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
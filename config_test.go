@@ -0,0 +1,50 @@
+package bgcodego
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSlicerConfig(t *testing.T) {
+	f := decodeFixture(t)
+	config, err := f.SlicerConfig()
+	checkErr(t, err)
+	if diff := cmp.Diff(f.SlicerMetadata.Values, config.Values); diff != "" {
+		t.Fatalf("SlicerConfig() mismatch (-want +got):\n%s", diff)
+	}
+
+	gcode := &bytes.Buffer{}
+	checkErr(t, config.WriteGCode(gcode))
+	if got, want := gcode.String(), f.SlicerMetadata.Render(); got != want {
+		t.Error("WriteGCode() does not match the rendered slicer metadata")
+	}
+	parsed, err := ParseSlicerConfig(strings.NewReader(f.Render()))
+	checkErr(t, err)
+	if diff := cmp.Diff(config.Values, parsed.Values); diff != "" {
+		t.Errorf("ParseSlicerConfig(G-code) mismatch (-want +got):\n%s", diff)
+	}
+
+	ini := &bytes.Buffer{}
+	checkErr(t, config.WriteINI(ini))
+	if !strings.Contains(ini.String(), "\nprinter_model = MINI\n") {
+		t.Errorf("unexpected INI output:\n%.200s", ini)
+	}
+	parsed, err = ParseSlicerConfig(strings.NewReader("# generated by PrusaSlicer\n" + ini.String()))
+	checkErr(t, err)
+	if diff := cmp.Diff(config.Values, parsed.Values); diff != "" {
+		t.Errorf("ParseSlicerConfig(INI) mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := ParseSlicerConfig(strings.NewReader("; prusaslicer_config = begin\n; a = 1\n")); err == nil {
+		t.Error("expected error for missing end marker")
+	}
+	if _, err := ParseSlicerConfig(strings.NewReader("not a pair\n")); err == nil {
+		t.Error("expected error for malformed line")
+	}
+	if _, err := (&File{}).SlicerConfig(); err == nil {
+		t.Error("expected error for missing slicer metadata")
+	}
+}
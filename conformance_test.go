@@ -0,0 +1,143 @@
+package bgcodego
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var conformanceDir = flag.String("conformance", "", "directory of additional .bgcode files, each next to its reference .gcode, to run the conformance suite against")
+
+// conformanceCase is a BGCode file, as produced by a slicer, along with the
+// G-code the slicer produced for the same print.
+type conformanceCase struct {
+	name   string
+	bgcode []byte
+	gcode  []byte
+}
+
+// conformanceCorpus gathers the .bgcode files of _testdata and of the
+// -conformance directory that have a reference .gcode file next to them.
+func conformanceCorpus(t *testing.T) []conformanceCase {
+	t.Helper()
+	dirs := []string{"_testdata"}
+	if *conformanceDir != "" {
+		dirs = append(dirs, *conformanceDir)
+	}
+	var corpus []conformanceCase
+	for _, dir := range dirs {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.bgcode"))
+		checkErr(t, err)
+		for _, path := range matches {
+			gcode, err := os.ReadFile(strings.TrimSuffix(path, ".bgcode") + ".gcode")
+			if os.IsNotExist(err) {
+				continue
+			}
+			checkErr(t, err)
+			bgcode, err := os.ReadFile(path)
+			checkErr(t, err)
+			corpus = append(corpus, conformanceCase{name: path, bgcode: bgcode, gcode: gcode})
+		}
+	}
+	if len(corpus) == 0 {
+		t.Fatal("empty conformance corpus")
+	}
+	return corpus
+}
+
+// blockLayout is what the conformance suite expects an encoder to reproduce
+// of a block: compressed data, as well as Meatpack encoded G-code, differ
+// between implementations. Size is the size of the uncompressed data, save
+// for G-code blocks, where it is the size of the decoded G-code.
+type blockLayout struct {
+	Type        BlockHeaderType
+	Compression BlockHeaderCompression
+	Size        int
+}
+
+func blockLayouts(t *testing.T, bgcode []byte) []blockLayout {
+	t.Helper()
+	idx, err := Index(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	f, err := Decode(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	var blocks []blockLayout
+	gcode := f.GCode
+	for _, b := range idx.Blocks {
+		size := int(b.Header.UncompressedSize())
+		if b.Header.Type() == BlockHeaderTypeGCode {
+			size, gcode = len(gcode[0].Body), gcode[1:]
+		}
+		blocks = append(blocks, blockLayout{b.Header.Type(), b.Header.Compression(), size})
+	}
+	return blocks
+}
+
+// mirrorOptions returns the encoding options that reproduce the choices
+// made by the slicer that wrote f.
+func mirrorOptions(t *testing.T, bgcode []byte, f *File) []EncodeOption {
+	t.Helper()
+	opts := []EncodeOption{WithChecksumType(f.Header.ChecksumType)}
+	for _, b := range blockLayouts(t, bgcode) {
+		opts = append(opts, WithBlockCompression(b.Type, b.Compression))
+	}
+	if len(f.GCode) > 0 {
+		opts = append(opts, WithGCodeEncoding(f.GCode[0].Encoding()))
+	}
+	return opts
+}
+
+// TestConformance checks that files written by slicers decode to the G-code
+// they produced, and that encoding that G-code again yields files laid out
+// the way the slicer laid them out. Pass -conformance with a directory of
+// files generated by other slicer releases to extend the corpus.
+func TestConformance(t *testing.T) {
+	for _, tc := range conformanceCorpus(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := Decode(bytes.NewReader(tc.bgcode), WithStrict())
+			checkErr(t, err)
+			opts := mirrorOptions(t, tc.bgcode, f)
+			t.Run("parse", func(t *testing.T) {
+				got, err := Parse(bytes.NewReader(tc.bgcode))
+				checkErr(t, err)
+				if got != string(tc.gcode) {
+					t.Error("Parse() does not match the reference G-code")
+				}
+			})
+			t.Run("decode", func(t *testing.T) {
+				if f.Render() != string(tc.gcode) {
+					t.Error("Render() does not match the reference G-code")
+				}
+			})
+			t.Run("encode", func(t *testing.T) {
+				bgcode, err := Marshal(f, opts...)
+				checkErr(t, err)
+				if diff := cmp.Diff(blockLayouts(t, tc.bgcode), blockLayouts(t, bgcode)); diff != "" {
+					t.Errorf("Encode() layout mismatch (-want +got):\n%s", diff)
+				}
+				got, err := Parse(bytes.NewReader(bgcode))
+				checkErr(t, err)
+				if got != string(tc.gcode) {
+					t.Error("encoded file does not match the reference G-code")
+				}
+			})
+			t.Run("transcode", func(t *testing.T) {
+				out := &bytes.Buffer{}
+				checkErr(t, Transcode(out, bytes.NewReader(tc.gcode), opts...))
+				if diff := cmp.Diff(blockLayouts(t, tc.bgcode), blockLayouts(t, out.Bytes())); diff != "" {
+					t.Errorf("Transcode() layout mismatch (-want +got):\n%s", diff)
+				}
+				got, err := Parse(out)
+				checkErr(t, err)
+				if got != string(tc.gcode) {
+					t.Error("transcoded file does not match the reference G-code")
+				}
+			})
+		})
+	}
+}
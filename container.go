@@ -0,0 +1,102 @@
+package bgcodego
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic numbers of the containers recognized by WithContainerDetection.
+const (
+	gzipMagic = "\x1f\x8b"
+	zipMagic  = "PK\x03\x04"
+)
+
+// unwrapContainer returns the BGCode payload of r when r is a gzip stream or
+// a zip-based container, along with the size of the payload, or -1 when
+// unknown. Otherwise, it returns a reader yielding the same data as r, left
+// for the file header parser to validate.
+func unwrapContainer(r io.Reader) (payload io.Reader, wrapped bool, size int64, _ error) {
+	magic, r, err := peekMagic(r)
+	if err != nil {
+		return nil, false, 0, fmt.Errorf("cannot detect container: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte(gzipMagic)):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, false, 0, fmt.Errorf("cannot open gzip stream: %w", err)
+		}
+		return zr, true, -1, nil
+	case bytes.Equal(magic, []byte(zipMagic)):
+		ra, n, err := readerAt(r)
+		if err != nil {
+			return nil, false, 0, fmt.Errorf("cannot read archive: %w", err)
+		}
+		rc, size, err := openArchive(ra, n)
+		if err != nil {
+			return nil, false, 0, err
+		}
+		return rc, true, size, nil
+	}
+	return r, false, 0, nil
+}
+
+// peekMagic reads the first bytes of r, up to the length of the longest
+// magic number, and returns a reader yielding r from its start. Seekers are
+// rewound, other readers are buffered.
+func peekMagic(r io.Reader) ([]byte, io.Reader, error) {
+	if s, ok := r.(io.ReadSeeker); ok {
+		cur, err := s.Seek(0, io.SeekCurrent)
+		if err == nil {
+			magic := make([]byte, len(zipMagic))
+			n, err := io.ReadFull(s, magic)
+			if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, nil, err
+			}
+			if _, err := s.Seek(cur, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
+			return magic[:n], r, nil
+		}
+	}
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	magic, err := br.Peek(len(zipMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+	return magic, br, nil
+}
+
+// readerAt gives random access to r, which zip-based containers require,
+// reading r into memory unless it supports random access already.
+func readerAt(r io.Reader) (io.ReaderAt, int64, error) {
+	if ra, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		cur, err := ra.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, err
+		}
+		end, err := ra.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := ra.Seek(cur, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		return io.NewSectionReader(ra, cur, end-cur), end - cur, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
@@ -0,0 +1,73 @@
+package bgcodego
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestWithContainerDetection(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	want, err := Parse(bytes.NewReader(bgcode))
+	checkErr(t, err)
+
+	gz := &bytes.Buffer{}
+	gw := gzip.NewWriter(gz)
+	_, err = gw.Write(bgcode)
+	checkErr(t, err)
+	checkErr(t, gw.Close())
+
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+	w, err := zw.Create("Metadata/plate_1.bgcode")
+	checkErr(t, err)
+	_, err = w.Write(bgcode)
+	checkErr(t, err)
+	checkErr(t, zw.Close())
+
+	tests := []struct {
+		name  string
+		input io.Reader
+		total int64
+	}{
+		{"plain", bytes.NewReader(bgcode), int64(len(bgcode))},
+		{"plain stream", io.MultiReader(bytes.NewReader(bgcode)), -1},
+		{"gzip", bytes.NewReader(gz.Bytes()), -1},
+		{"gzip stream", io.MultiReader(bytes.NewReader(gz.Bytes())), -1},
+		{"zip", bytes.NewReader(archive.Bytes()), int64(len(bgcode))},
+		{"zip stream", io.MultiReader(bytes.NewReader(archive.Bytes())), int64(len(bgcode))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var last ProgressEvent
+			got, err := Parse(tt.input, WithContainerDetection(), WithProgress(func(ev ProgressEvent) { last = ev }))
+			checkErr(t, err)
+			if got != want {
+				t.Error("unexpected output")
+			}
+			if last.TotalBytes != tt.total || last.BytesRead != int64(len(bgcode)) {
+				t.Errorf("unexpected progress: %+v", last)
+			}
+		})
+	}
+
+	if _, err := Parse(bytes.NewReader(gz.Bytes())); err == nil {
+		t.Error("expected error without container detection")
+	}
+	empty := &bytes.Buffer{}
+	zw = zip.NewWriter(empty)
+	_, err = zw.Create("3D/3dmodel.model")
+	checkErr(t, err)
+	checkErr(t, zw.Close())
+	if _, err := Parse(bytes.NewReader(empty.Bytes()), WithContainerDetection()); !errors.Is(err, ErrNoBGCodeInArchive) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := Parse(bytes.NewReader([]byte("\x1f\x8bnot gzip")), WithContainerDetection()); err == nil {
+		t.Error("expected error on corrupted gzip stream")
+	}
+}
@@ -0,0 +1,77 @@
+package bgcodego
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// ConvertToGCode writes the input as ASCII G-code into w, whatever its
+// format, as reported by DetectReader: BGCode is converted as ParseTo does,
+// and ASCII G-code is copied as is, save for the commands the Klipper render
+// option comments out. With WithContainerDetection, the input is unwrapped
+// first. Inputs of unknown format fail with ErrUnknownFormat.
+func ConvertToGCode(w io.Writer, r io.Reader, opts ...DecodeOption) error {
+	o := newDecodeOptions(opts)
+	if o.DetectContainers {
+		var err error
+		if r, _, _, err = unwrapContainer(r); err != nil {
+			return err
+		}
+	}
+	br, format, err := detectFormat(r)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatBGCode:
+		return parseTo(w, br, o)
+	case FormatGCode:
+		if o.Render.Klipper {
+			kw := &klipperWriter{w: w}
+			if err := copyInput(kw, br); err != nil {
+				return err
+			}
+			return kw.flush()
+		}
+		return copyInput(w, br)
+	}
+	return ErrUnknownFormat
+}
+
+// ConvertToBGCode writes the input as BGCode into w, whatever its format, as
+// reported by DetectReader: ASCII G-code is converted as Transcode does, and
+// BGCode is copied as is, regardless of opts. Inputs of unknown format fail
+// with ErrUnknownFormat.
+func ConvertToBGCode(w io.Writer, r io.Reader, opts ...EncodeOption) error {
+	br, format, err := detectFormat(r)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatBGCode:
+		return copyInput(w, br)
+	case FormatGCode:
+		return Transcode(w, br, opts...)
+	}
+	return ErrUnknownFormat
+}
+
+func detectFormat(r io.Reader) (*bufio.Reader, Format, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok || br.Size() < sniffLen {
+		br = bufio.NewReader(r)
+	}
+	format, err := DetectReader(br)
+	if err != nil {
+		return nil, FormatUnknown, fmt.Errorf("cannot detect input format: %w", err)
+	}
+	return br, format, nil
+}
+
+func copyInput(w io.Writer, r io.Reader) error {
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("cannot copy input: %w", err)
+	}
+	return nil
+}
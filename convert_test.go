@@ -0,0 +1,73 @@
+package bgcodego
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestConvertToGCode(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	gcode, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	gz := &bytes.Buffer{}
+	gw := gzip.NewWriter(gz)
+	_, err = gw.Write(bgcode)
+	checkErr(t, err)
+	checkErr(t, gw.Close())
+
+	tests := []struct {
+		name  string
+		input []byte
+		opts  []DecodeOption
+	}{
+		{"bgcode", bgcode, nil},
+		{"gcode", gcode, nil},
+		{"gzip", gz.Bytes(), []DecodeOption{WithContainerDetection()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			checkErr(t, ConvertToGCode(out, bytes.NewReader(tt.input), tt.opts...))
+			if !bytes.Equal(out.Bytes(), gcode) {
+				t.Error("unexpected output")
+			}
+		})
+	}
+	out := &bytes.Buffer{}
+	checkErr(t, ConvertToGCode(out, bytes.NewReader(gcode), WithRenderOptions(WithKlipper())))
+	if want := bytes.Replace(gcode, []byte("\nM862.3"), []byte("\n; M862.3"), 1); !bytes.Equal(out.Bytes(), want) {
+		t.Error("ASCII G-code not adapted to Klipper")
+	}
+	if err := ConvertToGCode(&bytes.Buffer{}, bytes.NewReader(gz.Bytes())); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConvertToBGCode(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	gcode, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+
+	out := &bytes.Buffer{}
+	checkErr(t, ConvertToBGCode(out, bytes.NewReader(bgcode)))
+	if !bytes.Equal(out.Bytes(), bgcode) {
+		t.Error("BGCode not passed through")
+	}
+
+	out.Reset()
+	checkErr(t, ConvertToBGCode(out, bytes.NewReader(gcode), WithGCodeEncoding(GCodeEncodingMeatpackWithComments)))
+	got, err := Parse(out)
+	checkErr(t, err)
+	if got != string(gcode) {
+		t.Error("unexpected round trip output")
+	}
+
+	if err := ConvertToBGCode(&bytes.Buffer{}, bytes.NewReader([]byte("\x89PNG\r\n\x1a\n"))); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
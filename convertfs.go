@@ -0,0 +1,122 @@
+package bgcodego
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ConvertResult reports the conversion of a single file by ConvertFS.
+type ConvertResult struct {
+	Path   string // Path of the input within the file system
+	Output string // Path of the G-code file written, empty on failure
+	Err    error
+}
+
+// ConvertFS converts into G-code every file of fsys whose base name matches
+// pattern, as reported by path.Match, walking subdirectories as well. Each
+// file is written under outDir at the same relative path, with its extension
+// replaced by ".gcode". Files are converted concurrently. Files that would
+// be written to the same output, such as a.bgcode and a.bgc, fail instead.
+//
+// One result is returned per matching file, in lexical order. The error
+// joins the failures of every file, and is also returned, alone, when
+// pattern is malformed or fsys cannot be walked. Partial outputs of failed
+// conversions are removed.
+func ConvertFS(fsys fs.FS, pattern, outDir string, opts ...DecodeOption) ([]ConvertResult, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var results []ConvertResult
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if ok, _ := path.Match(pattern, d.Name()); ok {
+			results = append(results, ConvertResult{Path: name})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot walk file system: %w", err)
+	}
+
+	// Inputs that differ only by extension or by case would be written
+	// to the same output, which none of them gets.
+	outputs := make([]string, len(results))
+	inputs := make(map[string][]string)
+	for i, res := range results {
+		outputs[i] = filepath.Join(outDir, filepath.FromSlash(strings.TrimSuffix(res.Path, path.Ext(res.Path))+".gcode"))
+		key := strings.ToLower(outputs[i])
+		inputs[key] = append(inputs[key], res.Path)
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i := range results {
+		if same := inputs[strings.ToLower(outputs[i])]; len(same) > 1 {
+			results[i].Err = fmt.Errorf("output %s is shared by %s", outputs[i], strings.Join(same, ", "))
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(res *ConvertResult, output string) {
+			defer func() { <-sem; wg.Done() }()
+			if res.Err = convertFSFile(fsys, res.Path, output, opts); res.Err == nil {
+				res.Output = output
+			}
+		}(&results[i], outputs[i])
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.Path, res.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+func convertFSFile(fsys fs.FS, name, output string, opts []DecodeOption) error {
+	in, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(out)
+	if _, ok := in.(io.ReadSeeker); ok {
+		err = parseTo(bw, in, newDecodeOptions(opts))
+	} else {
+		// Without seeking, blocks out of order can only be taken by
+		// decoding the whole file first.
+		err = parseBuffered(bw, in, newDecodeOptions(opts))
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+	}
+	return err
+}
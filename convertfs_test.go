@@ -0,0 +1,100 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestConvertFS(t *testing.T) {
+	data, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	want, err := Parse(bytes.NewReader(data))
+	checkErr(t, err)
+	fsys := fstest.MapFS{
+		"a.bgcode":              {Data: data},
+		"sub/dir/b.bgcode":      {Data: data},
+		"sub/broken.bgcode":     {Data: data[:len(data)-10]},
+		"notes.txt":             {Data: []byte("not converted")},
+		"sub/dir/c.bgcode.orig": {Data: data},
+	}
+	outDir := t.TempDir()
+	results, err := ConvertFS(fsys, "*.bgcode", outDir)
+	if err == nil {
+		t.Fatal("ConvertFS() succeeded with a broken file")
+	}
+	wantResults := []ConvertResult{
+		{Path: "a.bgcode", Output: filepath.Join(outDir, "a.gcode")},
+		{Path: "sub/broken.bgcode"},
+		{Path: "sub/dir/b.bgcode", Output: filepath.Join(outDir, "sub", "dir", "b.gcode")},
+	}
+	if diff := cmp.Diff(wantResults, results, cmpopts.IgnoreFields(ConvertResult{}, "Err")); diff != "" {
+		t.Errorf("ConvertFS() mismatch (-want +got):\n%s", diff)
+	}
+	if results[1].Err == nil || !errors.Is(err, results[1].Err) {
+		t.Errorf("broken file error = %v, joined error = %v", results[1].Err, err)
+	}
+	for _, res := range results {
+		if res.Err != nil {
+			continue
+		}
+		got, err := os.ReadFile(res.Output)
+		checkErr(t, err)
+		if string(got) != want {
+			t.Errorf("unexpected output in %s", res.Output)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "sub", "broken.gcode")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial output left behind: %v", err)
+	}
+	if _, err := ConvertFS(fsys, "[", outDir); err == nil {
+		t.Error("ConvertFS() accepted a malformed pattern")
+	}
+}
+
+func TestConvertFS_sharedOutput(t *testing.T) {
+	data, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	fsys := fstest.MapFS{
+		"a.bgcode": {Data: data},
+		"a.bgc":    {Data: data},
+		"B.bgcode": {Data: data},
+		"b.bgcode": {Data: data},
+		"c.bgcode": {Data: data},
+	}
+	outDir := t.TempDir()
+	results, err := ConvertFS(fsys, "*.bgc*", outDir)
+	if err == nil {
+		t.Fatal("ConvertFS() succeeded with shared outputs")
+	}
+	for _, res := range results {
+		if shared := res.Path != "c.bgcode"; shared != (res.Err != nil) || shared != (res.Output == "") {
+			t.Errorf("unexpected result for %s: %+v", res.Path, res)
+		}
+	}
+	entries, err := os.ReadDir(outDir)
+	checkErr(t, err)
+	if len(entries) != 1 || entries[0].Name() != "c.gcode" {
+		t.Errorf("unexpected outputs: %v", entries)
+	}
+}
+
+func TestConvertFS_lateBlock(t *testing.T) {
+	data := lateBlockFixture(t)
+	want, err := Parse(bytes.NewReader(data))
+	checkErr(t, err)
+	outDir := t.TempDir()
+	results, err := ConvertFS(fstest.MapFS{"late.bgcode": {Data: data}}, "*.bgcode", outDir)
+	checkErr(t, err)
+	got, err := os.ReadFile(results[0].Output)
+	checkErr(t, err)
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("ConvertFS() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,56 @@
+package bgcodego
+
+import (
+	"io"
+	"strings"
+)
+
+// Decoder decodes BGCode inputs with decoding options set once, such as
+// limits and checksum policies. It is safe for concurrent use, provided the
+// Progress callback, if any, is. Block types, checksums and compression
+// algorithms are registered globally with RegisterBlockType, RegisterChecksum
+// and RegisterCompression.
+type Decoder struct {
+	o DecodeOptions
+}
+
+// NewDecoder returns a Decoder applying opts to every input.
+func NewDecoder(opts ...DecodeOption) *Decoder {
+	return &Decoder{o: *newDecodeOptions(opts)}
+}
+
+// options returns a copy of the decoding options, which decoding functions
+// are free to adjust.
+func (d *Decoder) options() *DecodeOptions {
+	o := d.o
+	return &o
+}
+
+// Decode is like the package-level Decode.
+func (d *Decoder) Decode(r io.Reader) (*File, error) {
+	return decode(r, d.options())
+}
+
+// Parse is like the package-level Parse.
+func (d *Decoder) Parse(r io.Reader) (string, error) {
+	out := &strings.Builder{}
+	if err := parseBuffered(out, r, d.options()); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// ParseTo is like the package-level ParseTo.
+func (d *Decoder) ParseTo(w io.Writer, r io.Reader) error {
+	return parseTo(w, r, d.options())
+}
+
+// DecodeMetadata is like the package-level DecodeMetadata.
+func (d *Decoder) DecodeMetadata(r io.Reader) (*Metadata, error) {
+	return decodeMetadata(r, d.options())
+}
+
+// ParseSplit is like the package-level ParseSplit.
+func (d *Decoder) ParseSplit(gcode, metadata io.Writer, r io.Reader) error {
+	return parseSplit(gcode, metadata, r, d.options())
+}
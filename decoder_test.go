@@ -0,0 +1,49 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	want, err := Parse(bytes.NewReader(bgcode), WithStripComments())
+	checkErr(t, err)
+
+	d := NewDecoder(WithStripComments())
+	errs := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			f, err := d.Decode(bytes.NewReader(bgcode))
+			if err == nil && f.Render() != want {
+				err = errors.New("unexpected Decode output")
+			}
+			if err == nil {
+				var got string
+				got, err = d.Parse(bytes.NewReader(bgcode))
+				if err == nil && got != want {
+					err = errors.New("unexpected Parse output")
+				}
+			}
+			if err == nil {
+				var m *Metadata
+				m, err = d.DecodeMetadata(bytes.NewReader(bgcode))
+				if err == nil && m.PrinterModel() != "MINI" {
+					err = errors.New("unexpected metadata")
+				}
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		checkErr(t, <-errs)
+	}
+
+	limited := NewDecoder(WithMaxBlocks(2))
+	if _, err := limited.Decode(bytes.NewReader(bgcode)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package bgcodego
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// ErrUnknownFormat is returned when an input is neither BGCode nor ASCII
+// G-code.
+var ErrUnknownFormat = errors.New("unknown input format")
+
+// Format is the format of an input, as reported by Detect.
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatBGCode         // Binary G-code, starting with the "GCDE" magic number
+	FormatGCode          // ASCII G-code
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatBGCode:
+		return "BGCode"
+	case FormatGCode:
+		return "GCode"
+	}
+	return "Unknown"
+}
+
+// sniffLen is the number of bytes Detect looks at.
+const sniffLen = 512
+
+// Detect reports the format of the input held in r, from its first bytes.
+// BGCode is recognized by its magic number, regardless of its validity.
+// ASCII G-code is recognized as text made of comments, commands and macros,
+// with at least one comment or G, M or T command. Empty inputs are of
+// unknown format.
+func Detect(r io.ReaderAt) (Format, error) {
+	head := make([]byte, sniffLen)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return FormatUnknown, err
+	}
+	return detect(head[:n], n < sniffLen), nil
+}
+
+// DetectReader is like Detect, but peeks at the first bytes of br, which
+// are left to be read.
+func DetectReader(br *bufio.Reader) (Format, error) {
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return FormatUnknown, err
+	}
+	return detect(head, len(head) < sniffLen), nil
+}
+
+// IsBGCode reports whether the input held in r starts with the BGCode magic
+// number.
+func IsBGCode(r io.ReaderAt) bool {
+	f, err := Detect(r)
+	return err == nil && f == FormatBGCode
+}
+
+// detect reports the format of an input starting with head, which is the
+// whole input when complete is set.
+func detect(head []byte, complete bool) Format {
+	if bytes.HasPrefix(head, []byte("GCDE")) {
+		return FormatBGCode
+	}
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	lines := bytes.Split(head, []byte("\n"))
+	if !complete {
+		// The last line may be cut short, along with its last rune.
+		lines = lines[:len(lines)-1]
+	}
+	gcode := false
+	for _, line := range lines {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !utf8.Valid(line) || bytes.IndexByte(line, 0) >= 0 {
+			return FormatUnknown
+		}
+		switch c := line[0]; {
+		case c == ';':
+			gcode = true
+		case isCommand(line):
+			gcode = true
+		case (c < 'A' || c > 'Z') && (c < 'a' || c > 'z'):
+			// Neither a comment nor a command, nor a macro, such as
+			// Klipper's EXCLUDE_OBJECT_DEFINE.
+			return FormatUnknown
+		}
+	}
+	if !gcode {
+		return FormatUnknown
+	}
+	return FormatGCode
+}
+
+// isCommand reports whether a line starts with a G, M or T command, possibly
+// preceded by a line number, as in "N10 G28".
+func isCommand(line []byte) bool {
+	if line[0] == 'N' || line[0] == 'n' {
+		i := bytes.IndexByte(line, ' ')
+		if i < 0 {
+			return false
+		}
+		line = bytes.TrimSpace(line[i:])
+	}
+	if len(line) < 2 {
+		return false
+	}
+	switch line[0] {
+	case 'G', 'M', 'T', 'g', 'm', 't':
+		return line[1] >= '0' && line[1] <= '9'
+	}
+	return false
+}
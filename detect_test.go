@@ -0,0 +1,71 @@
+package bgcodego
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	gcode, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	tests := []struct {
+		name  string
+		input string
+		want  Format
+	}{
+		{"bgcode", string(bgcode), FormatBGCode},
+		{"bgcode header only", "GCDE", FormatBGCode},
+		{"prusaslicer", string(gcode), FormatGCode},
+		{"commands", "G28\nG1 X10 Y10\n", FormatGCode},
+		{"line numbers", "N10 G28*18\nN11 M104 S200*99\n", FormatGCode},
+		{"crlf and bom", "\xef\xbb\xbf; sliced\r\nM107\r\n", FormatGCode},
+		{"klipper macros", "EXCLUDE_OBJECT_DEFINE NAME=cube\nPRINT_START\nG1 X1\n", FormatGCode},
+		{"long comment", "; " + strings.Repeat("x", 1000), FormatUnknown},
+		{"empty", "", FormatUnknown},
+		{"macros only", "PRINT_START\nPRINT_END\n", FormatUnknown},
+		{"png", "\x89PNG\r\n\x1a\n", FormatUnknown},
+		{"gzip", "\x1f\x8b\x08\x00", FormatUnknown},
+		{"zip", "PK\x03\x04", FormatUnknown},
+		{"json", `{"gcode": "G28"}` + "\n", FormatUnknown},
+		{"binary", "G28\n\x00\x01\x02\n", FormatUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(strings.NewReader(tt.input))
+			checkErr(t, err)
+			if got != tt.want {
+				t.Errorf("Detect() = %v, want %v", got, tt.want)
+			}
+			br := bufio.NewReader(strings.NewReader(tt.input))
+			got, err = DetectReader(br)
+			checkErr(t, err)
+			if got != tt.want {
+				t.Errorf("DetectReader() = %v, want %v", got, tt.want)
+			}
+			if rest := br.Buffered(); rest != min(len(tt.input), br.Size()) && len(tt.input) > 0 {
+				t.Errorf("DetectReader() consumed input: %d bytes left buffered", rest)
+			}
+			if got := IsBGCode(strings.NewReader(tt.input)); got != (tt.want == FormatBGCode) {
+				t.Errorf("IsBGCode() = %v", got)
+			}
+		})
+	}
+}
+
+func TestDetectReader_parse(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	br := bufio.NewReader(bytes.NewReader(bgcode))
+	format, err := DetectReader(br)
+	checkErr(t, err)
+	if format != FormatBGCode {
+		t.Fatalf("unexpected format: %v", format)
+	}
+	_, err = Parse(br)
+	checkErr(t, err)
+}
@@ -0,0 +1,219 @@
+package bgcodego
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"slices"
+	"strings"
+)
+
+// DiffReport lists the differences between two BGCode files, A and B, as
+// found by Diff.
+type DiffReport struct {
+	Metadata   []MetadataDiff
+	Thumbnails []ThumbnailDiff
+	GCode      []LineEdit
+}
+
+// Equal reports whether no differences were found.
+func (d *DiffReport) Equal() bool {
+	return len(d.Metadata) == 0 && len(d.Thumbnails) == 0 && len(d.GCode) == 0
+}
+
+// MetadataDiff describes a metadata key whose values differ between A and B.
+type MetadataDiff struct {
+	Section string // "file", "printer", "print" or "slicer"
+	Key     string
+	A, B    []string // Values of the key, empty when missing
+}
+
+// ThumbnailDiff describes a thumbnail, identified by its format and size,
+// whose image differs between A and B.
+type ThumbnailDiff struct {
+	ThumbnailInfo
+	A, B string // Hex-encoded SHA-256 of the image, empty when missing
+}
+
+// LineEdit is a line of G-code removed from A or inserted in B.
+type LineEdit struct {
+	Insert bool // The line is inserted in B, rather than removed from A
+	Line   int  // Zero-based line number in A for removals, in B for insertions
+	Text   string
+}
+
+// Diff decodes the BGCode inputs a and b and compares their metadata, their
+// thumbnails and, line by line, their G-code.
+func Diff(a, b io.Reader, opts ...DecodeOption) (*DiffReport, error) {
+	fa, err := Decode(a, opts...)
+	if err != nil {
+		return nil, err
+	}
+	fb, err := Decode(b, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ma, mb := fa.Metadata(), fb.Metadata()
+	d := &DiffReport{}
+	for _, s := range []struct {
+		name string
+		a, b KeyValues
+	}{
+		{"file", ma.File, mb.File},
+		{"printer", ma.Printer, mb.Printer},
+		{"print", ma.Print, mb.Print},
+		{"slicer", ma.Slicer, mb.Slicer},
+	} {
+		d.Metadata = append(d.Metadata, diffKeyValues(s.name, s.a, s.b)...)
+	}
+	d.Thumbnails = diffThumbnails(fa.Thumbnails, fb.Thumbnails)
+	d.GCode = diffLines(splitGCode(fa), splitGCode(fb))
+	return d, nil
+}
+
+func diffKeyValues(section string, a, b KeyValues) []MetadataDiff {
+	var (
+		diffs []MetadataDiff
+		seen  = make(map[string]bool)
+	)
+	for _, kv := range append(slices.Clone(a), b...) {
+		if seen[kv.Key] {
+			continue
+		}
+		seen[kv.Key] = true
+		if va, vb := a.All(kv.Key), b.All(kv.Key); !slices.Equal(va, vb) {
+			diffs = append(diffs, MetadataDiff{Section: section, Key: kv.Key, A: va, B: vb})
+		}
+	}
+	return diffs
+}
+
+func diffThumbnails(a, b []*BlockThumbnail) []ThumbnailDiff {
+	var diffs []ThumbnailDiff
+	hashes := func(thumbnails []*BlockThumbnail) map[ThumbnailInfo]string {
+		m := make(map[ThumbnailInfo]string)
+		for _, bt := range thumbnails {
+			sum := sha256.Sum256(bt.Body)
+			m[ThumbnailInfo{Format: bt.Format(), Width: bt.Width(), Height: bt.Height()}] = hex.EncodeToString(sum[:])
+		}
+		return m
+	}
+	ha, hb := hashes(a), hashes(b)
+	for _, bt := range append(slices.Clone(a), b...) {
+		ti := ThumbnailInfo{Format: bt.Format(), Width: bt.Width(), Height: bt.Height()}
+		if slices.ContainsFunc(diffs, func(d ThumbnailDiff) bool { return d.ThumbnailInfo == ti }) {
+			continue
+		}
+		if ha[ti] != hb[ti] {
+			diffs = append(diffs, ThumbnailDiff{ThumbnailInfo: ti, A: ha[ti], B: hb[ti]})
+		}
+	}
+	return diffs
+}
+
+// splitGCode splits the G-code of all blocks into lines, without their line
+// endings.
+func splitGCode(f *File) []string {
+	gcode := &strings.Builder{}
+	f.writeGCode(gcode)
+	if gcode.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(gcode.String(), "\n"), "\n")
+}
+
+// diffLines finds the shortest sequence of line removals from a and
+// insertions in b that turns a into b, according to the algorithm of Eugene
+// W. Myers, "An O(ND) Difference Algorithm and Its Variations". The linear
+// space refinement of the paper is used, so that memory does not grow with
+// the number of edits squared.
+func diffLines(a, b []string) []LineEdit {
+	size := 2*((len(a)+len(b)+1)/2+1) + 1
+	ld := &lineDiff{a: a, b: b, vf: make([]int, size), vb: make([]int, size)}
+	ld.compare(0, len(a), 0, len(b))
+	return ld.edits
+}
+
+type lineDiff struct {
+	a, b []string
+	// vf[k] and vb[k] hold the furthest x reached on diagonal k = x - y,
+	// searching forward from the start and backward from the end of the
+	// lines being compared. They are reused across calls to middleSnake.
+	vf, vb []int
+	edits  []LineEdit
+}
+
+// compare appends the edits that turn a[a0:a1] into b[b0:b1].
+func (ld *lineDiff) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && ld.a[a0] == ld.b[b0] {
+		a0, b0 = a0+1, b0+1
+	}
+	for a0 < a1 && b0 < b1 && ld.a[a1-1] == ld.b[b1-1] {
+		a1, b1 = a1-1, b1-1
+	}
+	switch {
+	case a0 == a1:
+		for y := b0; y < b1; y++ {
+			ld.edits = append(ld.edits, LineEdit{Insert: true, Line: y, Text: ld.b[y]})
+		}
+	case b0 == b1:
+		for x := a0; x < a1; x++ {
+			ld.edits = append(ld.edits, LineEdit{Line: x, Text: ld.a[x]})
+		}
+	default:
+		// With no common first nor last line, at least 2 edits are
+		// needed, so that both halves are smaller problems.
+		x, y, u, v := ld.middleSnake(a0, a1, b0, b1)
+		ld.compare(a0, a0+x, b0, b0+y)
+		ld.compare(a0+u, a1, b0+v, b1)
+	}
+}
+
+// middleSnake finds the diagonal run of common lines, from (x, y) to (u, v)
+// relative to (a0, b0), in the middle of a shortest edit path that turns
+// a[a0:a1] into b[b0:b1].
+func (ld *lineDiff) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	off := (n+m+1)/2 + 1
+	vf, vb := ld.vf, ld.vb
+	vf[off+1], vb[off+1] = 0, 0
+	for d := 0; d <= (n+m+1)/2; d++ {
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && ld.a[a0+u] == ld.b[b0+v] {
+				u, v = u+1, v+1
+			}
+			vf[off+k] = u
+			// Backward diagonals are numbered from the end: k' = delta - k.
+			if kb := delta - k; odd && kb >= -(d-1) && kb <= d-1 && u+vb[off+kb] >= n {
+				return x, y, u, v
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var xb int
+			if k == -d || (k != d && vb[off+k-1] < vb[off+k+1]) {
+				xb = vb[off+k+1]
+			} else {
+				xb = vb[off+k-1] + 1
+			}
+			yb := xb - k
+			ub, wb := xb, yb
+			for ub < n && wb < m && ld.a[a1-1-ub] == ld.b[b1-1-wb] {
+				ub, wb = ub+1, wb+1
+			}
+			vb[off+k] = ub
+			if kf := delta - k; !odd && kf >= -d && kf <= d && ub+vf[off+kf] >= n {
+				return n - ub, m - wb, n - xb, m - yb
+			}
+		}
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,156 @@
+package bgcodego
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []LineEdit
+	}{
+		{"", "", nil},
+		{"a b c", "a b c", nil},
+		{"a b c", "a c", []LineEdit{{Line: 1, Text: "b"}}},
+		{"a c", "a b c", []LineEdit{{Insert: true, Line: 1, Text: "b"}}},
+		{"x", "", []LineEdit{{Line: 0, Text: "x"}}},
+		{"a b c", "a x c", []LineEdit{{Line: 1, Text: "b"}, {Insert: true, Line: 1, Text: "x"}}},
+	}
+	for _, tt := range tests {
+		got := diffLines(strings.Fields(tt.a), strings.Fields(tt.b))
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("diffLines(%q, %q) mismatch (-want +got):\n%s", tt.a, tt.b, diff)
+		}
+	}
+
+	// The example of Myers' paper takes 5 edits.
+	a, b := strings.Fields("a b c a b b a"), strings.Fields("c b a b a c")
+	edits := diffLines(a, b)
+	if len(edits) != 5 {
+		t.Errorf("expected 5 edits, got %v", edits)
+	}
+	if diff := cmp.Diff(b, applyEdits(a, edits)); diff != "" {
+		t.Errorf("edits do not turn a into b (-want +got):\n%s", diff)
+	}
+
+	// Random inputs over a small alphabet take as few edits as their
+	// longest common subsequence allows.
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(20))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(3)))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		edits := diffLines(a, b)
+		if want := len(a) + len(b) - 2*lcsLen(a, b); len(edits) != want {
+			t.Fatalf("diffLines(%q, %q) = %d edits, want %d", a, b, len(edits), want)
+		}
+		if diff := cmp.Diff(b, applyEdits(a, edits), cmpopts.EquateEmpty()); diff != "" {
+			t.Fatalf("edits do not turn %q into %q (-want +got):\n%s", a, b, diff)
+		}
+	}
+}
+
+func applyEdits(a []string, edits []LineEdit) []string {
+	var patched []string
+	i := 0
+	for _, e := range edits {
+		for e.Insert && len(patched) < e.Line || !e.Insert && i < e.Line {
+			patched, i = append(patched, a[i]), i+1
+		}
+		if e.Insert {
+			patched = append(patched, e.Text)
+		} else {
+			i++
+		}
+	}
+	return append(patched, a[i:]...)
+}
+
+func lcsLen(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestDiff(t *testing.T) {
+	input, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	same, err := Diff(bytes.NewReader(input), bytes.NewReader(input))
+	checkErr(t, err)
+	if !same.Equal() {
+		t.Errorf("unexpected differences: %+v", same)
+	}
+
+	var edited bytes.Buffer
+	gcodes := 0
+	err = Rewrite(&edited, bytes.NewReader(input), func(b *Block) error {
+		switch b.Header.Type() {
+		case BlockHeaderTypePrinterMetadata:
+			block, err := b.Decode()
+			if err != nil {
+				return err
+			}
+			bprm := block.(*BlockPrinterMetadata)
+			bprm.Values.Set("printer_model", "MK4S")
+			bprm.Values.Append("extra", "1")
+			b.Replace(bprm)
+		case BlockHeaderTypeGCode:
+			if gcodes++; gcodes != 2 {
+				return nil
+			}
+			block, err := b.Decode()
+			if err != nil {
+				return err
+			}
+			bg := block.(*BlockGCode)
+			bg.Body = strings.Replace(bg.Body, "\n", "\nM117 hello\n", 1)
+			b.Replace(bg)
+		}
+		return nil
+	})
+	checkErr(t, err)
+	thumbnail, err := NewThumbnail(image.NewGray(image.Rect(0, 0, 1, 1)), BlockThumbnailFormatPNG, 16, 16)
+	checkErr(t, err)
+	var stamped bytes.Buffer
+	checkErr(t, InjectThumbnails(&stamped, &edited, thumbnail))
+
+	got, err := Diff(bytes.NewReader(input), &stamped)
+	checkErr(t, err)
+	want := decodeFixture(t)
+	if diff := cmp.Diff([]MetadataDiff{
+		{Section: "printer", Key: "printer_model", A: []string{want.PrinterMetadata.Values.First("printer_model")}, B: []string{"MK4S"}},
+		{Section: "printer", Key: "extra", B: []string{"1"}},
+	}, got.Metadata); diff != "" {
+		t.Errorf("unexpected metadata differences (-want +got):\n%s", diff)
+	}
+	if len(got.Thumbnails) != 1 || got.Thumbnails[0].ThumbnailInfo != (ThumbnailInfo{BlockThumbnailFormatPNG, 16, 16}) || got.Thumbnails[0].A == got.Thumbnails[0].B {
+		t.Errorf("unexpected thumbnail differences: %+v", got.Thumbnails)
+	}
+	if len(got.GCode) != 1 || !got.GCode[0].Insert || got.GCode[0].Text != "M117 hello" {
+		t.Errorf("unexpected G-code differences: %+v", got.GCode)
+	}
+}
@@ -0,0 +1,433 @@
+package bgcodego
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"strings"
+)
+
+// ErrUnsupportedEncoding is returned when a block uses an encoding this
+// package cannot decode, or when asked to write a block in an encoding this
+// package cannot produce.
+var ErrUnsupportedEncoding = errors.New("non-supported encoding")
+
+// EncodeOptions controls how a BGCode output is produced.
+type EncodeOptions struct {
+	// MetadataEncoding is the encoding used for the key-value tables of
+	// metadata blocks. Only BlockEncodingINI is supported for writing.
+	MetadataEncoding BlockEncoding
+
+	// LineEnding is the line terminator G-code is normalized to before
+	// being stored, so that inputs produced on different platforms encode
+	// identically. Defaults to LineEndingLF.
+	LineEnding LineEnding
+
+	// ChecksumType is the checksum appended to every block. Defaults to
+	// ChecksumTypeCRC32.
+	ChecksumType ChecksumType
+
+	// Compression is the compression applied to metadata and G-code
+	// blocks of types missing from BlockCompression. Thumbnails are always
+	// stored uncompressed, as their image formats are compressed already.
+	// Defaults to no compression.
+	Compression BlockHeaderCompression
+
+	// BlockCompression overrides Compression by block type. Defaults to
+	// the choices of PrusaSlicer and libbgcode: slicer metadata compressed
+	// with BlockHeaderCompressionDeflate and G-code with
+	// BlockHeaderCompressionHeatshrink124, which Prusa firmware expects.
+	BlockCompression map[BlockHeaderType]BlockHeaderCompression
+
+	// GCodeEncoding is the encoding of G-code blocks. Defaults to
+	// GCodeEncodingNone.
+	GCodeEncoding GCodeEncoding
+
+	// CompressionLevel is the level of BlockHeaderCompressionDeflate, from
+	// zlib.HuffmanOnly to zlib.BestCompression. Defaults to
+	// zlib.DefaultCompression. Blocks are framed as zlib streams without
+	// a preset dictionary, as libbgcode expects.
+	CompressionLevel int
+}
+
+// LineEnding selects the line terminator used for G-code.
+type LineEnding string
+
+const (
+	LineEndingLF   LineEnding = "\n"
+	LineEndingCRLF LineEnding = "\r\n"
+)
+
+func (le LineEnding) normalize(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if le == LineEndingCRLF {
+		s = strings.ReplaceAll(s, "\n", "\r\n")
+	}
+	return s
+}
+
+// EncodeOption configures the production of a BGCode output.
+type EncodeOption func(*EncodeOptions)
+
+// WithMetadataEncoding selects the encoding of metadata blocks.
+func WithMetadataEncoding(encoding BlockEncoding) EncodeOption {
+	return func(o *EncodeOptions) {
+		o.MetadataEncoding = encoding
+	}
+}
+
+// WithLineEnding selects the line terminator G-code is normalized to.
+func WithLineEnding(le LineEnding) EncodeOption {
+	return func(o *EncodeOptions) {
+		o.LineEnding = le
+	}
+}
+
+// WithChecksumType selects the checksum appended to every block.
+func WithChecksumType(ct ChecksumType) EncodeOption {
+	return func(o *EncodeOptions) {
+		o.ChecksumType = ct
+	}
+}
+
+// WithCompression selects the compression of all metadata and G-code
+// blocks, discarding the choices made by type, either by default or by
+// earlier WithBlockCompression options.
+func WithCompression(c BlockHeaderCompression) EncodeOption {
+	return func(o *EncodeOptions) {
+		o.Compression = c
+		o.BlockCompression = nil
+	}
+}
+
+// WithBlockCompression selects the compression of blocks of the given type.
+func WithBlockCompression(bht BlockHeaderType, c BlockHeaderCompression) EncodeOption {
+	return func(o *EncodeOptions) {
+		o.BlockCompression = maps.Clone(o.BlockCompression)
+		if o.BlockCompression == nil {
+			o.BlockCompression = make(map[BlockHeaderType]BlockHeaderCompression)
+		}
+		o.BlockCompression[bht] = c
+	}
+}
+
+// compression returns the compression of blocks of the given type.
+func (o *EncodeOptions) compression(bht BlockHeaderType) BlockHeaderCompression {
+	if c, ok := o.BlockCompression[bht]; ok {
+		return c
+	}
+	return o.Compression
+}
+
+// WithCompressionLevel selects the level of Deflate compression.
+func WithCompressionLevel(level int) EncodeOption {
+	return func(o *EncodeOptions) {
+		o.CompressionLevel = level
+	}
+}
+
+// WithGCodeEncoding selects the encoding of G-code blocks.
+func WithGCodeEncoding(encoding GCodeEncoding) EncodeOption {
+	return func(o *EncodeOptions) {
+		o.GCodeEncoding = encoding
+	}
+}
+
+func newEncodeOptions(opts []EncodeOption) (*EncodeOptions, error) {
+	o := &EncodeOptions{
+		MetadataEncoding: BlockEncodingINI,
+		LineEnding:       LineEndingLF,
+		ChecksumType:     ChecksumTypeCRC32,
+		Compression:      BlockHeaderCompressionNone,
+		GCodeEncoding:    GCodeEncodingNone,
+		CompressionLevel: zlib.DefaultCompression,
+		BlockCompression: map[BlockHeaderType]BlockHeaderCompression{
+			BlockHeaderTypeSlicerMetadata: BlockHeaderCompressionDeflate,
+			BlockHeaderTypeGCode:          BlockHeaderCompressionHeatshrink124,
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.MetadataEncoding != BlockEncodingINI {
+		return nil, fmt.Errorf("%w: cannot write metadata with encoding %d", ErrUnsupportedEncoding, o.MetadataEncoding)
+	}
+	if o.LineEnding != LineEndingLF && o.LineEnding != LineEndingCRLF {
+		return nil, fmt.Errorf("non-supported line ending: %q", o.LineEnding)
+	}
+	if o.GCodeEncoding > GCodeEncodingMeatpackWithComments {
+		return nil, fmt.Errorf("%w: cannot write G-code with encoding %d", ErrUnsupportedEncoding, o.GCodeEncoding)
+	}
+	if !o.ChecksumType.IsValid() {
+		return nil, &UnsupportedChecksumError{Type: o.ChecksumType}
+	}
+	if o.CompressionLevel < zlib.HuffmanOnly || o.CompressionLevel > zlib.BestCompression {
+		return nil, fmt.Errorf("invalid compression level: %d", o.CompressionLevel)
+	}
+	if err := checkWriteCompression(o.Compression); err != nil {
+		return nil, fmt.Errorf("cannot write blocks: %w", err)
+	}
+	for bht, c := range o.BlockCompression {
+		if bht == BlockHeaderTypeThumbnail && c != BlockHeaderCompressionNone {
+			return nil, errors.New("cannot write compressed thumbnail blocks")
+		}
+		if err := checkWriteCompression(c); err != nil {
+			return nil, fmt.Errorf("cannot write %v blocks: %w", bht, err)
+		}
+	}
+	return o, nil
+}
+
+func checkWriteCompression(bhc BlockHeaderCompression) error {
+	if c, ok := lookupCompression(bhc); bhc != BlockHeaderCompressionNone && (!ok || c.NewWriter == nil) {
+		return &UnsupportedCompressionError{Compression: bhc}
+	}
+	return nil
+}
+
+// Writer produces BGCode output block by block. Blocks should be written in
+// the order mandated by the specification: file metadata, printer metadata,
+// thumbnails, print metadata, slicer metadata and G-code.
+type Writer struct {
+	w           io.Writer
+	opts        *EncodeOptions
+	wroteHeader bool
+	err         error
+}
+
+// NewWriter creates a Writer that emits BGCode into w. The file header is
+// written along with the first block.
+func NewWriter(w io.Writer, opts ...EncodeOption) (*Writer, error) {
+	o, err := newEncodeOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, opts: o}, nil
+}
+
+// Encode writes the structured representation of a file as BGCode, with the
+// blocks in the order mandated by the specification.
+func Encode(w io.Writer, f *File, opts ...EncodeOption) error {
+	bw, err := NewWriter(w, opts...)
+	if err != nil {
+		return err
+	}
+	if f.FileMetadata != nil {
+		if err := bw.WriteFileMetadata(f.FileMetadata.Values); err != nil {
+			return err
+		}
+	}
+	if f.PrinterMetadata != nil {
+		if err := bw.WritePrinterMetadata(f.PrinterMetadata.Values); err != nil {
+			return err
+		}
+	}
+	for _, thumbnail := range f.Thumbnails {
+		if err := bw.WriteThumbnail(thumbnail.Format(), thumbnail.Width(), thumbnail.Height(), thumbnail.Body); err != nil {
+			return err
+		}
+	}
+	if f.PrintMetadata != nil {
+		if err := bw.WritePrintMetadata(f.PrintMetadata.Values); err != nil {
+			return err
+		}
+	}
+	if f.SlicerMetadata != nil {
+		if err := bw.WriteSlicerMetadata(f.SlicerMetadata.Values); err != nil {
+			return err
+		}
+	}
+	for _, gcode := range f.GCode {
+		if err := bw.WriteGCode(gcode.Body); err != nil {
+			return err
+		}
+	}
+	return bw.Close()
+}
+
+// EncodeTo writes the file into w as BGCode, as Encode does.
+func (f *File) EncodeTo(w io.Writer, opts ...EncodeOption) error {
+	return Encode(w, f, opts...)
+}
+
+// Marshal returns the BGCode encoding of the structured representation of a
+// file.
+func Marshal(f *File, opts ...EncodeOption) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := Encode(buf, f, opts...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFileMetadata writes a file metadata block.
+func (w *Writer) WriteFileMetadata(values KeyValues) error {
+	return w.writeMetadata(BlockHeaderTypeFileMetadata, values)
+}
+
+// WritePrinterMetadata writes a printer metadata block.
+func (w *Writer) WritePrinterMetadata(values KeyValues) error {
+	return w.writeMetadata(BlockHeaderTypePrinterMetadata, values)
+}
+
+// WritePrintMetadata writes a print metadata block.
+func (w *Writer) WritePrintMetadata(values KeyValues) error {
+	return w.writeMetadata(BlockHeaderTypePrintMetadata, values)
+}
+
+// WriteSlicerMetadata writes a slicer metadata block.
+func (w *Writer) WriteSlicerMetadata(values KeyValues) error {
+	return w.writeMetadata(BlockHeaderTypeSlicerMetadata, values)
+}
+
+// WriteThumbnail writes a thumbnail block holding an image already encoded
+// in the given format.
+func (w *Writer) WriteThumbnail(format BlockThumbnailFormat, width, height int, data []byte) error {
+	if width < 0 || width > math.MaxUint16 || height < 0 || height > math.MaxUint16 {
+		return fmt.Errorf("invalid thumbnail size %dx%d", width, height)
+	}
+	params := binary.LittleEndian.AppendUint16(nil, uint16(format))
+	params = binary.LittleEndian.AppendUint16(params, uint16(width))
+	params = binary.LittleEndian.AppendUint16(params, uint16(height))
+	return w.writeBlock(BlockHeaderTypeThumbnail, BlockHeaderCompressionNone, params, data)
+}
+
+// maxGCodeBlockSize is the largest amount of G-code stored in a single
+// block, matching what libbgcode produces.
+const maxGCodeBlockSize = 65535
+
+// WriteGCode writes G-code, split at line boundaries into as many G-code
+// blocks as needed. Line endings are normalized according to the
+// LineEnding option, and blocks are encoded according to the GCodeEncoding
+// option.
+func (w *Writer) WriteGCode(gcode string) error {
+	return w.writeGCode(w.opts.LineEnding.normalize(gcode))
+}
+
+// writeGCode writes G-code with its line endings as they are.
+func (w *Writer) writeGCode(gcode string) error {
+	params := binary.LittleEndian.AppendUint16(nil, uint16(w.opts.GCodeEncoding))
+	for len(gcode) > 0 {
+		n := len(gcode)
+		if n > maxGCodeBlockSize {
+			n = strings.LastIndexByte(gcode[:maxGCodeBlockSize], '\n') + 1
+			if n == 0 {
+				n = maxGCodeBlockSize
+			}
+		}
+		data, err := Binarize(gcode[:n], w.opts.GCodeEncoding)
+		if err != nil {
+			return err
+		}
+		if err := w.writeBlock(BlockHeaderTypeGCode, w.opts.compression(BlockHeaderTypeGCode), params, data); err != nil {
+			return err
+		}
+		gcode = gcode[n:]
+	}
+	return nil
+}
+
+// Close writes the file header if no block was written, so that the output
+// is a valid, albeit empty, BGCode file. It does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if !w.wroteHeader {
+		return w.writeHeader()
+	}
+	return nil
+}
+
+func (w *Writer) writeMetadata(bht BlockHeaderType, values KeyValues) error {
+	params := binary.LittleEndian.AppendUint16(nil, uint16(w.opts.MetadataEncoding))
+	return w.writeBlock(bht, w.opts.compression(bht), params, iniEncode(values))
+}
+
+func (w *Writer) writeHeader() error {
+	fh := FileHeader{
+		MagicNumber:  magicNumber,
+		Version:      Version1,
+		ChecksumType: w.opts.ChecksumType,
+	}
+	if err := fh.layout().writeFileHeader(w.w, &fh); err != nil {
+		w.err = fmt.Errorf("cannot write file header: %w", err)
+		return w.err
+	}
+	w.wroteHeader = true
+	return nil
+}
+
+func (w *Writer) writeBlock(bht BlockHeaderType, compression BlockHeaderCompression, params, data []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	if !w.wroteHeader {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+	bh := &BlockHeader{}
+	bh.basic.Type = bht
+	bh.basic.Compression = compression
+	bh.basic.UncompressedSize = uint32(len(data))
+	payload := data
+	if compression != BlockHeaderCompressionNone {
+		compressed := getBuffer()
+		defer putBuffer(compressed)
+		if err := deflate(compressed, compression, w.opts.CompressionLevel, data); err != nil {
+			return fmt.Errorf("cannot compress %v block: %w", bht, err)
+		}
+		payload = compressed.Bytes()
+	}
+	bh.extended.CompressedSize = uint32(len(payload))
+	buf := getBuffer()
+	defer putBuffer(buf)
+	bh.layout().writeBlockHeader(buf, bh)
+	buf.Write(params)
+	buf.Write(payload)
+	if h := w.opts.ChecksumType.newHash(); h != nil {
+		h.Write(buf.Bytes())
+		buf.Write(h.Sum(nil))
+	}
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		w.err = fmt.Errorf("cannot write %v block: %w", bht, err)
+		return w.err
+	}
+	return nil
+}
+
+// deflate compresses data with the given algorithm into dst. The level only
+// applies to BlockHeaderCompressionDeflate.
+func deflate(dst *bytes.Buffer, compression BlockHeaderCompression, level int, data []byte) error {
+	var (
+		w   io.WriteCloser
+		err error
+	)
+	if compression == BlockHeaderCompressionDeflate && level != zlib.DefaultCompression {
+		w, err = zlib.NewWriterLevel(dst, level)
+	} else {
+		w, err = compressor(compression, dst)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func iniEncode(kvs KeyValues) []byte {
+	out := &strings.Builder{}
+	for _, kv := range kvs {
+		fmt.Fprintf(out, "%s=%s\n", kv.Key, kv.Value)
+	}
+	return []byte(out.String())
+}
@@ -0,0 +1,219 @@
+package bgcodego
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriter_metadata(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f, err := Decode(bytes.NewReader(bgcode))
+	checkErr(t, err)
+
+	out := &bytes.Buffer{}
+	w, err := NewWriter(out)
+	checkErr(t, err)
+	checkErr(t, w.WriteFileMetadata(f.FileMetadata.Values))
+	checkErr(t, w.WritePrinterMetadata(f.PrinterMetadata.Values))
+	const metadataEnd = 410 // file header, file metadata and printer metadata
+	if !bytes.Equal(out.Bytes(), bgcode[:metadataEnd]) {
+		t.Errorf("unexpected output:\n%q\n%q", out.Bytes(), bgcode[:metadataEnd])
+	}
+}
+
+func TestNewWriter_metadataEncoding(t *testing.T) {
+	_, err := NewWriter(&bytes.Buffer{}, WithMetadataEncoding(BlockEncodingINI))
+	checkErr(t, err)
+	if _, err := NewWriter(&bytes.Buffer{}, WithMetadataEncoding(1)); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("expected ErrUnsupportedEncoding, got: %v", err)
+	}
+}
+
+func TestWriter_WriteGCode(t *testing.T) {
+	const gcode = "G28\nG1 X10 Y10\nG1 Z0.2\n"
+	encode := func(gcode string, opts ...EncodeOption) []byte {
+		t.Helper()
+		out := &bytes.Buffer{}
+		w, err := NewWriter(out, opts...)
+		checkErr(t, err)
+		checkErr(t, w.WriteGCode(gcode))
+		return out.Bytes()
+	}
+	unix := encode(gcode)
+	windows := encode(strings.ReplaceAll(gcode, "\n", "\r\n"))
+	if !bytes.Equal(unix, windows) {
+		t.Error("CRLF and LF inputs should encode identically")
+	}
+	f, err := Decode(bytes.NewReader(windows))
+	checkErr(t, err)
+	if len(f.GCode) != 1 || f.GCode[0].Body != gcode {
+		t.Errorf("unexpected decoded G-code: %v", f.Render())
+	}
+
+	f, err = Decode(bytes.NewReader(encode(gcode, WithLineEnding(LineEndingCRLF))))
+	checkErr(t, err)
+	if want := strings.ReplaceAll(gcode, "\n", "\r\n"); f.GCode[0].Body != want {
+		t.Errorf("unexpected decoded G-code: %q", f.GCode[0].Body)
+	}
+
+	if _, err := NewWriter(&bytes.Buffer{}, WithLineEnding("\r")); err == nil {
+		t.Error("expected error for unsupported line ending")
+	}
+}
+
+func TestWriter_WriteGCode_split(t *testing.T) {
+	line := strings.Repeat("G1 X1 Y1\n", 1000)
+	gcode := strings.Repeat(line, 10)
+	out := &bytes.Buffer{}
+	w, err := NewWriter(out)
+	checkErr(t, err)
+	checkErr(t, w.WriteGCode(gcode))
+	f, err := Decode(out)
+	checkErr(t, err)
+	if len(f.GCode) != 2 {
+		t.Errorf("expected 2 G-code blocks, got %d", len(f.GCode))
+	}
+	for i, bg := range f.GCode {
+		if !strings.HasSuffix(bg.Body, "\n") {
+			t.Errorf("block %d is not split at a line boundary", i)
+		}
+	}
+	if got := f.Render(); got != "\n"+gcode {
+		t.Error("unexpected rendered G-code")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	want := decodeFixture(t)
+	tests := []struct {
+		name string
+		opts []EncodeOption
+	}{
+		{"default", nil},
+		{"deflate", []EncodeOption{WithCompression(BlockHeaderCompressionDeflate)}},
+		{"deflate best", []EncodeOption{WithCompression(BlockHeaderCompressionDeflate), WithCompressionLevel(zlib.BestCompression)}},
+		{"deflate huffman", []EncodeOption{WithCompression(BlockHeaderCompressionDeflate), WithCompressionLevel(zlib.HuffmanOnly)}},
+		{"no checksum", []EncodeOption{WithChecksumType(ChecksumTypeNone)}},
+		{"meatpack with comments", []EncodeOption{WithGCodeEncoding(GCodeEncodingMeatpackWithComments)}},
+		{"heatshrink 11/4", []EncodeOption{WithCompression(BlockHeaderCompressionHeatshrink114)}},
+		{"slicer metadata uncompressed", []EncodeOption{WithBlockCompression(BlockHeaderTypeSlicerMetadata, BlockHeaderCompressionNone)}},
+		{"heatshrink 12/4 meatpack", []EncodeOption{WithCompression(BlockHeaderCompressionHeatshrink124), WithGCodeEncoding(GCodeEncodingMeatpackWithComments)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bgcode, err := Marshal(want, tt.opts...)
+			checkErr(t, err)
+			got, err := Decode(bytes.NewReader(bgcode), WithStrict())
+			checkErr(t, err)
+			if diff := cmp.Diff(want.Canonical(), got.Canonical()); diff != "" {
+				t.Errorf("Encode() round trip mismatch (-want +got):\n%s", diff)
+			}
+			if got := got.Render(); got != want.Render() {
+				t.Error("unexpected rendered output")
+			}
+		})
+	}
+}
+
+func TestEncode_compressionLevel(t *testing.T) {
+	f := decodeFixture(t)
+	sizes := make(map[int]int)
+	for _, level := range []int{zlib.BestSpeed, zlib.BestCompression} {
+		bgcode, err := Marshal(f, WithCompression(BlockHeaderCompressionDeflate), WithCompressionLevel(level))
+		checkErr(t, err)
+		sizes[level] = len(bgcode)
+		idx, err := Index(bytes.NewReader(bgcode))
+		checkErr(t, err)
+		// Blocks are zlib streams, as libbgcode inflates them: a CMF byte
+		// declaring Deflate, and no preset dictionary in FLG.
+		entry := idx.Blocks[len(idx.Blocks)-1]
+		data := bgcode[entry.Offset+12+2:]
+		if cmf, flg := data[0], data[1]; cmf&0x0f != 8 || (uint16(cmf)<<8|uint16(flg))%31 != 0 || flg&0x20 != 0 {
+			t.Errorf("level %d: unexpected zlib header %x %x", level, cmf, flg)
+		}
+	}
+	if sizes[zlib.BestCompression] >= sizes[zlib.BestSpeed] {
+		t.Errorf("expected smaller output at best compression: %v", sizes)
+	}
+}
+
+func TestEncode_blockCompression(t *testing.T) {
+	f := decodeFixture(t)
+	compressions := func(t *testing.T, bgcode []byte) map[BlockHeaderType]BlockHeaderCompression {
+		t.Helper()
+		idx, err := Index(bytes.NewReader(bgcode))
+		checkErr(t, err)
+		got := make(map[BlockHeaderType]BlockHeaderCompression)
+		for _, entry := range idx.Blocks {
+			got[entry.Header.Type()] = entry.Header.Compression()
+		}
+		return got
+	}
+	fixture, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	tests := []struct {
+		name string
+		opts []EncodeOption
+		want map[BlockHeaderType]BlockHeaderCompression
+	}{
+		{"default", nil, compressions(t, fixture)},
+		{"override", []EncodeOption{WithBlockCompression(BlockHeaderTypePrinterMetadata, BlockHeaderCompressionHeatshrink114)}, map[BlockHeaderType]BlockHeaderCompression{
+			BlockHeaderTypeFileMetadata:    BlockHeaderCompressionNone,
+			BlockHeaderTypePrinterMetadata: BlockHeaderCompressionHeatshrink114,
+			BlockHeaderTypeThumbnail:       BlockHeaderCompressionNone,
+			BlockHeaderTypePrintMetadata:   BlockHeaderCompressionNone,
+			BlockHeaderTypeSlicerMetadata:  BlockHeaderCompressionDeflate,
+			BlockHeaderTypeGCode:           BlockHeaderCompressionHeatshrink124,
+		}},
+		{"uniform then override", []EncodeOption{WithCompression(BlockHeaderCompressionDeflate), WithBlockCompression(BlockHeaderTypeGCode, BlockHeaderCompressionNone)}, map[BlockHeaderType]BlockHeaderCompression{
+			BlockHeaderTypeFileMetadata:    BlockHeaderCompressionDeflate,
+			BlockHeaderTypePrinterMetadata: BlockHeaderCompressionDeflate,
+			BlockHeaderTypeThumbnail:       BlockHeaderCompressionNone,
+			BlockHeaderTypePrintMetadata:   BlockHeaderCompressionDeflate,
+			BlockHeaderTypeSlicerMetadata:  BlockHeaderCompressionDeflate,
+			BlockHeaderTypeGCode:           BlockHeaderCompressionNone,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bgcode, err := Marshal(f, tt.opts...)
+			checkErr(t, err)
+			if diff := cmp.Diff(tt.want, compressions(t, bgcode)); diff != "" {
+				t.Errorf("unexpected block compressions (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEncode_empty(t *testing.T) {
+	bgcode, err := Marshal(&File{})
+	checkErr(t, err)
+	f, err := Decode(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	if f.Header.ChecksumType != ChecksumTypeCRC32 || f.Render() != "" {
+		t.Errorf("unexpected empty file: %+v", f)
+	}
+}
+
+func TestNewWriter_invalidOptions(t *testing.T) {
+	opts := []EncodeOption{
+		WithChecksumType(2),
+		WithCompression(BlockHeaderCompression(42)),
+		WithGCodeEncoding(3),
+		WithCompressionLevel(10),
+		WithBlockCompression(BlockHeaderTypeGCode, BlockHeaderCompression(42)),
+		WithBlockCompression(BlockHeaderTypeThumbnail, BlockHeaderCompressionDeflate),
+	}
+	for _, opt := range opts {
+		if _, err := NewWriter(&bytes.Buffer{}, opt); err == nil {
+			t.Error("expected error")
+		}
+	}
+}
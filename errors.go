@@ -0,0 +1,188 @@
+package bgcodego
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrBadChecksum is returned when the checksum stored in a block footer does
+// not match its contents.
+var ErrBadChecksum = errors.New("bad checksum")
+
+// ErrNotBGCode is returned when the input does not start with the BGCode
+// magic number.
+var ErrNotBGCode = errors.New("invalid BGCode file")
+
+// ErrOutputTooLarge is returned when the decoded output exceeds the
+// configured maximum size.
+var ErrOutputTooLarge = errors.New("output too large")
+
+// ErrLimitExceeded is matched by *LimitError.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// ErrUnknownBlockType is returned when a block header declares a type that
+// is not part of the specification known to this package.
+var ErrUnknownBlockType = errors.New("non-supported header type")
+
+// ErrBlockOrder is returned when streaming G-code out of a non-seekable input
+// with a block that is due before the G-code, such as printer metadata or a
+// thumbnail, placed after it. Parse and Decode accept blocks in any order.
+var ErrBlockOrder = errors.New("block must precede the G-code blocks")
+
+// Warning describes a non-fatal issue found while processing a file.
+type Warning struct {
+	Index   int   // Position of the affected block, or -1 if not block specific
+	Offset  int64 // Position of the affected block in the input
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Index < 0 {
+		return w.Message
+	}
+	return fmt.Sprintf("block #%d at offset %d: %s", w.Index, w.Offset, w.Message)
+}
+
+// BlockError describes a failure to process a specific block of the file.
+type BlockError struct {
+	Type   BlockHeaderType // Type of the block as declared in its header
+	Index  int             // Position of the block in the file, starting at 0
+	Offset int64           // Position of the block header in the input
+	At     int64           // Position in the input where the failure was detected
+	Err    error
+}
+
+func (e *BlockError) Error() string {
+	if e.At > e.Offset {
+		return fmt.Sprintf("block #%d (%v) at offset %d: %v (failed at offset %d)", e.Index, e.Type, e.Offset, e.Err, e.At)
+	}
+	return fmt.Sprintf("block #%d (%v) at offset %d: %v", e.Index, e.Type, e.Offset, e.Err)
+}
+
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+// ChecksumError describes a block whose checksum footer does not match its
+// contents. It matches ErrBadChecksum, and is wrapped in a BlockError that
+// identifies the block.
+type ChecksumError struct {
+	Type     ChecksumType
+	Stored   []byte // Footer read from the input
+	Computed []byte // Checksum of the block as read
+
+	// Start and End delimit the bytes of the input covered by the
+	// checksum, from the block header up to, but excluding, the footer.
+	Start, End int64
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%v: stored %x, computed %x over bytes %d-%d", ErrBadChecksum, e.Stored, e.Computed, e.Start, e.End)
+}
+
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrBadChecksum
+}
+
+// LimitError describes an input exceeding one of the resource limits of the
+// decoding options. It matches ErrLimitExceeded, and ErrOutputTooLarge when
+// the limit is on the size of the output.
+type LimitError struct {
+	Limit string // Name of the exceeded limit, such as "block size"
+	Max   int64  // Value of the limit
+	Value int64  // Value that exceeded it
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %s of %d exceeds %d", ErrLimitExceeded, e.Limit, e.Value, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded || (target == ErrOutputTooLarge && e.Limit == limitOutputSize)
+}
+
+// Names of the limits reported by LimitError.
+const (
+	limitBlockSize     = "block size"
+	limitThumbnailSize = "thumbnail size"
+	limitBlocks        = "block count"
+	limitOutputSize    = "output size"
+)
+
+// UnsupportedVersionError describes a file header declaring a version of the
+// specification this package does not implement. It matches
+// errors.ErrUnsupported, as do UnsupportedChecksumError and
+// UnsupportedCompressionError.
+type UnsupportedVersionError struct {
+	Version FileHeaderVersion
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("non-supported bgcode version: %d", e.Version)
+}
+
+func (e *UnsupportedVersionError) Is(target error) bool {
+	return target == errors.ErrUnsupported
+}
+
+// UnsupportedChecksumError describes a checksum type that is neither part of
+// the specification nor registered with RegisterChecksum.
+type UnsupportedChecksumError struct {
+	Type ChecksumType
+}
+
+func (e *UnsupportedChecksumError) Error() string {
+	return fmt.Sprintf("non-supported checksum type: %d", e.Type)
+}
+
+func (e *UnsupportedChecksumError) Is(target error) bool {
+	return target == errors.ErrUnsupported
+}
+
+// UnsupportedCompressionError describes a compression algorithm that is
+// neither part of the specification nor registered with RegisterCompression.
+type UnsupportedCompressionError struct {
+	Compression BlockHeaderCompression
+}
+
+func (e *UnsupportedCompressionError) Error() string {
+	return fmt.Sprintf("non-supported compression algorithm: %d", e.Compression)
+}
+
+func (e *UnsupportedCompressionError) Is(target error) bool {
+	return target == errors.ErrUnsupported
+}
+
+// UnsupportedBlockTypeError describes a block of unknown type whose
+// parameters are not defined by the layout of the file, so that the block
+// cannot be skipped. It matches ErrUnknownBlockType.
+type UnsupportedBlockTypeError struct {
+	Type BlockHeaderType
+}
+
+func (e *UnsupportedBlockTypeError) Error() string {
+	return fmt.Sprintf("%v: %d, with parameters of unknown size", ErrUnknownBlockType, e.Type)
+}
+
+func (e *UnsupportedBlockTypeError) Is(target error) bool {
+	return target == ErrUnknownBlockType || target == errors.ErrUnsupported
+}
+
+// skippable reports whether err was returned for a well-formed block of
+// unknown type, which can be skipped.
+func skippable(err error) bool {
+	var ue *UnsupportedBlockTypeError
+	return errors.Is(err, ErrUnknownBlockType) && !errors.As(err, &ue)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,337 @@
+package bgcodego
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrUnexpectedFirstBlock is returned in strict mode when the first block of
+// the file is not the file metadata block.
+var ErrUnexpectedFirstBlock = errors.New("first block is not file metadata")
+
+// File is the structured representation of a BGCode file.
+type File struct {
+	// Header is the file header. Its ChecksumType reports the checksum
+	// protecting every block.
+	Header FileHeader
+
+	FileMetadata    *BlockFileMetadata
+	PrinterMetadata *BlockPrinterMetadata
+	Thumbnails      []*BlockThumbnail
+	PrintMetadata   *BlockPrintMetadata
+	SlicerMetadata  *BlockSlicerMetadata
+	GCode           []*BlockGCode
+
+	// Custom holds the blocks of types registered with RegisterBlockType,
+	// in file order.
+	Custom []BlockRenderer
+
+	// Warnings lists the non-fatal issues found while decoding.
+	Warnings []Warning
+
+	// Stats totals the blocks of the input.
+	Stats BlockStats
+
+	gcodeLines    int
+	gcodeSize     int64
+	gcodeLastByte byte
+	layers        []Layer
+	layerZPending bool
+	zMoves        zMoveIndex
+}
+
+// GCodeLineCount reports how many lines of G-code the G-code blocks hold. A
+// final line without a trailing newline is also counted.
+func (f *File) GCodeLineCount() int {
+	n := 0
+	for _, bg := range f.GCode {
+		if bg.Body == "" {
+			continue
+		}
+		// Render separates blocks with a newline, so an unterminated
+		// last line counts as well.
+		n += strings.Count(bg.Body, "\n")
+		if bg.Body[len(bg.Body)-1] != '\n' {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *File) addGCode(bg *BlockGCode) {
+	f.GCode = append(f.GCode, bg)
+	if len(bg.Body) == 0 {
+		return
+	}
+	if f.gcodeLastByte != 0 && f.gcodeLastByte != '\n' {
+		// Render separates blocks with a newline, so the unterminated
+		// last line of the previous block ends here.
+		f.gcodeLines++
+		f.gcodeSize++
+	}
+	for body := bg.Body; body != ""; {
+		line, rest, terminated := strings.Cut(body, "\n")
+		f.indexLayer(line)
+		if terminated {
+			f.gcodeLines++
+			f.gcodeSize++
+		}
+		f.gcodeSize += int64(len(line))
+		body = rest
+	}
+	f.gcodeLastByte = bg.Body[len(bg.Body)-1]
+}
+
+// Decode reads a BGCode input into its structured representation.
+func Decode(fd io.Reader, opts ...DecodeOption) (*File, error) {
+	return decode(fd, newDecodeOptions(opts))
+}
+
+// DecodeFile reads the BGCode file at path into its structured
+// representation.
+func DecodeFile(path string, opts ...DecodeOption) (*File, error) {
+	fd, opts, err := openFile(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return Decode(bufio.NewReaderSize(fd, fileBufferSize), opts...)
+}
+
+// fileBufferSize is the size of the buffer the *File entry points read
+// through, which saves a system call for each of the small reads of block
+// headers and parameters.
+const fileBufferSize = 64 << 10
+
+// openFile opens the file at path, adding its size to opts for progress
+// reporting, unless opts already set one.
+func openFile(path string, opts []DecodeOption) (*os.File, []DecodeOption, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi, err := fd.Stat(); err == nil && fi.Mode().IsRegular() {
+		opts = append([]DecodeOption{WithTotalSize(fi.Size())}, opts...)
+	}
+	return fd, opts, nil
+}
+
+func decode(fd io.Reader, o *DecodeOptions) (*File, error) {
+	r, err := newReader(fd, o)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Header: r.Header}
+	// held counts the decoded G-code, and the data of the other blocks
+	// kept, all of which the File holds in memory.
+	var held int64
+	err = r.decodeEach(func(block BlockRenderer) error {
+		gcodeSize := f.gcodeSize
+		f.add(block)
+		if _, ok := block.(*BlockGCode); ok {
+			held += f.gcodeSize - gcodeSize
+		} else {
+			held += int64(r.cur.Header.UncompressedSize())
+		}
+		if lim := o.maxTotalSize(); lim > 0 && held > lim {
+			return &LimitError{Limit: limitOutputSize, Max: lim, Value: held}
+		}
+		return nil
+	})
+	f.Warnings = r.Warnings
+	f.Stats = r.Stats
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// add stores a decoded block in the file. Only the first metadata block of
+// each type is kept.
+func (f *File) add(block BlockRenderer) {
+	switch b := block.(type) {
+	case *BlockFileMetadata:
+		if f.FileMetadata == nil {
+			f.FileMetadata = b
+		}
+	case *BlockPrinterMetadata:
+		if f.PrinterMetadata == nil {
+			f.PrinterMetadata = b
+		}
+	case *BlockThumbnail:
+		f.Thumbnails = append(f.Thumbnails, b)
+	case *BlockPrintMetadata:
+		if f.PrintMetadata == nil {
+			f.PrintMetadata = b
+		}
+	case *BlockSlicerMetadata:
+		if f.SlicerMetadata == nil {
+			f.SlicerMetadata = b
+		}
+	case *BlockGCode:
+		f.addGCode(b)
+	default:
+		f.Custom = append(f.Custom, b)
+	}
+}
+
+func newBlock(bht BlockHeaderType) BlockParser {
+	if block := builtinBlock(bht); block != nil {
+		return block
+	}
+	if bt, ok := lookupBlockType(bht); ok {
+		return bt.newBlock()
+	}
+	return nil
+}
+
+func builtinBlock(bht BlockHeaderType) BlockParser {
+	switch bht {
+	case BlockHeaderTypeFileMetadata:
+		return &BlockFileMetadata{}
+	case BlockHeaderTypeGCode:
+		return &BlockGCode{}
+	case BlockHeaderTypeSlicerMetadata:
+		return &BlockSlicerMetadata{}
+	case BlockHeaderTypePrinterMetadata:
+		return &BlockPrinterMetadata{}
+	case BlockHeaderTypePrintMetadata:
+		return &BlockPrintMetadata{}
+	case BlockHeaderTypeThumbnail:
+		return &BlockThumbnail{}
+	}
+	return nil
+}
+
+// skipBlock consumes the block parameters and data without decoding them.
+func skipBlock(r io.Reader, hdr *BlockHeader) error {
+	_, err := io.CopyN(io.Discard, r, int64(hdr.ParametersSize())+int64(hdr.Length()))
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Render converts the structured representation into regular GCode output.
+func (f *File) Render() string {
+	out := &strings.Builder{}
+	f.render(out, &RenderOptions{})
+	return out.String()
+}
+
+// WriteTo writes the G-code rendering of the file into w, as Render does. It
+// implements io.WriterTo.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := f.render(cw, &RenderOptions{})
+	return cw.n, err
+}
+
+// ReadFrom decodes the BGCode input r into the file, replacing its contents,
+// as Decode does. It implements io.ReaderFrom.
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	decoded, err := decode(cr, newDecodeOptions(nil))
+	if err != nil {
+		return cr.n, err
+	}
+	*f = *decoded
+	return cr.n, nil
+}
+
+// render writes the GCode output into w, returning the first write error.
+func (f *File) render(w io.Writer, o *RenderOptions) error {
+	out := &errWriter{w: w}
+	for _, s := range o.sections() {
+		f.renderSection(out, s, o)
+	}
+	return out.err
+}
+
+// errWriter stops writing after the first error, which it retains.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n, err := ew.w.Write(p)
+	ew.err = err
+	return n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// limitWriter fails with a *LimitError once more than max bytes are
+// written through it.
+type limitWriter struct {
+	w   io.Writer
+	n   int64 // bytes written so far
+	max int64
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if lw.n+int64(len(p)) > lw.max {
+		return 0, &LimitError{Limit: limitOutputSize, Max: lw.max, Value: lw.n + int64(len(p))}
+	}
+	lw.n += int64(len(p))
+	return lw.w.Write(p)
+}
+
+// writeGCode writes the G-code of all blocks.
+func (f *File) writeGCode(out io.Writer) {
+	gj := &gcodeJoiner{out: out}
+	for _, gcode := range f.GCode {
+		gj.write(gcode.Render())
+	}
+}
+
+// gcodeJoiner writes consecutive G-code bodies, ensuring that the
+// unterminated last line of a body does not merge with the first line of the
+// next one. Bodies are either written at once with write, or streamed with
+// Write after a call to begin.
+type gcodeJoiner struct {
+	out          io.Writer
+	unterminated bool // output so far ends with an unterminated line
+	pending      bool // a newline is due before the next body output
+}
+
+func (gj *gcodeJoiner) write(body string) {
+	gj.begin()
+	io.WriteString(gj, body)
+}
+
+func (gj *gcodeJoiner) begin() {
+	gj.pending = gj.unterminated
+}
+
+func (gj *gcodeJoiner) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if gj.pending {
+		if _, err := fmt.Fprintln(gj.out); err != nil {
+			return 0, err
+		}
+		gj.pending = false
+	}
+	gj.unterminated = p[len(p)-1] != '\n'
+	return gj.out.Write(p)
+}
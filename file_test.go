@@ -0,0 +1,388 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFile_GCodeLineCount(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+		checkErr(t, err)
+		t.Cleanup(func() { fd.Close() })
+		f, err := Decode(fd)
+		checkErr(t, err)
+		if got := f.GCodeLineCount(); got != 25851 {
+			t.Errorf("GCodeLineCount() = %v, want 25851", got)
+		}
+		// The count follows changes to the G-code blocks.
+		first := &File{GCode: f.GCode[:1]}
+		if got, want := first.GCodeLineCount(), strings.Count(f.GCode[0].Body, "\n"); got != want {
+			t.Errorf("GCodeLineCount() of the first block = %v, want %v", got, want)
+		}
+	})
+	tests := []struct {
+		name   string
+		bodies []string
+		want   int
+	}{
+		{"empty", nil, 0},
+		{"trailing newline", []string{"G1 X1\nG1 X2\n"}, 2},
+		{"no trailing newline", []string{"G1 X1\nG1 X2"}, 2},
+		{"multiple blocks", []string{"G1 X1\n", "G1 X2\nG1 X3\n"}, 3},
+		{"multiple blocks without trailing newline", []string{"G1 X1\n", "G1 X2\nG1 X3"}, 3},
+		{"empty last block", []string{"G1 X1\nG1 X2", ""}, 2},
+		{"unterminated first block", []string{"G1 X1", "G1 X2\n"}, 2},
+		{"unterminated blocks", []string{"G1 X1", "G1 X2"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &File{}
+			for _, body := range tt.bodies {
+				f.GCode = append(f.GCode, &BlockGCode{Body: body})
+			}
+			if got := f.GCodeLineCount(); got != tt.want {
+				t.Errorf("GCodeLineCount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_strictFirstBlock(t *testing.T) {
+	t.Run("lenient", func(t *testing.T) {
+		fd, err := os.Open("_testdata/reordered_first_block.bgcode")
+		checkErr(t, err)
+		t.Cleanup(func() { fd.Close() })
+		f, err := Decode(fd)
+		checkErr(t, err)
+		if f.FileMetadata == nil || f.PrinterMetadata == nil {
+			t.Error("expected both file and printer metadata blocks")
+		}
+	})
+	t.Run("strict", func(t *testing.T) {
+		fd, err := os.Open("_testdata/reordered_first_block.bgcode")
+		checkErr(t, err)
+		t.Cleanup(func() { fd.Close() })
+		if _, err := Decode(fd, WithStrict()); !errors.Is(err, ErrUnexpectedFirstBlock) {
+			t.Errorf("expected ErrUnexpectedFirstBlock, got: %v", err)
+		}
+	})
+	t.Run("strict conformant", func(t *testing.T) {
+		fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+		checkErr(t, err)
+		t.Cleanup(func() { fd.Close() })
+		_, err = Decode(fd, WithStrict())
+		checkErr(t, err)
+	})
+}
+
+func TestDecode_blockError(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	bgcode[500] ^= 0xFF // inside the first thumbnail body
+	_, err = Decode(bytes.NewReader(bgcode))
+	if !errors.Is(err, ErrBadChecksum) {
+		t.Fatalf("expected ErrBadChecksum, got: %v", err)
+	}
+	var blockErr *BlockError
+	if !errors.As(err, &blockErr) {
+		t.Fatalf("expected *BlockError, got: %T", err)
+	}
+	want := BlockError{Type: BlockHeaderTypeThumbnail, Index: 2, Offset: 410, At: 889}
+	if got := *blockErr; got.Type != want.Type || got.Index != want.Index || got.Offset != want.Offset || got.At != want.At {
+		t.Errorf("unexpected block error: %#v", blockErr)
+	}
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected *ChecksumError, got: %T", blockErr.Err)
+	}
+	if checksumErr.Type != ChecksumTypeCRC32 || len(checksumErr.Stored) != 4 || bytes.Equal(checksumErr.Stored, checksumErr.Computed) {
+		t.Errorf("unexpected checksum error: %#v", checksumErr)
+	}
+	if checksumErr.Start != 410 || checksumErr.End != 885 {
+		t.Errorf("unexpected checksummed range: %d-%d", checksumErr.Start, checksumErr.End)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "block #2 (Thumbnail) at offset 410") || !strings.Contains(msg, "over bytes 410-885") {
+		t.Errorf("unexpected error message: %s", msg)
+	}
+}
+
+func TestDecode_checksumPolicy(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	bgcode[len(bgcode)-1] ^= 0xFF // footer of the last G-code block
+	want := decodeFixture(t).Render()
+
+	if _, err := Decode(bytes.NewReader(bgcode), WithChecksumPolicy(ChecksumFail)); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("expected ErrBadChecksum, got: %v", err)
+	}
+	f, err := Decode(bytes.NewReader(bgcode), WithChecksumPolicy(ChecksumWarn))
+	checkErr(t, err)
+	if len(f.Warnings) != 1 || f.Warnings[0].Index != 15 || !strings.Contains(f.Warnings[0].Message, "bad checksum") {
+		t.Errorf("unexpected warnings: %v", f.Warnings)
+	}
+	if f.Render() != want {
+		t.Error("unexpected output with ChecksumWarn")
+	}
+	f, err = Decode(bytes.NewReader(bgcode), WithChecksumPolicy(ChecksumIgnore))
+	checkErr(t, err)
+	if len(f.Warnings) != 0 || f.Render() != want {
+		t.Errorf("unexpected result with ChecksumIgnore: %v", f.Warnings)
+	}
+}
+
+func TestDecode_concurrent(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	want := decodeFixture(t).Render()
+	errs := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			f, err := Decode(bytes.NewReader(bgcode))
+			if err == nil && f.Render() != want {
+				err = errors.New("unexpected output")
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		checkErr(t, <-errs)
+	}
+}
+
+func TestDecode_unsupported(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	tests := []struct {
+		name   string
+		offset int
+		value  byte
+		want   error
+	}{
+		{"not bgcode", 0, 'X', ErrNotBGCode},
+		{"version", 4, 2, &UnsupportedVersionError{Version: 2}},
+		{"checksum", 8, 7, &UnsupportedChecksumError{Type: 7}},
+		{"compression", 10 + 2, 9, &UnsupportedCompressionError{Compression: 9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corrupted := bytes.Clone(bgcode)
+			corrupted[tt.offset] = tt.value
+			_, err := Decode(bytes.NewReader(corrupted))
+			if err == nil || !strings.Contains(err.Error(), tt.want.Error()) {
+				t.Errorf("expected %v, got: %v", tt.want, err)
+			}
+			if unsupported := tt.want != ErrNotBGCode; errors.Is(err, errors.ErrUnsupported) != unsupported {
+				t.Errorf("unexpected errors.ErrUnsupported match for: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecode_onlyTypes(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f, err := Decode(bytes.NewReader(bgcode), WithOnlyTypes(BlockHeaderTypeGCode))
+	checkErr(t, err)
+	if f.FileMetadata != nil || f.PrinterMetadata != nil || f.PrintMetadata != nil || f.SlicerMetadata != nil || len(f.Thumbnails) != 0 {
+		t.Error("unexpected non-gcode block decoded")
+	}
+	if got := f.GCodeLineCount(); got != 25851 {
+		t.Errorf("GCodeLineCount() = %v, want 25851", got)
+	}
+
+	bgcode[5800] ^= 0xFF // inside the skipped print metadata block
+	_, err = Decode(bytes.NewReader(bgcode), WithOnlyTypes(BlockHeaderTypeGCode))
+	if !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("expected ErrBadChecksum on skipped block, got: %v", err)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("all", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Decode(bytes.NewReader(bgcode)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("metadata", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := Decode(bytes.NewReader(bgcode), WithOnlyTypes(BlockHeaderTypeFileMetadata, BlockHeaderTypePrinterMetadata, BlockHeaderTypePrintMetadata, BlockHeaderTypeSlicerMetadata))
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("gcode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Decode(bytes.NewReader(bgcode), WithOnlyTypes(BlockHeaderTypeGCode)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDecode_skipUnknownBlocks(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		fd, err := os.Open("_testdata/future_block.bgcode")
+		checkErr(t, err)
+		t.Cleanup(func() { fd.Close() })
+		if _, err := Decode(fd); !errors.Is(err, ErrUnknownBlockType) {
+			t.Errorf("expected ErrUnknownBlockType, got: %v", err)
+		}
+	})
+	t.Run("skip", func(t *testing.T) {
+		fd, err := os.Open("_testdata/future_block.bgcode")
+		checkErr(t, err)
+		t.Cleanup(func() { fd.Close() })
+		f, err := Decode(fd, WithSkipUnknownBlocks())
+		checkErr(t, err)
+		if f.FileMetadata == nil || f.PrinterMetadata == nil {
+			t.Error("expected the known blocks around the unknown one to be decoded")
+		}
+		want := []Warning{{Index: 1, Offset: 51, Message: "skipped block of unknown type 99"}}
+		if diff := cmp.Diff(want, f.Warnings); diff != "" {
+			t.Errorf("Warnings mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestDecode_keepPacked(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f, err := Decode(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	if f.GCode[0].Packed() != nil {
+		t.Error("packed body should not be retained by default")
+	}
+	f, err = Decode(bytes.NewReader(bgcode), WithKeepPacked())
+	checkErr(t, err)
+	for i, gcode := range f.GCode {
+		if len(gcode.Packed()) == 0 {
+			t.Fatalf("block %d: missing packed body", i)
+		}
+		if got := Unbinarize(gcode.Packed()); got != gcode.Body {
+			t.Errorf("block %d: Unbinarize(Packed()) does not match Body", i)
+		}
+	}
+}
+
+func TestDecode_progress(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	tests := []struct {
+		name      string
+		r         io.Reader
+		opts      []DecodeOption
+		wantTotal int64
+	}{
+		{"seekable", bytes.NewReader(bgcode), nil, int64(len(bgcode))},
+		{"not seekable", io.MultiReader(bytes.NewReader(bgcode)), nil, -1},
+		{"declared size", io.MultiReader(bytes.NewReader(bgcode)), []DecodeOption{WithTotalSize(int64(len(bgcode)))}, int64(len(bgcode))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []ProgressEvent
+			opts := append(tt.opts, WithProgress(func(ev ProgressEvent) {
+				events = append(events, ev)
+			}))
+			_, err := Decode(tt.r, opts...)
+			checkErr(t, err)
+			if len(events) != 16 {
+				t.Fatalf("expected 16 progress events, got %d", len(events))
+			}
+			for i, ev := range events {
+				if ev.Blocks != i+1 || ev.TotalBytes != tt.wantTotal {
+					t.Errorf("unexpected event %d: %+v", i, ev)
+				}
+			}
+			want := ProgressEvent{
+				BytesRead:  int64(len(bgcode)),
+				TotalBytes: tt.wantTotal,
+				Blocks:     16,
+				BlockType:  BlockHeaderTypeGCode,
+			}
+			if last := events[len(events)-1]; last != want {
+				t.Errorf("unexpected last event: %+v", last)
+			}
+		})
+	}
+}
+
+func TestDecode_skipChecksum(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	bgcode[len(bgcode)-1] ^= 0xFF // inside the CRC32 footer of the last block
+	if _, err := Decode(bytes.NewReader(bgcode)); !errors.Is(err, ErrBadChecksum) {
+		t.Fatalf("expected ErrBadChecksum, got: %v", err)
+	}
+	f, err := Decode(bytes.NewReader(bgcode), WithSkipChecksum())
+	checkErr(t, err)
+	if got := f.GCodeLineCount(); got != 25851 {
+		t.Errorf("GCodeLineCount() = %v, want 25851", got)
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	want, err := Decode(fd)
+	checkErr(t, err)
+	got, err := DecodeFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	if got.Render() != want.Render() {
+		t.Error("DecodeFile() does not match Decode()")
+	}
+	if _, err := DecodeFile("_testdata/missing.bgcode"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("DecodeFile() error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestFile_WriteTo(t *testing.T) {
+	input, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f := &File{}
+	n, err := f.ReadFrom(bytes.NewReader(input))
+	checkErr(t, err)
+	if n != int64(len(input)) {
+		t.Errorf("ReadFrom read %d bytes, want %d", n, len(input))
+	}
+
+	var rendered bytes.Buffer
+	var wt io.WriterTo = f
+	n, err = wt.WriteTo(&rendered)
+	checkErr(t, err)
+	if want := f.Render(); rendered.String() != want || n != int64(len(want)) {
+		t.Errorf("WriteTo wrote %d bytes, want the %d bytes of Render", n, len(want))
+	}
+
+	var encoded bytes.Buffer
+	checkErr(t, f.EncodeTo(&encoded))
+	want, err := Marshal(f)
+	checkErr(t, err)
+	if !bytes.Equal(encoded.Bytes(), want) {
+		t.Error("EncodeTo differs from Marshal")
+	}
+
+	if _, err := f.ReadFrom(strings.NewReader("not bgcode")); !errors.Is(err, ErrNotBGCode) {
+		t.Errorf("expected ErrNotBGCode, got: %v", err)
+	}
+	if len(f.GCode) == 0 {
+		t.Error("failed ReadFrom must leave the file untouched")
+	}
+}
@@ -0,0 +1,153 @@
+package bgcodego
+
+import "io"
+
+// gcodeFilter rewrites decoded G-code as it streams.
+type gcodeFilter interface {
+	// append filters src, the continuation of the G-code seen so far, and
+	// appends the result to dst.
+	append(dst, src []byte) []byte
+
+	// flush appends whatever was held back at the end of the G-code.
+	flush(dst []byte) []byte
+}
+
+// gcodeFilters returns the filters the G-code of a block goes through, in
+// order. Filters are stateful, so each block gets its own.
+func (o *DecodeOptions) gcodeFilters() []gcodeFilter {
+	var filters []gcodeFilter
+	if o.StripComments {
+		filters = append(filters, &commentStripper{})
+	}
+	if o.LineEnding != "" || o.TrimTrailingSpace {
+		filters = append(filters, &lineNormalizer{eol: o.LineEnding, trim: o.TrimTrailingSpace})
+	}
+	return filters
+}
+
+// applyFilters runs gcode through all filters.
+func applyFilters(gcode []byte, filters []gcodeFilter) []byte {
+	for _, f := range filters {
+		gcode = f.flush(f.append(make([]byte, 0, len(gcode)), gcode))
+	}
+	return gcode
+}
+
+// commentStripper removes the comments of G-code, along with the whitespace
+// before them and the lines they leave empty, the same way the Meatpack
+// encoder does when comments are not kept.
+type commentStripper struct {
+	inComment  bool
+	hasCode    bool   // the current line has code
+	hadComment bool   // the current line has a comment
+	pending    []byte // whitespace not yet known to precede a comment
+}
+
+func (cs *commentStripper) append(dst, src []byte) []byte {
+	for _, c := range src {
+		switch {
+		case c == '\n':
+			if cs.hasCode || !cs.hadComment {
+				dst = append(dst, cs.pending...)
+				dst = append(dst, c)
+			}
+			*cs = commentStripper{pending: cs.pending[:0]}
+		case c == '\r' && cs.inComment:
+			cs.pending = append(cs.pending[:0], c)
+		case cs.inComment:
+		case c == ';':
+			cs.inComment, cs.hadComment = true, true
+			cs.pending = cs.pending[:0]
+		case c == ' ' || c == '\t' || c == '\r':
+			cs.pending = append(cs.pending, c)
+		default:
+			dst = append(dst, cs.pending...)
+			dst = append(dst, c)
+			cs.pending = cs.pending[:0]
+			cs.hasCode = true
+		}
+	}
+	return dst
+}
+
+func (cs *commentStripper) flush(dst []byte) []byte {
+	if !cs.inComment {
+		dst = append(dst, cs.pending...)
+	}
+	cs.pending = cs.pending[:0]
+	return dst
+}
+
+// lineNormalizer rewrites line terminators to eol, when set, and trims the
+// whitespace at the end of lines, when trim is set.
+type lineNormalizer struct {
+	eol     LineEnding
+	trim    bool
+	pending []byte // whitespace not yet known to end the line
+}
+
+func (ln *lineNormalizer) append(dst, src []byte) []byte {
+	for _, c := range src {
+		switch c {
+		case ' ', '\t', '\r':
+			ln.pending = append(ln.pending, c)
+		case '\n':
+			ws := ln.pending
+			eol := LineEndingLF
+			if len(ws) > 0 && ws[len(ws)-1] == '\r' {
+				ws, eol = ws[:len(ws)-1], LineEndingCRLF
+			}
+			if !ln.trim {
+				dst = append(dst, ws...)
+			}
+			if ln.eol != "" {
+				eol = ln.eol
+			}
+			dst = append(dst, eol...)
+			ln.pending = ln.pending[:0]
+		default:
+			dst = append(dst, ln.pending...)
+			dst = append(dst, c)
+			ln.pending = ln.pending[:0]
+		}
+	}
+	return dst
+}
+
+func (ln *lineNormalizer) flush(dst []byte) []byte {
+	if !ln.trim {
+		dst = append(dst, ln.pending...)
+	}
+	ln.pending = ln.pending[:0]
+	return dst
+}
+
+// filterReader filters the G-code read through it.
+type filterReader struct {
+	r   io.Reader
+	f   gcodeFilter
+	in  []byte
+	out []byte
+	pos int
+	err error
+}
+
+func (fr *filterReader) Read(p []byte) (int, error) {
+	for fr.pos == len(fr.out) {
+		if fr.err != nil {
+			return 0, fr.err
+		}
+		if fr.in == nil {
+			fr.in = make([]byte, 4096)
+		}
+		n, err := fr.r.Read(fr.in)
+		fr.out, fr.pos = fr.f.append(fr.out[:0], fr.in[:n]), 0
+		if err == io.EOF {
+			fr.out = fr.f.flush(fr.out)
+		}
+		fr.err = err
+	}
+	n := copy(p, fr.out[fr.pos:])
+	fr.pos += n
+	return n, nil
+}
@@ -0,0 +1,124 @@
+package bgcodego
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name  string
+		gcode string
+		want  string
+	}{
+		{"no comments", "G28\nG1 X1 \n", "G28\nG1 X1 \n"},
+		{"comment lines", "; comment\nG28\n;another\n", "G28\n"},
+		{"inline", "G28 ; home\nG1 X1\t;move\n", "G28\nG1 X1\n"},
+		{"blank lines", "G28\n\nG1 X1\n", "G28\n\nG1 X1\n"},
+		{"crlf", "; comment\r\nG28 ; home\r\nG1 X1\r\n", "G28\r\nG1 X1\r\n"},
+		{"unterminated", "G28\nG1 X1 ", "G28\nG1 X1 "},
+		{"unterminated comment", "G28\nG1 X1 ; move", "G28\nG1 X1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(applyFilters([]byte(tt.gcode), []gcodeFilter{&commentStripper{}})); got != tt.want {
+				t.Errorf("applyFilters() = %q, want %q", got, tt.want)
+			}
+			got, err := io.ReadAll(&filterReader{r: strings.NewReader(tt.gcode), f: &commentStripper{}})
+			checkErr(t, err)
+			if string(got) != tt.want {
+				t.Errorf("filterReader = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_stripComments(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f := decodeFixture(t)
+	stripped, err := Decode(bytes.NewReader(bgcode), WithStripComments())
+	checkErr(t, err)
+	for i, bg := range stripped.GCode {
+		if bg.Encoding() != GCodeEncodingMeatpackWithComments {
+			t.Fatalf("block %d: unexpected encoding %v", i, bg.Encoding())
+		}
+		if strings.Contains(bg.Body, ";") {
+			t.Errorf("block %d: comments not stripped", i)
+		}
+		if want := string(applyFilters([]byte(f.GCode[i].Body), []gcodeFilter{&commentStripper{}})); bg.Body != want {
+			t.Errorf("block %d: unexpected G-code", i)
+		}
+	}
+
+	got, err := Parse(bytes.NewReader(bgcode), WithStripComments())
+	checkErr(t, err)
+	if got != stripped.Render() {
+		t.Error("Parse output does not match the rendered File")
+	}
+	vr, err := NewVerifyingReader(bytes.NewReader(bgcode), WithStripComments())
+	checkErr(t, err)
+	streamed, err := io.ReadAll(vr)
+	checkErr(t, err)
+	if strings.Contains(string(streamed), ";") {
+		t.Error("comments not stripped from the verifying reader")
+	}
+}
+
+func TestLineNormalizer(t *testing.T) {
+	tests := []struct {
+		name  string
+		eol   LineEnding
+		trim  bool
+		gcode string
+		want  string
+	}{
+		{"verbatim", "", false, "G28 \r\nG1 X1\n", "G28 \r\nG1 X1\n"},
+		{"lf", LineEndingLF, false, "G28 \r\nG1 X1\n", "G28 \nG1 X1\n"},
+		{"crlf", LineEndingCRLF, false, "G28\r\nG1 X1\n", "G28\r\nG1 X1\r\n"},
+		{"trim", "", true, "G28 \t\r\nG1  X1 \n\n", "G28\r\nG1  X1\n\n"},
+		{"trim unterminated", LineEndingLF, true, "G28\nG1 X1 ", "G28\nG1 X1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln := &lineNormalizer{eol: tt.eol, trim: tt.trim}
+			if got := string(applyFilters([]byte(tt.gcode), []gcodeFilter{ln})); got != tt.want {
+				t.Errorf("applyFilters() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_encodingNone(t *testing.T) {
+	const gcode = "G28\r\n\r\n  G1 X1  \r\nM84\r\n"
+	bgcode, err := Marshal(&File{GCode: []*BlockGCode{{Body: gcode}}}, WithGCodeEncoding(GCodeEncodingNone), WithLineEnding(LineEndingCRLF))
+	checkErr(t, err)
+	f, err := Decode(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	if got := f.GCode[0].Body; got != gcode {
+		t.Errorf("G-code not rendered verbatim: %q", got)
+	}
+
+	const want = "G28\n\n  G1 X1\nM84\n"
+	opts := []DecodeOption{WithNormalizedLineEnding(LineEndingLF), WithTrimTrailingSpace()}
+	f, err = Decode(bytes.NewReader(bgcode), opts...)
+	checkErr(t, err)
+	if got := f.GCode[0].Body; got != want {
+		t.Errorf("unexpected normalized G-code: %q", got)
+	}
+	parsed, err := Parse(bytes.NewReader(bgcode), opts...)
+	checkErr(t, err)
+	if parsed != f.Render() {
+		t.Errorf("Parse output does not match the rendered File: %q", parsed)
+	}
+	vr, err := NewVerifyingReader(bytes.NewReader(bgcode), opts...)
+	checkErr(t, err)
+	streamed, err := io.ReadAll(vr)
+	checkErr(t, err)
+	if string(streamed) != want {
+		t.Errorf("unexpected G-code from the verifying reader: %q", streamed)
+	}
+}
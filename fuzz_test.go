@@ -0,0 +1,98 @@
+package bgcodego
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fuzzOptions bound the memory a fuzzed input can make the decoder use.
+var fuzzOptions = []DecodeOption{
+	WithMaxBlockSize(1 << 20),
+	WithMaxBlocks(1 << 10),
+	WithMaxTotalSize(16 << 20),
+}
+
+func FuzzParse(f *testing.F) {
+	fixtures, err := filepath.Glob("_testdata/*.bgcode")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, fixture := range fixtures {
+		data, err := os.ReadFile(fixture)
+		if err != nil {
+			f.Fatal(err)
+		}
+		// Large seeds make the fuzzer spend its time minimizing.
+		if len(data) <= 4<<10 {
+			f.Add(data)
+		}
+	}
+	small := &File{
+		FileMetadata: &BlockFileMetadata{Values: KeyValues{{Key: "Producer", Value: "fuzz"}}},
+		GCode:        []*BlockGCode{{Body: "G28 ; home\nG1 X1 Y2\n"}},
+	}
+	for _, opts := range [][]EncodeOption{
+		nil,
+		{WithCompression(BlockHeaderCompressionDeflate)},
+		{WithCompression(BlockHeaderCompressionHeatshrink114), WithGCodeEncoding(GCodeEncodingMeatpack)},
+		{WithCompression(BlockHeaderCompressionHeatshrink124), WithGCodeEncoding(GCodeEncodingMeatpackWithComments)},
+		{WithChecksumType(ChecksumTypeNone)},
+	} {
+		data, err := Marshal(small, opts...)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		gcode, err := ParseBytes(data, fuzzOptions...)
+		if err != nil {
+			return
+		}
+		if err := Verify(bytes.NewReader(data), fuzzOptions...); err != nil {
+			t.Errorf("Verify() = %v on an input Parse() accepts", err)
+		}
+		appended, err := AppendGCode(nil, bytes.NewReader(data), fuzzOptions...)
+		if err != nil || string(appended) != gcode {
+			t.Errorf("AppendGCode() = %v, does not match Parse()", err)
+		}
+	})
+}
+
+func FuzzINIDecode(f *testing.F) {
+	f.Add([]byte("Producer=PrusaSlicer 2.6.0\n"))
+	f.Add([]byte("a = 1\r\nb=x=y\n"))
+	f.Add([]byte("start_gcode = M862.3 P \"MINI\"\\nG90\n"))
+	f.Add(iniEncode(decodeFixtureMetadata(f)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		kvs, err := iniDecode(data)
+		if err != nil {
+			return
+		}
+		again, err := iniDecode(iniEncode(kvs))
+		if err != nil {
+			t.Fatalf("cannot decode re-encoded table: %v", err)
+		}
+		if diff := cmp.Diff(kvs, again); diff != "" {
+			t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func decodeFixtureMetadata(tb testing.TB) KeyValues {
+	tb.Helper()
+	fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer fd.Close()
+	m, err := DecodeMetadata(fd)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return m.Slicer
+}
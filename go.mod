@@ -2,6 +2,4 @@ module cirello.io/bgcodego
 
 go 1.21.4
 
-require github.com/currantlabs/goheatshrink v0.0.0-20160222053524-0b7b0de0f241
-
-require github.com/google/go-cmp v0.6.0 // indirect
+require github.com/google/go-cmp v0.6.0
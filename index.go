@@ -0,0 +1,94 @@
+package bgcodego
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// FileIndex describes the layout of a BGCode file, so that any of its blocks
+// can be read without going through the blocks before it.
+type FileIndex struct {
+	Header FileHeader
+	Blocks []BlockInfo
+}
+
+// BlockInfo locates a block within a BGCode file.
+type BlockInfo struct {
+	Header *BlockHeader
+	Index  int   // Position of the block in the file, starting at 0
+	Offset int64 // Position of the block header in the input
+	Size   int64 // Size of the whole block, from its header to its checksum
+}
+
+// Index builds the index of a BGCode input by reading the block headers
+// only: block contents are neither read nor verified. Blocks of unknown type
+// are indexed as well, provided that the layout of the file defines the size
+// of their parameters, as Version1 does.
+func Index(r io.ReaderAt) (*FileIndex, error) {
+	sr := io.NewSectionReader(r, 0, math.MaxInt64)
+	cr := &countingReader{r: sr}
+	fi := &FileIndex{}
+	if err := fi.Header.Parse(cr); err != nil {
+		return nil, fmt.Errorf("cannot parse file header: %w", err)
+	}
+	checksumSize := int64(fi.Header.ChecksumType.Size())
+	for idx := 0; ; idx++ {
+		bi := BlockInfo{
+			Header: &BlockHeader{fileLayout: fi.Header.layout(), offset: cr.n},
+			Index:  idx,
+			Offset: cr.n,
+		}
+		err := bi.Header.Parse(cr)
+		if errors.Is(err, io.EOF) {
+			return fi, nil
+		} else if err != nil && !skippable(err) {
+			return nil, &BlockError{Type: bi.Header.Type(), Index: idx, Offset: bi.Offset, At: cr.n, Err: fmt.Errorf("cannot parse block header: %w", err)}
+		}
+		end := cr.n + int64(bi.Header.ParametersSize()) + int64(bi.Header.Length()) + checksumSize
+		// ReadAt may report io.EOF along with the last byte of the input.
+		if n, err := r.ReadAt(make([]byte, 1), end-1); n != 1 {
+			if err == nil || errors.Is(err, io.EOF) {
+				err = fmt.Errorf("truncated block: %w", io.ErrUnexpectedEOF)
+			}
+			return nil, &BlockError{Type: bi.Header.Type(), Index: idx, Offset: bi.Offset, At: cr.n, Err: err}
+		}
+		if _, err := sr.Seek(end, io.SeekStart); err != nil {
+			return nil, err
+		}
+		cr.n = end
+		bi.Size = end - bi.Offset
+		fi.Blocks = append(fi.Blocks, bi)
+	}
+}
+
+// Find returns the first indexed block of the given type, if any.
+func (fi *FileIndex) Find(bht BlockHeaderType) (BlockInfo, bool) {
+	for _, bi := range fi.Blocks {
+		if bi.Header.Type() == bht {
+			return bi, true
+		}
+	}
+	return BlockInfo{}, false
+}
+
+// ReadBlock decodes the i-th indexed block of r, verifying its checksum. It
+// returns the same types as Block.Decode.
+func (fi *FileIndex) ReadBlock(r io.ReaderAt, i int, opts ...DecodeOption) (BlockRenderer, error) {
+	if i < 0 || i >= len(fi.Blocks) {
+		return nil, fmt.Errorf("block #%d out of range: file has %d blocks", i, len(fi.Blocks))
+	}
+	bi := fi.Blocks[i]
+	br := &Reader{
+		Header: fi.Header,
+		o:      newDecodeOptions(opts),
+		cr:     &countingReader{r: io.NewSectionReader(r, bi.Offset, bi.Size), n: bi.Offset},
+		idx:    bi.Index,
+	}
+	b, err := br.NextBlock()
+	if err != nil {
+		return nil, err
+	}
+	return b.Decode()
+}
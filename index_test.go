@@ -0,0 +1,107 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIndex(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	fi, err := Index(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	var offsets []int64
+	var size int64 = 10
+	for i, bi := range fi.Blocks {
+		if bi.Index != i {
+			t.Errorf("unexpected block index: %v", bi.Index)
+		}
+		offsets = append(offsets, bi.Offset)
+		size += bi.Size
+	}
+	want := []int64{10, 51, 410, 889, 5743, 6005, 9406, 23961, 38899, 53384, 67984, 82456, 97611, 112133, 127356, 141890}
+	if diff := cmp.Diff(want, offsets); diff != "" {
+		t.Errorf("block offsets mismatch (-want +got):\n%s", diff)
+	}
+	if size != int64(len(bgcode)) {
+		t.Errorf("block sizes add up to %d, want %d", size, len(bgcode))
+	}
+	for _, bi := range fi.Blocks {
+		if f := bi.Header.Fields(); f.Offset != bi.Offset || f.Type != bi.Header.Type() || f.CompressedSize != bi.Header.Length() {
+			t.Errorf("block %d: unexpected header fields: %+v", bi.Index, f)
+		}
+	}
+	gcode := fi.Blocks[6].Header.Fields()
+	if want := (BlockHeaderFields{
+		Type:             BlockHeaderTypeGCode,
+		Compression:      BlockHeaderCompressionHeatshrink124,
+		UncompressedSize: gcode.UncompressedSize,
+		CompressedSize:   uint32(fi.Blocks[6].Size) - 12 - 2 - 4,
+		Offset:           9406,
+	}); gcode != want {
+		t.Errorf("unexpected G-code header fields: %+v, want %+v", gcode, want)
+	}
+
+	bi, ok := fi.Find(BlockHeaderTypePrintMetadata)
+	if !ok || bi.Index != 4 {
+		t.Fatalf("unexpected print metadata block: %+v", bi)
+	}
+	block, err := fi.ReadBlock(bytes.NewReader(bgcode), bi.Index)
+	checkErr(t, err)
+	if got := block.(*BlockPrintMetadata).Values.First("filament used [g]"); got != "3.01" {
+		t.Errorf("unexpected print metadata: %v", got)
+	}
+	if _, err := fi.ReadBlock(bytes.NewReader(bgcode), len(fi.Blocks)); err == nil {
+		t.Error("expected error for out of range block")
+	}
+
+	corrupted := bytes.Clone(bgcode)
+	corrupted[900] ^= 0xFF // inside the second thumbnail
+	block, err = fi.ReadBlock(bytes.NewReader(corrupted), 2)
+	checkErr(t, err)
+	if block.(*BlockThumbnail).Width() != 16 {
+		t.Error("unexpected thumbnail")
+	}
+	var blockErr *BlockError
+	if _, err := fi.ReadBlock(bytes.NewReader(corrupted), 3); !errors.As(err, &blockErr) || !errors.Is(err, ErrBadChecksum) || blockErr.Offset != 889 {
+		t.Errorf("expected ErrBadChecksum at offset 889, got: %v", err)
+	}
+
+	if _, err := Index(bytes.NewReader(bgcode[:len(bgcode)-1])); !errors.As(err, &blockErr) || blockErr.Index != 15 {
+		t.Errorf("expected truncated last block, got: %v", err)
+	}
+
+	// io.ReaderAt implementations may return io.EOF with the last byte.
+	eofIdx, err := Index(eofReaderAt{bytes.NewReader(bgcode)})
+	checkErr(t, err)
+	if len(eofIdx.Blocks) != len(fi.Blocks) {
+		t.Errorf("Index() with io.EOF at the end = %d blocks, want %d", len(eofIdx.Blocks), len(fi.Blocks))
+	}
+}
+
+// eofReaderAt returns io.EOF along with the bytes that reach the end of r.
+type eofReaderAt struct{ r *bytes.Reader }
+
+func (er eofReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := er.r.ReadAt(p, off)
+	if err == nil && off+int64(n) == er.r.Size() {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func TestIndex_unknownBlock(t *testing.T) {
+	fd, err := os.Open("_testdata/future_block.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	fi, err := Index(fd)
+	checkErr(t, err)
+	if len(fi.Blocks) != 3 || fi.Blocks[1].Header.Type() != 99 || fi.Blocks[2].Offset != 90 {
+		t.Errorf("unexpected index: %+v", fi.Blocks)
+	}
+}
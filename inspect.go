@@ -0,0 +1,139 @@
+package bgcodego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Report describes the layout of a BGCode file, as returned by Inspect.
+type Report struct {
+	Version      FileHeaderVersion `json:"version"`
+	ChecksumType ChecksumType      `json:"checksum_type"`
+	Size         int64             `json:"size"` // Bytes read from the input
+	Blocks       []BlockReport     `json:"blocks"`
+	Stats        BlockStats        `json:"stats"`
+}
+
+// BlockReport describes a block of a BGCode file.
+type BlockReport struct {
+	BlockHeaderFields
+	Index            int            `json:"index"`             // Position of the block in the file, starting at 0
+	Size             int64          `json:"size"`              // Size of the block, from its header to its footer
+	CompressionRatio float64        `json:"compression_ratio"` // Uncompressed size over compressed size
+	Checksum         ChecksumStatus `json:"checksum"`
+
+	// Thumbnail describes the image of thumbnail blocks.
+	Thumbnail *ThumbnailInfo `json:"thumbnail,omitempty"`
+}
+
+// ThumbnailInfo describes the image of a thumbnail block.
+type ThumbnailInfo struct {
+	Format BlockThumbnailFormat `json:"format"`
+	Width  int                  `json:"width"`
+	Height int                  `json:"height"`
+}
+
+// ChecksumStatus reports whether the checksum footer of a block matches its
+// contents.
+type ChecksumStatus int
+
+// Checksum statuses reported by Inspect.
+const (
+	ChecksumAbsent   ChecksumStatus = iota // The file has no checksums
+	ChecksumOK                             // The footer matches the block
+	ChecksumMismatch                       // The footer does not match the block
+)
+
+func (cs ChecksumStatus) String() string {
+	switch cs {
+	case ChecksumAbsent:
+		return "absent"
+	case ChecksumOK:
+		return "ok"
+	case ChecksumMismatch:
+		return "mismatch"
+	default:
+		return fmt.Sprintf("ChecksumStatus(%d)", int(cs))
+	}
+}
+
+// MarshalText encodes the status as reported by String.
+func (cs ChecksumStatus) MarshalText() ([]byte, error) {
+	return []byte(cs.String()), nil
+}
+
+// UnmarshalText decodes a status encoded by MarshalText.
+func (cs *ChecksumStatus) UnmarshalText(text []byte) error {
+	for _, status := range []ChecksumStatus{ChecksumAbsent, ChecksumOK, ChecksumMismatch} {
+		if string(text) == status.String() {
+			*cs = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown checksum status %q", text)
+}
+
+// Inspect lists the blocks of a BGCode input without decoding them, checking
+// their checksums. Blocks of unknown type are listed as well, and blocks
+// whose checksum does not match are reported rather than failing the
+// inspection. On error, the report lists the blocks read so far.
+func Inspect(r io.Reader) (*Report, error) {
+	capture := &bytes.Buffer{}
+	o := newDecodeOptions(nil)
+	o.SkipChecksum = true
+	o.SkipUnknownBlocks = true
+	br, err := newReader(io.TeeReader(r, capture), o)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Version:      br.Header.Version,
+		ChecksumType: br.Header.ChecksumType,
+		Blocks:       []BlockReport{},
+	}
+	for {
+		capture.Reset()
+		b, err := br.nextBlock()
+		report.Size = br.cr.n
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		} else if err != nil {
+			return report, err
+		}
+		br.cur = b
+		headerSize := capture.Len()
+		if err := b.Skip(); err != nil {
+			report.Size = br.cr.n
+			return report, err
+		}
+		hdr := b.Header
+		block := capture.Bytes()
+		rep := BlockReport{
+			BlockHeaderFields: hdr.Fields(),
+			Index:             b.Index,
+			Size:              int64(len(block)),
+			CompressionRatio:  1,
+		}
+		if hdr.Length() > 0 {
+			rep.CompressionRatio = float64(hdr.UncompressedSize()) / float64(hdr.Length())
+		}
+		if _, footer, computed := report.ChecksumType.checkFooter(block); footer != nil {
+			rep.Checksum = ChecksumOK
+			if !bytes.Equal(footer, computed) {
+				rep.Checksum = ChecksumMismatch
+			}
+		}
+		if params := block[headerSize:]; hdr.Type() == BlockHeaderTypeThumbnail && len(params) >= 6 {
+			rep.Thumbnail = &ThumbnailInfo{
+				Format: BlockThumbnailFormat(binary.LittleEndian.Uint16(params)),
+				Width:  int(binary.LittleEndian.Uint16(params[2:])),
+				Height: int(binary.LittleEndian.Uint16(params[4:])),
+			}
+		}
+		report.Blocks = append(report.Blocks, rep)
+		report.Stats.add(hdr)
+	}
+}
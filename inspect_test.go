@@ -0,0 +1,78 @@
+package bgcodego
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInspect(t *testing.T) {
+	input, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	report, err := Inspect(bytes.NewReader(input))
+	checkErr(t, err)
+	if report.Version != Version1 || report.ChecksumType != ChecksumTypeCRC32 || report.Size != int64(len(input)) {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(report.Blocks) != 16 {
+		t.Fatalf("unexpected block count: %d", len(report.Blocks))
+	}
+	offset := int64(10)
+	for i, b := range report.Blocks {
+		if b.Index != i || b.Offset != offset || b.Checksum != ChecksumOK {
+			t.Errorf("unexpected block report: %+v", b)
+		}
+		offset += b.Size
+	}
+	want := BlockReport{
+		BlockHeaderFields: BlockHeaderFields{
+			Type:             BlockHeaderTypeThumbnail,
+			Compression:      BlockHeaderCompressionNone,
+			UncompressedSize: 461,
+			CompressedSize:   461,
+			Offset:           410,
+		},
+		Index:            2,
+		Size:             8 + 6 + 461 + 4,
+		CompressionRatio: 1,
+		Checksum:         ChecksumOK,
+		Thumbnail:        &ThumbnailInfo{Format: BlockThumbnailFormatPNG, Width: 16, Height: 16},
+	}
+	if diff := cmp.Diff(want, report.Blocks[2]); diff != "" {
+		t.Errorf("unexpected thumbnail report (-want +got):\n%s", diff)
+	}
+	if gcode := report.Blocks[6]; gcode.Type != BlockHeaderTypeGCode || gcode.CompressionRatio <= 1 {
+		t.Errorf("unexpected G-code block report: %+v", gcode)
+	}
+
+	damaged := bytes.Clone(input)
+	damaged[report.Blocks[7].Offset-1] ^= 0xff
+	report, err = Inspect(bytes.NewReader(damaged))
+	checkErr(t, err)
+	for i, b := range report.Blocks {
+		wantStatus := ChecksumOK
+		if i == 6 {
+			wantStatus = ChecksumMismatch
+		}
+		if b.Checksum != wantStatus {
+			t.Errorf("block %d: unexpected checksum status %v", i, b.Checksum)
+		}
+	}
+
+	out, err := json.Marshal(report.Blocks[6])
+	checkErr(t, err)
+	if !strings.Contains(string(out), `"checksum":"mismatch"`) {
+		t.Errorf("unexpected JSON: %s", out)
+	}
+
+	report, err = Inspect(bytes.NewReader(input[:report.Blocks[3].Offset+20]))
+	if !errors.Is(err, io.ErrUnexpectedEOF) || len(report.Blocks) != 3 {
+		t.Errorf("expected partial report and ErrUnexpectedEOF, got %d blocks and %v", len(report.Blocks), err)
+	}
+}
@@ -0,0 +1,310 @@
+// Package heatshrink implements the heatshrink LZSS compression format, as
+// used by the Heatshrink114 and Heatshrink124 block compressions of BGCode.
+//
+// The stream is a sequence of bits, most significant first. A 1 bit is
+// followed by a literal byte. A 0 bit is followed by a back-reference: the
+// distance to copy from minus one, on window bits, and the number of bytes
+// to copy minus one, on lookahead bits. The last byte is padded with zero
+// bits.
+//
+// https://github.com/atomicobject/heatshrink
+package heatshrink
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Valid ranges of the window and lookahead sizes, in bits, as enforced by
+// the reference implementation.
+const (
+	MinWindow    = 4
+	MaxWindow    = 15
+	MinLookahead = 3
+)
+
+func checkParams(window, lookahead uint8) {
+	if window < MinWindow || window > MaxWindow || lookahead < MinLookahead || lookahead >= window {
+		panic("heatshrink: invalid window or lookahead size")
+	}
+}
+
+// Reader decompresses a heatshrink stream.
+type Reader struct {
+	r         io.ByteReader
+	br        *bufio.Reader // buffers readers that are not io.ByteReader
+	window    []byte
+	windowLen uint8
+	lookahead uint8
+	pos       int // number of bytes produced, modulo the window size
+
+	bits  uint32 // pending input bits, right-aligned
+	nbits uint8
+
+	copyLeft     int // bytes of the current back-reference left to copy
+	copyDistance int
+	err          error
+}
+
+// NewReader returns a Reader decompressing r with windows of 2^window bytes
+// and back-references of up to 2^lookahead bytes. It panics if the sizes
+// are out of range.
+func NewReader(r io.Reader, window, lookahead uint8) *Reader {
+	checkParams(window, lookahead)
+	hr := &Reader{
+		window:    make([]byte, 1<<window),
+		windowLen: window,
+		lookahead: lookahead,
+	}
+	hr.Reset(r)
+	return hr
+}
+
+// Reset discards the state of the Reader, and makes it decompress r.
+func (hr *Reader) Reset(r io.Reader) {
+	if br, ok := r.(io.ByteReader); ok {
+		hr.r = br
+	} else if hr.br != nil {
+		hr.br.Reset(r)
+		hr.r = hr.br
+	} else {
+		hr.br = bufio.NewReader(r)
+		hr.r = hr.br
+	}
+	clear(hr.window)
+	hr.pos, hr.bits, hr.nbits = 0, 0, 0
+	hr.copyLeft, hr.copyDistance = 0, 0
+	hr.err = nil
+}
+
+// readBits reads the next n bits of the input, n being at most 16. It
+// reports false at the end of the input, or on errors, which are recorded.
+func (hr *Reader) readBits(n uint8) (uint32, bool) {
+	for hr.nbits < n {
+		c, err := hr.r.ReadByte()
+		if err != nil {
+			hr.err = err
+			return 0, false
+		}
+		hr.bits = hr.bits<<8 | uint32(c)
+		hr.nbits += 8
+	}
+	hr.nbits -= n
+	v := hr.bits >> hr.nbits & (1<<n - 1)
+	hr.bits &= 1<<hr.nbits - 1
+	return v, true
+}
+
+// Read decompresses up to len(p) bytes into p. The end of the input is
+// reported as io.EOF; leftover bits that do not make up a whole literal or
+// back-reference are taken as padding.
+func (hr *Reader) Read(p []byte) (int, error) {
+	mask := len(hr.window) - 1
+	n := 0
+	for n < len(p) {
+		if hr.copyLeft > 0 {
+			c := hr.window[(hr.pos-hr.copyDistance)&mask]
+			hr.window[hr.pos&mask] = c
+			hr.pos++
+			p[n] = c
+			n++
+			hr.copyLeft--
+			continue
+		}
+		if hr.err != nil {
+			break
+		}
+		tag, ok := hr.readBits(1)
+		if !ok {
+			break
+		}
+		if tag == 1 {
+			v, ok := hr.readBits(8)
+			if !ok {
+				break
+			}
+			hr.window[hr.pos&mask] = byte(v)
+			hr.pos++
+			p[n] = byte(v)
+			n++
+			continue
+		}
+		distance, ok := hr.readBits(hr.windowLen)
+		if !ok {
+			break
+		}
+		count, ok := hr.readBits(hr.lookahead)
+		if !ok {
+			break
+		}
+		hr.copyDistance, hr.copyLeft = int(distance)+1, int(count)+1
+	}
+	if n > 0 || len(p) == 0 {
+		return n, nil
+	}
+	if errors.Is(hr.err, io.EOF) {
+		return 0, io.EOF
+	}
+	return 0, hr.err
+}
+
+// Writer compresses data into a heatshrink stream. Data is buffered until a
+// full lookahead is available, and flushed by Close.
+type Writer struct {
+	w         *bufio.Writer
+	windowLen uint8
+	lookahead uint8
+
+	// buf holds the last window of data written, followed by the data
+	// yet to be compressed, which starts at buf[pending]. Absolute
+	// positions in the stream are offset by base.
+	buf     []byte
+	pending int
+	base    int64
+
+	// head maps the first two bytes of a sequence to the position of
+	// its last occurrence, and prev chains each position to the previous
+	// occurrence of its first two bytes.
+	head map[uint16]int64
+	prev []int64
+
+	bits  uint32
+	nbits uint8
+	err   error
+}
+
+// NewWriter returns a Writer compressing to w with windows of 2^window bytes
+// and back-references of up to 2^lookahead bytes. It panics if the sizes
+// are out of range.
+func NewWriter(w io.Writer, window, lookahead uint8) *Writer {
+	checkParams(window, lookahead)
+	hw := &Writer{
+		w:         bufio.NewWriter(w),
+		windowLen: window,
+		lookahead: lookahead,
+		head:      make(map[uint16]int64),
+		prev:      make([]int64, 1<<window),
+	}
+	return hw
+}
+
+// Write compresses p, keeping back the last lookahead of data, which may
+// still match what comes next.
+func (hw *Writer) Write(p []byte) (int, error) {
+	if hw.err != nil {
+		return 0, hw.err
+	}
+	hw.buf = append(hw.buf, p...)
+	hw.compress(1 << hw.lookahead)
+	return len(p), hw.err
+}
+
+// Close compresses the remaining data and flushes the stream, without
+// closing the underlying writer.
+func (hw *Writer) Close() error {
+	if hw.err != nil {
+		return hw.err
+	}
+	hw.compress(0)
+	if hw.nbits > 0 {
+		hw.writeBits(0, 8-hw.nbits)
+	}
+	if hw.err != nil {
+		return hw.err
+	}
+	return hw.w.Flush()
+}
+
+// compress encodes the pending data, leaving keep bytes for later.
+func (hw *Writer) compress(keep int) {
+	windowSize := len(hw.prev)
+	maxMatch := 1 << hw.lookahead
+	// A back-reference pays off when it is shorter than the literals it
+	// replaces.
+	minMatch := (1+int(hw.windowLen)+int(hw.lookahead))/9 + 1
+	for len(hw.buf)-hw.pending > keep && hw.err == nil {
+		pos := hw.base + int64(hw.pending)
+		length, distance := hw.longestMatch(pos, windowSize, maxMatch)
+		if length >= minMatch {
+			hw.writeBits(0, 1)
+			hw.writeBits(uint32(distance-1), hw.windowLen)
+			hw.writeBits(uint32(length-1), hw.lookahead)
+		} else {
+			length = 1
+			hw.writeBits(1, 1)
+			hw.writeBits(uint32(hw.buf[hw.pending]), 8)
+		}
+		for i := 0; i < length; i++ {
+			hw.insert(pos + int64(i))
+		}
+		hw.pending += length
+	}
+	// Drop what slid out of the window, once it is worth the copy.
+	if drop := hw.pending - windowSize; drop >= windowSize {
+		hw.buf = hw.buf[:copy(hw.buf, hw.buf[drop:])]
+		hw.pending -= drop
+		hw.base += int64(drop)
+	}
+}
+
+// at returns the byte at absolute position pos.
+func (hw *Writer) at(pos int64) byte {
+	return hw.buf[pos-hw.base]
+}
+
+// insert records the sequence at absolute position pos in the hash chains.
+func (hw *Writer) insert(pos int64) {
+	i := pos - hw.base
+	if i+1 >= int64(len(hw.buf)) {
+		return
+	}
+	key := uint16(hw.buf[i])<<8 | uint16(hw.buf[i+1])
+	prev, ok := hw.head[key]
+	if !ok {
+		prev = -1
+	}
+	hw.prev[pos&int64(len(hw.prev)-1)] = prev
+	hw.head[key] = pos
+}
+
+// longestMatch finds the longest sequence of the window that matches the
+// data at pos, preferring the closest one.
+func (hw *Writer) longestMatch(pos int64, windowSize, maxMatch int) (length, distance int) {
+	avail := len(hw.buf) - int(pos-hw.base)
+	if avail < 2 {
+		return 0, 0
+	}
+	maxMatch = min(maxMatch, avail)
+	key := uint16(hw.at(pos))<<8 | uint16(hw.at(pos+1))
+	cand, ok := hw.head[key]
+	if !ok {
+		return 0, 0
+	}
+	cur := hw.buf[pos-hw.base:]
+	for cand < pos && pos-cand < int64(windowSize) && cand >= hw.base {
+		c := hw.buf[cand-hw.base:]
+		n := 0
+		for n < maxMatch && c[n] == cur[n] {
+			n++
+		}
+		if n > length {
+			length, distance = n, int(pos-cand)
+			if n == maxMatch {
+				break
+			}
+		}
+		cand = hw.prev[cand&int64(len(hw.prev)-1)]
+	}
+	return length, distance
+}
+
+func (hw *Writer) writeBits(v uint32, n uint8) {
+	hw.bits = hw.bits<<n | v
+	hw.nbits += n
+	for hw.nbits >= 8 && hw.err == nil {
+		hw.nbits -= 8
+		hw.err = hw.w.WriteByte(byte(hw.bits >> hw.nbits))
+		hw.bits &= 1<<hw.nbits - 1
+	}
+}
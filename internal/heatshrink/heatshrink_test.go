@@ -0,0 +1,115 @@
+package heatshrink
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+func compress(t testing.TB, data []byte, window, lookahead uint8, chunk int) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf, window, lookahead)
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	gcode, err := os.ReadFile("../../_testdata/mini_cube_b.gcode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(random)
+	inputs := map[string][]byte{
+		"empty":  nil,
+		"byte":   {'G'},
+		"zeros":  make([]byte, 5000),
+		"random": random,
+		"gcode":  gcode,
+	}
+	for name, data := range inputs {
+		for _, params := range [][2]uint8{{11, 4}, {12, 4}, {8, 4}} {
+			for _, chunk := range []int{1, 7, 1 << 20} {
+				compressed := compress(t, data, params[0], params[1], chunk)
+				r := NewReader(iotest.OneByteReader(bytes.NewReader(compressed)), params[0], params[1])
+				got, err := io.ReadAll(iotest.OneByteReader(r))
+				if err != nil {
+					t.Fatalf("%s %v: %v", name, params, err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("%s %v, chunks of %d: round trip mismatch", name, params, chunk)
+				}
+			}
+		}
+	}
+	if compressed := compress(t, gcode, 12, 4, 4096); len(compressed) > len(gcode)/2 {
+		t.Errorf("poor compression of G-code: %d bytes out of %d", len(compressed), len(gcode))
+	}
+}
+
+func TestReader(t *testing.T) {
+	// "abcabcabc" as the literals "abc" and a back-reference of 6 bytes at
+	// distance 3, with 11/4 parameters.
+	var bits []byte
+	for _, c := range "abc" {
+		bits = append(bits, 1)
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, byte(c)>>i&1)
+		}
+	}
+	bits = append(bits, 0)
+	for i := 10; i >= 0; i-- {
+		bits = append(bits, 2>>i&1)
+	}
+	for i := 3; i >= 0; i-- {
+		bits = append(bits, 5>>i&1)
+	}
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		packed[i/8] |= b << (7 - i%8)
+	}
+	r := NewReader(bytes.NewReader(packed), 11, 4)
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "abcabcabc" {
+		t.Errorf("ReadAll() = %q, %v", got, err)
+	}
+
+	r.Reset(bytes.NewReader(packed[:4]))
+	if got, err := io.ReadAll(r); err != nil || string(got) != "abc" {
+		t.Errorf("ReadAll() of truncated input = %q, %v", got, err)
+	}
+}
+
+func TestNewWriter_invalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	NewWriter(io.Discard, 4, 4)
+}
+
+func BenchmarkWriter(b *testing.B) {
+	gcode, err := os.ReadFile("../../_testdata/mini_cube_b.gcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(gcode)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		compress(b, gcode, 12, 4, 64<<10)
+	}
+}
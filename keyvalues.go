@@ -0,0 +1,250 @@
+package bgcodego
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrKeyNotFound is returned when a key is missing from a key-value table.
+var ErrKeyNotFound = errors.New("key not found")
+
+// Lookup returns the value of the first occurrence of key, and whether it
+// was found.
+func (kv KeyValues) Lookup(key string) (string, bool) {
+	idx := kv.index(key)
+	if idx == -1 {
+		return "", false
+	}
+	return kv[idx].Value, true
+}
+
+// Has reports whether key is present.
+func (kv KeyValues) Has(key string) bool {
+	return kv.index(key) != -1
+}
+
+// All returns the values of every occurrence of key, in order.
+func (kv KeyValues) All(key string) []string {
+	var ret []string
+	for _, v := range kv {
+		if v.Key == key {
+			ret = append(ret, v.Value)
+		}
+	}
+	return ret
+}
+
+// Int parses the value of key as an integer.
+func (kv KeyValues) Int(key string) (int, error) {
+	v, err := kv.required(key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q: %w", key, err)
+	}
+	return n, nil
+}
+
+// Float parses the value of key as a floating point number.
+func (kv KeyValues) Float(key string) (float64, error) {
+	v, err := kv.required(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q: %w", key, err)
+	}
+	return f, nil
+}
+
+// Floats parses the value of key as a list of floating point numbers, such
+// as the per-extruder values PrusaSlicer separates with commas or
+// semicolons.
+func (kv KeyValues) Floats(key string) ([]float64, error) {
+	v, err := kv.required(key)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := splitFloats(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %w", key, err)
+	}
+	return ret, nil
+}
+
+// Strings parses the value of key as a list of strings, such as the
+// per-extruder filament types PrusaSlicer separates with semicolons and
+// quotes when needed.
+func (kv KeyValues) Strings(key string) ([]string, error) {
+	v, err := kv.required(key)
+	if err != nil {
+		return nil, err
+	}
+	return splitStrings(v), nil
+}
+
+// Duration parses the value of key as a duration formatted by PrusaSlicer,
+// such as "1d 2h 3m 4s".
+func (kv KeyValues) Duration(key string) (time.Duration, error) {
+	v, err := kv.required(key)
+	if err != nil {
+		return 0, err
+	}
+	d, err := parseSlicerDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q: %w", key, err)
+	}
+	return d, nil
+}
+
+// Bool parses the value of key as a boolean, such as "1", "0", "true" or
+// "false".
+func (kv KeyValues) Bool(key string) (bool, error) {
+	v, err := kv.required(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse %q: %w", key, err)
+	}
+	return b, nil
+}
+
+// Set replaces the value of key, reporting whether it was found. The first
+// occurrence of key keeps its position and takes value, and any later
+// occurrence is removed. Missing keys are left out; see Upsert.
+func (kv *KeyValues) Set(key, value string) bool {
+	idx := kv.index(key)
+	if idx == -1 {
+		return false
+	}
+	(*kv)[idx].Value = value
+	rest := (*kv)[idx+1:]
+	*kv = (*kv)[:idx+1+len(slices.DeleteFunc(rest, func(v KeyValue) bool { return v.Key == key }))]
+	return true
+}
+
+// Upsert sets the value of key as Set does, appending the key when missing.
+func (kv *KeyValues) Upsert(key, value string) {
+	if !kv.Set(key, value) {
+		kv.Append(key, value)
+	}
+}
+
+// Append adds an occurrence of key at the end of the table, after any
+// existing one.
+func (kv *KeyValues) Append(key, value string) {
+	*kv = append(*kv, KeyValue{Key: key, Value: value})
+}
+
+// Delete removes every occurrence of key, keeping the order of the other
+// keys, and returns the number of occurrences removed.
+func (kv *KeyValues) Delete(key string) int {
+	n := len(*kv)
+	*kv = slices.DeleteFunc(*kv, func(v KeyValue) bool { return v.Key == key })
+	return n - len(*kv)
+}
+
+func (kv KeyValues) required(key string) (string, error) {
+	v, ok := kv.Lookup(key)
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	return strings.TrimSpace(v), nil
+}
+
+// MarshalJSON encodes the table as a JSON object whose members follow the
+// order in which keys first appear. Keys that occur more than once are
+// encoded as an array of their values, in order.
+func (kv KeyValues) MarshalJSON() ([]byte, error) {
+	if kv == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	seen := make(map[string]bool, len(kv))
+	for _, v := range kv {
+		if seen[v.Key] {
+			continue
+		}
+		seen[v.Key] = true
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(v.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		var value []byte
+		if values := kv.All(v.Key); len(values) > 1 {
+			value, err = json.Marshal(values)
+		} else {
+			value, err = json.Marshal(v.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a JSON object produced by MarshalJSON, keeping the
+// order of its members. Arrays of strings are decoded as repeated keys.
+func (kv *KeyValues) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*kv = nil
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("cannot decode key-value table: unexpected %v", tok)
+	}
+	ret := KeyValues{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		var values []string
+		if len(raw) > 0 && raw[0] == '[' {
+			if err := json.Unmarshal(raw, &values); err != nil {
+				return fmt.Errorf("cannot decode %q: %w", key, err)
+			}
+		} else {
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return fmt.Errorf("cannot decode %q: %w", key, err)
+			}
+			values = []string{value}
+		}
+		for _, value := range values {
+			ret = append(ret, KeyValue{Key: key, Value: value})
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	*kv = ret
+	return nil
+}
@@ -0,0 +1,162 @@
+package bgcodego
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKeyValues_typedGetters(t *testing.T) {
+	f := decodeFixture(t)
+	print := f.PrintMetadata.Values
+	if d, err := print.Duration("estimated printing time (normal mode)"); err != nil || d != 32*time.Minute+6*time.Second {
+		t.Errorf("Duration() = %v, %v", d, err)
+	}
+	if g, err := print.Float("filament used [g]"); err != nil || g != 3.01 {
+		t.Errorf("Float() = %v, %v", g, err)
+	}
+
+	kvs := KeyValues{
+		{Key: "perimeters", Value: "2"},
+		{Key: "ooze_prevention", Value: "0"},
+		{Key: "nozzle_diameter", Value: "0.4,0.6"},
+		{Key: "object", Value: "cube"},
+		{Key: "object", Value: "cylinder"},
+		{Key: "empty", Value: ""},
+		{Key: "filament used [g]", Value: "12.3, 0, 4.5"},
+		{Key: "filament_cost", Value: "25,,30"},
+		{Key: "filament_settings_id", Value: `"Prusament PETG";"Generic \"PLA\"; silk"`},
+	}
+	if n, err := kvs.Int("perimeters"); err != nil || n != 2 {
+		t.Errorf("Int() = %v, %v", n, err)
+	}
+	if b, err := kvs.Bool("ooze_prevention"); err != nil || b {
+		t.Errorf("Bool() = %v, %v", b, err)
+	}
+	if v, err := kvs.Floats("nozzle_diameter"); err != nil || !cmp.Equal(v, []float64{0.4, 0.6}) {
+		t.Errorf("Floats() = %v, %v", v, err)
+	}
+	if v, err := kvs.Floats("filament used [g]"); err != nil || !cmp.Equal(v, []float64{12.3, 0, 4.5}) {
+		t.Errorf("Floats() = %v, %v", v, err)
+	}
+	if v, err := kvs.Floats("filament_cost"); err != nil || !cmp.Equal(v, []float64{25, 0, 30}) {
+		t.Errorf("Floats() = %v, %v", v, err)
+	}
+	if v, err := kvs.Strings("filament_settings_id"); err != nil || !cmp.Equal(v, []string{"Prusament PETG", `Generic "PLA"; silk`}) {
+		t.Errorf("Strings() = %q, %v", v, err)
+	}
+	if diff := cmp.Diff([]string{"cube", "cylinder"}, kvs.All("object")); diff != "" {
+		t.Errorf("All() mismatch (-want +got):\n%s", diff)
+	}
+	if v, ok := kvs.Lookup("empty"); !ok || v != "" {
+		t.Errorf("Lookup() = %q, %v", v, ok)
+	}
+	if !kvs.Has("empty") || kvs.Has("missing") {
+		t.Error("unexpected Has() result")
+	}
+	if _, err := kvs.Int("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got: %v", err)
+	}
+	if _, err := kvs.Int("object"); err == nil {
+		t.Error("expected error parsing non-numeric value")
+	}
+}
+
+func TestKeyValues_JSON(t *testing.T) {
+	kv := KeyValues{
+		{Key: "b", Value: "1"},
+		{Key: "a", Value: "x \"quoted\""},
+		{Key: "b", Value: "2"},
+		{Key: "c", Value: ""},
+	}
+	got, err := json.Marshal(kv)
+	checkErr(t, err)
+	const want = `{"b":["1","2"],"a":"x \"quoted\"","c":""}`
+	if string(got) != want {
+		t.Errorf("Marshal() = %s, want %s", got, want)
+	}
+	var back KeyValues
+	checkErr(t, json.Unmarshal(got, &back))
+	want2 := KeyValues{
+		{Key: "b", Value: "1"},
+		{Key: "b", Value: "2"},
+		{Key: "a", Value: "x \"quoted\""},
+		{Key: "c", Value: ""},
+	}
+	if diff := cmp.Diff(want2, back); diff != "" {
+		t.Errorf("Unmarshal() mismatch (-want +got):\n%s", diff)
+	}
+	if err := json.Unmarshal([]byte(`{"a":1}`), &back); err == nil {
+		t.Error("Unmarshal() of a number succeeded")
+	}
+}
+
+func TestMetadata_JSON(t *testing.T) {
+	m := decodeFixture(t).Metadata()
+	got, err := json.Marshal(m)
+	checkErr(t, err)
+	var back Metadata
+	checkErr(t, json.Unmarshal(got, &back))
+	if diff := cmp.Diff(m, &back); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+	got, err = json.Marshal(&Metadata{File: KeyValues{{Key: "Producer", Value: "PrusaSlicer 2.6.0"}}})
+	checkErr(t, err)
+	if want := `{"file":{"Producer":"PrusaSlicer 2.6.0"}}`; string(got) != want {
+		t.Errorf("Marshal() = %s, want %s", got, want)
+	}
+}
+
+func TestKeyValues_mutations(t *testing.T) {
+	newTable := func() KeyValues {
+		return KeyValues{
+			{Key: "a", Value: "1"},
+			{Key: "b", Value: "2"},
+			{Key: "a", Value: "3"},
+			{Key: "c", Value: "4"},
+		}
+	}
+	tests := []struct {
+		name   string
+		mutate func(kv *KeyValues) any
+		want   KeyValues
+		result any
+	}{
+		{"set", func(kv *KeyValues) any { return kv.Set("b", "x") }, KeyValues{{Key: "a", Value: "1"}, {Key: "b", Value: "x"}, {Key: "a", Value: "3"}, {Key: "c", Value: "4"}}, true},
+		{"set duplicate", func(kv *KeyValues) any { return kv.Set("a", "x") }, KeyValues{{Key: "a", Value: "x"}, {Key: "b", Value: "2"}, {Key: "c", Value: "4"}}, true},
+		{"set missing", func(kv *KeyValues) any { return kv.Set("d", "x") }, newTable(), false},
+		{"upsert", func(kv *KeyValues) any { kv.Upsert("a", "x"); return nil }, KeyValues{{Key: "a", Value: "x"}, {Key: "b", Value: "2"}, {Key: "c", Value: "4"}}, nil},
+		{"upsert missing", func(kv *KeyValues) any { kv.Upsert("d", "x"); return nil }, append(newTable(), KeyValue{Key: "d", Value: "x"}), nil},
+		{"append", func(kv *KeyValues) any { kv.Append("b", "x"); return nil }, append(newTable(), KeyValue{Key: "b", Value: "x"}), nil},
+		{"delete", func(kv *KeyValues) any { return kv.Delete("a") }, KeyValues{{Key: "b", Value: "2"}, {Key: "c", Value: "4"}}, 2},
+		{"delete missing", func(kv *KeyValues) any { return kv.Delete("d") }, newTable(), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := newTable()
+			result := tt.mutate(&kv)
+			if diff := cmp.Diff(tt.want, kv); diff != "" {
+				t.Errorf("table mismatch (-want +got):\n%s", diff)
+			}
+			if result != tt.result {
+				t.Errorf("result = %v, want %v", result, tt.result)
+			}
+		})
+	}
+
+	t.Run("edit before encoding", func(t *testing.T) {
+		f := decodeFixture(t)
+		f.PrinterMetadata.Values.Set("filament_type", "PLA")
+		bgcode, err := Marshal(f)
+		checkErr(t, err)
+		got, err := Decode(bytes.NewReader(bgcode))
+		checkErr(t, err)
+		if v := got.PrinterMetadata.Values.First("filament_type"); v != "PLA" {
+			t.Errorf("filament_type = %q, want PLA", v)
+		}
+	})
+}
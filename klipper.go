@@ -0,0 +1,106 @@
+package bgcodego
+
+import (
+	"bytes"
+	"io"
+)
+
+// klipperWriter comments out the lines of G-code that only Prusa firmware
+// understands, so that Klipper does not stop on them: the printer model,
+// nozzle and firmware checks of the M862 family, and the firmware version
+// check of M115 U. Incomplete lines are held until their end is written, or
+// until flush.
+type klipperWriter struct {
+	w       io.Writer
+	partial []byte
+}
+
+func (kw *klipperWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(kw.partial) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			kw.partial = append(kw.partial, p...)
+			return n, nil
+		}
+		kw.partial = append(kw.partial, p[:i+1]...)
+		p = p[i+1:]
+		if err := kw.writeLines(kw.partial); err != nil {
+			return 0, err
+		}
+		kw.partial = kw.partial[:0]
+	}
+	i := bytes.LastIndexByte(p, '\n')
+	if err := kw.writeLines(p[:i+1]); err != nil {
+		return 0, err
+	}
+	kw.partial = append(kw.partial, p[i+1:]...)
+	return n, nil
+}
+
+// flush writes the last line, even if incomplete.
+func (kw *klipperWriter) flush() error {
+	err := kw.writeLines(kw.partial)
+	kw.partial = kw.partial[:0]
+	return err
+}
+
+// writeLines writes lines, commenting out those for Prusa firmware only.
+func (kw *klipperWriter) writeLines(lines []byte) error {
+	start := 0
+	for i := 0; i < len(lines); {
+		end := len(lines)
+		if j := bytes.IndexByte(lines[i:], '\n'); j >= 0 {
+			end = i + j + 1
+		}
+		if prusaOnly(lines[i:end]) {
+			if _, err := kw.w.Write(lines[start:i]); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(kw.w, "; "); err != nil {
+				return err
+			}
+			start = i
+		}
+		i = end
+	}
+	_, err := kw.w.Write(lines[start:])
+	return err
+}
+
+// prusaOnly reports whether a line of G-code is a command that only Prusa
+// firmware understands.
+func prusaOnly(line []byte) bool {
+	line = bytes.TrimLeft(line, " \t")
+	if !bytes.HasPrefix(line, []byte("M862")) && !bytes.HasPrefix(line, []byte("M115")) {
+		return false
+	}
+	if i := bytes.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	fields := bytes.Fields(line)
+	switch cmd := string(fields[0]); {
+	case cmd == "M862" || bytes.HasPrefix(fields[0], []byte("M862.")):
+		return true
+	case cmd == "M115":
+		for _, f := range fields[1:] {
+			if f[0] == 'U' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gcodeWriter returns the writer of the G-code section into out, along with
+// the function to call once the section is written.
+func (o *RenderOptions) gcodeWriter(out io.Writer) (io.Writer, func()) {
+	if !o.Klipper {
+		return out, func() {}
+	}
+	kw := &klipperWriter{w: out}
+	return kw, func() {
+		// Errors are retained by out, an errWriter.
+		kw.flush()
+	}
+}
@@ -0,0 +1,72 @@
+package bgcodego
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestKlipperWriter(t *testing.T) {
+	const input = "M862.3 P \"MINI\" ; printer model check\n" +
+		"  M862.1 P0.4\n" +
+		"M115 U5.1.0\n" +
+		"M115\n" +
+		"M8620\n" +
+		"G28 ; M862.3 in a comment\n" +
+		"M862.5 P2"
+	const want = "; M862.3 P \"MINI\" ; printer model check\n" +
+		";   M862.1 P0.4\n" +
+		"; M115 U5.1.0\n" +
+		"M115\n" +
+		"M8620\n" +
+		"G28 ; M862.3 in a comment\n" +
+		"; M862.5 P2"
+	for _, size := range []int{1, 3, 7, len(input)} {
+		out := &strings.Builder{}
+		kw := &klipperWriter{w: out}
+		for p := input; len(p) > 0; {
+			n := min(size, len(p))
+			if _, err := kw.Write([]byte(p[:n])); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		checkErr(t, kw.flush())
+		if out.String() != want {
+			t.Errorf("writes of %d bytes: got %q", size, out.String())
+		}
+	}
+}
+
+func TestWithKlipper(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f := decodeFixture(t)
+	out := &strings.Builder{}
+	checkErr(t, f.RenderTo(out, WithKlipper()))
+	got := out.String()
+	if !strings.Contains(got, "\n; M862.3 P \"MINI\"\n") || strings.Contains(got, "\nM862") {
+		t.Error("printer model check not commented out")
+	}
+	if want := strings.Replace(f.Render(), "\nM862.3", "\n; M862.3", 1); got != want {
+		t.Error("unexpected changes besides the printer model check")
+	}
+	parsed, err := Parse(bytes.NewReader(bgcode), WithRenderOptions(WithKlipper()))
+	checkErr(t, err)
+	if parsed != got {
+		t.Error("Parse output does not match RenderTo")
+	}
+
+	qoi, err := NewThumbnail(image.NewNRGBA(image.Rect(0, 0, 8, 8)), BlockThumbnailFormatQOI, 8, 8)
+	checkErr(t, err)
+	f = &File{Thumbnails: []*BlockThumbnail{qoi}}
+	out.Reset()
+	checkErr(t, f.RenderTo(out, WithKlipper()))
+	g, err := DecodeGCode(strings.NewReader(out.String()))
+	checkErr(t, err)
+	if !strings.Contains(out.String(), "; thumbnail begin 8x8 ") || len(g.Thumbnails) != 1 || g.Thumbnails[0].Format() != BlockThumbnailFormatPNG {
+		t.Errorf("thumbnail not rendered as PNG:\n%s", out)
+	}
+}
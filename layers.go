@@ -0,0 +1,172 @@
+package bgcodego
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNoLayers is returned when layer information is requested from G-code
+// without layer change markers nor extrusions.
+var ErrNoLayers = errors.New("no layer change markers found")
+
+// ErrNoGCode is returned when lines of G-code are requested from a file
+// without any.
+var ErrNoGCode = errors.New("no G-code found")
+
+// Layer locates the start of a print layer within the decoded G-code, as
+// marked by PrusaSlicer with a ;LAYER_CHANGE comment. In G-code without
+// markers, a layer starts at the Z move that precedes the first extrusion
+// above the previous layer.
+type Layer struct {
+	Number int     // Zero-based layer number
+	Z      float64 // Height of the layer, from the ;Z: comment that follows the marker
+	Line   int     // Zero-based line number of the marker or Z move
+	Offset int64   // Byte offset of the marker or Z move
+}
+
+// Layers returns the index of layers found in the decoded G-code. Line
+// numbers and offsets refer to the G-code of all blocks joined together.
+func (f *File) Layers() []Layer {
+	if len(f.layers) == 0 {
+		return f.zMoves.layers
+	}
+	return f.layers
+}
+
+// zMoveIndex indexes layers from Z moves, for G-code without layer change
+// markers.
+type zMoveIndex struct {
+	layers     []Layer
+	relative   bool // G91
+	z          float64
+	moveLine   int
+	moveOffset int64
+}
+
+func (f *File) indexLayer(line string) {
+	switch {
+	case strings.HasPrefix(line, ";LAYER_CHANGE"):
+		f.layers = append(f.layers, Layer{
+			Number: len(f.layers),
+			Line:   f.gcodeLines,
+			Offset: f.gcodeSize,
+		})
+		f.layerZPending = true
+	case f.layerZPending && strings.HasPrefix(line, ";Z:"):
+		f.layerZPending = false
+		z, err := strconv.ParseFloat(strings.TrimPrefix(line, ";Z:"), 64)
+		if err == nil {
+			f.layers[len(f.layers)-1].Z = z
+		}
+	case len(f.layers) == 0 && strings.HasPrefix(line, "G"):
+		f.indexZMove(line)
+	}
+}
+
+func (f *File) indexZMove(line string) {
+	zi := &f.zMoves
+	code, _, _ := strings.Cut(line, ";")
+	fields := strings.Fields(code)
+	switch fields[0] {
+	case "G90":
+		zi.relative = false
+	case "G91":
+		zi.relative = true
+	case "G0", "G1":
+		var moves, extrudes bool
+		for _, field := range fields[1:] {
+			v, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil {
+				continue
+			}
+			switch field[0] {
+			case 'X', 'Y':
+				moves = true
+			case 'E':
+				extrudes = v > 0
+			case 'Z':
+				if zi.relative {
+					zi.z += v
+				} else {
+					zi.z = v
+				}
+				zi.moveLine, zi.moveOffset = f.gcodeLines, f.gcodeSize
+			}
+		}
+		if !moves || !extrudes {
+			return
+		}
+		if n := len(zi.layers); n == 0 || zi.z > zi.layers[n-1].Z {
+			zi.layers = append(zi.layers, Layer{
+				Number: n,
+				Z:      zi.z,
+				Line:   zi.moveLine,
+				Offset: zi.moveOffset,
+			})
+		}
+	}
+}
+
+// GCodeLayerRange returns the G-code from the start of layer start up to the
+// end of layer end, both inclusive. When start is the first layer, the
+// preamble before it is included; when end is the last layer, everything
+// after it is included.
+func (f *File) GCodeLayerRange(start, end int) (string, error) {
+	gcode := &strings.Builder{}
+	f.writeGCode(gcode)
+	text := gcode.String()
+	// The layers are indexed anew, as the G-code blocks may have changed
+	// since they were decoded.
+	idx := &File{}
+	idx.addGCode(&BlockGCode{Body: text})
+	layers := idx.Layers()
+	if len(layers) == 0 {
+		return "", ErrNoLayers
+	}
+	if start < 0 || end >= len(layers) || start > end {
+		return "", fmt.Errorf("invalid layer range %d-%d: file has layers 0-%d", start, end, len(layers)-1)
+	}
+	from, to := int64(0), int64(len(text))
+	if start > 0 {
+		from = layers[start].Offset
+	}
+	if end < len(layers)-1 {
+		to = layers[end+1].Offset
+	}
+	return text[from:to], nil
+}
+
+// GCodeLineRange returns the G-code from line start up to line end, both
+// inclusive and zero-based, as numbered by Layer.Line. The range ends with
+// the line ending of line end, if any.
+func (f *File) GCodeLineRange(start, end int) (string, error) {
+	gcode := &strings.Builder{}
+	f.writeGCode(gcode)
+	text := gcode.String()
+	n := strings.Count(text, "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		n++
+	}
+	if n == 0 {
+		return "", ErrNoGCode
+	}
+	if start < 0 || end >= n || start > end {
+		return "", fmt.Errorf("invalid line range %d-%d: file has %d lines", start, end, n)
+	}
+	from, to := 0, 0
+	for line, i := 0, 0; line <= end; line++ {
+		if line == start {
+			from = i
+		}
+		j := strings.IndexByte(text[i:], '\n')
+		if j < 0 {
+			to = len(text)
+			break
+		}
+		i += j + 1
+		to = i
+	}
+	return text[from:to], nil
+}
@@ -0,0 +1,158 @@
+package bgcodego
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestFile_Layers(t *testing.T) {
+	f := decodeFixture(t)
+	layers := f.Layers()
+	if len(layers) != 120 {
+		t.Fatalf("expected 120 layers, got %d", len(layers))
+	}
+	gcode := &strings.Builder{}
+	f.writeGCode(gcode)
+	text := gcode.String()
+	lines := strings.Split(text, "\n")
+	for i, layer := range layers {
+		if layer.Number != i {
+			t.Errorf("layer %d: unexpected number %d", i, layer.Number)
+		}
+		if lines[layer.Line] != ";LAYER_CHANGE" {
+			t.Errorf("layer %d: line %d is %q", i, layer.Line, lines[layer.Line])
+		}
+		if !strings.HasPrefix(text[layer.Offset:], ";LAYER_CHANGE\n;Z:") {
+			t.Errorf("layer %d: offset %d does not point to a layer change", i, layer.Offset)
+		}
+	}
+	if layers[0].Z != 0.2 || layers[119].Z != 18.05 {
+		t.Errorf("unexpected layer heights: %v, %v", layers[0].Z, layers[119].Z)
+	}
+}
+
+func TestFile_GCodeLayerRange(t *testing.T) {
+	f := decodeFixture(t)
+	gcode := &strings.Builder{}
+	f.writeGCode(gcode)
+	text := gcode.String()
+	layers := f.Layers()
+
+	first, err := f.GCodeLayerRange(0, 9)
+	checkErr(t, err)
+	rest, err := f.GCodeLayerRange(10, len(layers)-1)
+	checkErr(t, err)
+	if first+rest != text {
+		t.Error("adjacent ranges should add up to the whole G-code")
+	}
+	if !strings.HasPrefix(text, first) || !strings.HasPrefix(rest, ";LAYER_CHANGE\n;Z:1.7\n") {
+		t.Error("unexpected range boundaries")
+	}
+
+	single, err := f.GCodeLayerRange(5, 5)
+	checkErr(t, err)
+	if strings.Count(single, ";LAYER_CHANGE") != 1 || !strings.HasPrefix(single, ";LAYER_CHANGE\n;Z:0.95\n") {
+		t.Errorf("unexpected single layer range: %.40q", single)
+	}
+
+	for _, r := range [][2]int{{-1, 3}, {3, 2}, {0, len(layers)}} {
+		if _, err := f.GCodeLayerRange(r[0], r[1]); err == nil {
+			t.Errorf("GCodeLayerRange(%d, %d): expected error", r[0], r[1])
+		}
+	}
+	// Ranges follow changes to the G-code blocks.
+	head := &File{GCode: f.GCode[:1]}
+	if got, err := head.GCodeLayerRange(0, 0); err != nil || !strings.HasPrefix(f.GCode[0].Body, got) {
+		t.Errorf("GCodeLayerRange(0, 0) of the first block = %.40q, %v", got, err)
+	}
+	if _, err := head.GCodeLayerRange(0, len(layers)-1); err == nil {
+		t.Error("GCodeLayerRange() accepted layers of dropped blocks")
+	}
+	if _, err := (&File{}).GCodeLayerRange(0, 0); !errors.Is(err, ErrNoLayers) {
+		t.Errorf("expected ErrNoLayers, got: %v", err)
+	}
+}
+
+func TestFile_Layers_zMoves(t *testing.T) {
+	f := &File{}
+	f.addGCode(&BlockGCode{Body: "G28\nG1 Z5 F600\nG1 Z0.2\nG1 X10 Y10 E1 ; first layer\nG1 Z0.6 ; hop\nG1 X0\n"})
+	f.addGCode(&BlockGCode{Body: "G1 Z0.2\nG1 X10 E2\nG91\nG1 Z0.2\nG1 E-1\nG1 X-10 E1\nG90\n"})
+	want := []Layer{
+		{Number: 0, Z: 0.2, Line: 2, Offset: 15},
+		{Number: 1, Z: 0.4, Line: 9, Offset: 93},
+	}
+	if diff := cmp.Diff(want, f.Layers(), cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+		t.Errorf("Layers() mismatch (-want +got):\n%s", diff)
+	}
+	second, err := f.GCodeLayerRange(1, 1)
+	checkErr(t, err)
+	if second != "G1 Z0.2\nG1 E-1\nG1 X-10 E1\nG90\n" {
+		t.Errorf("unexpected layer range: %q", second)
+	}
+}
+
+func decodeFixture(t *testing.T) *File {
+	t.Helper()
+	fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	f, err := Decode(fd)
+	checkErr(t, err)
+	return f
+}
+
+func TestFile_GCodeLineRange(t *testing.T) {
+	f := decodeFixture(t)
+	gcode := &strings.Builder{}
+	f.writeGCode(gcode)
+	text := gcode.String()
+	n := f.GCodeLineCount()
+
+	first, err := f.GCodeLineRange(0, 99)
+	checkErr(t, err)
+	rest, err := f.GCodeLineRange(100, n-1)
+	checkErr(t, err)
+	if first+rest != text || strings.Count(first, "\n") != 100 {
+		t.Error("adjacent ranges should add up to the whole G-code")
+	}
+
+	layer := f.Layers()[5]
+	single, err := f.GCodeLineRange(layer.Line, layer.Line+1)
+	checkErr(t, err)
+	if single != ";LAYER_CHANGE\n;Z:0.95\n" {
+		t.Errorf("unexpected line range: %q", single)
+	}
+
+	for _, r := range [][2]int{{-1, 3}, {3, 2}, {0, n}} {
+		if _, err := f.GCodeLineRange(r[0], r[1]); err == nil {
+			t.Errorf("GCodeLineRange(%d, %d): expected error", r[0], r[1])
+		}
+	}
+
+	// Ranges follow changes to the G-code blocks.
+	head := &File{GCode: f.GCode[:1]}
+	want := strings.SplitAfter(f.GCode[0].Body, "\n")[1]
+	if got, err := head.GCodeLineRange(1, 1); err != nil || got != want {
+		t.Errorf("GCodeLineRange(1, 1) of the first block = %q, %v, want %q", got, err, want)
+	}
+	if _, err := head.GCodeLineRange(0, n-1); err == nil {
+		t.Error("GCodeLineRange() accepted lines of dropped blocks")
+	}
+
+	f = &File{}
+	if _, err := f.GCodeLineRange(0, 0); !errors.Is(err, ErrNoGCode) {
+		t.Errorf("expected ErrNoGCode, got: %v", err)
+	}
+	f.addGCode(&BlockGCode{Body: "G28\nG1 Z5"})
+	f.addGCode(&BlockGCode{Body: "G1 X10\nM84"})
+	last, err := f.GCodeLineRange(1, 3)
+	checkErr(t, err)
+	if last != "G1 Z5\nG1 X10\nM84" {
+		t.Errorf("unexpected unterminated range: %q", last)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build go1.23
+
+package bgcodego
+
+import (
+	"iter"
+	"strings"
+)
+
+// GCodeLines yields the lines of G-code of all blocks, without their line
+// endings, as they would be counted by GCodeLineCount. Lines are sliced from
+// the block bodies, one block at a time, rather than from a copy of the whole
+// G-code.
+func (f *File) GCodeLines() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, gcode := range f.GCode {
+			for body := gcode.Render(); body != ""; {
+				line, rest, _ := strings.Cut(body, "\n")
+				if !yield(strings.TrimSuffix(line, "\r")) {
+					return
+				}
+				body = rest
+			}
+		}
+	}
+}
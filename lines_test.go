@@ -0,0 +1,39 @@
+//go:build go1.23
+
+package bgcodego
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFile_GCodeLines(t *testing.T) {
+	f := decodeFixture(t)
+	var lines []string
+	for line := range f.GCodeLines() {
+		lines = append(lines, line)
+	}
+	if len(lines) != f.GCodeLineCount() {
+		t.Errorf("unexpected line count: %d, want %d", len(lines), f.GCodeLineCount())
+	}
+	gcode := &strings.Builder{}
+	f.writeGCode(gcode)
+	if diff := cmp.Diff(strings.Split(strings.TrimSuffix(gcode.String(), "\n"), "\n"), lines); diff != "" {
+		t.Errorf("GCodeLines() mismatch (-want +got):\n%s", diff)
+	}
+
+	f = &File{}
+	f.addGCode(&BlockGCode{Body: "G28\r\nG1 X1"})
+	f.addGCode(&BlockGCode{Body: "G1 X2\n\nM84\n"})
+	lines = nil
+	for line := range f.GCodeLines() {
+		if lines = append(lines, line); len(lines) == 4 {
+			break
+		}
+	}
+	if diff := cmp.Diff([]string{"G28", "G1 X1", "G1 X2", ""}, lines); diff != "" {
+		t.Errorf("GCodeLines() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,367 @@
+// Package meatpack implements the Meatpack encoding of G-code, which packs
+// the most frequent characters of G-code in 4 bits. It is used by G-code
+// blocks of BGCode files, and by printers accepting packed streams over
+// serial links.
+//
+// Refer to https://github.com/scottmudge/OctoPrint-MeatPack
+package meatpack
+
+import (
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	commandEnablePacking   byte = 251
+	commandDisablePacking  byte = 250
+	commandResetAll        byte = 249
+	commandEnableNoSpaces  byte = 247
+	commandDisableNoSpaces byte = 246
+	commandSignalByte      byte = 0xFF
+
+	bothUnpackable   byte = 0b11111111
+	secondNotPacked  byte = 0b11110000
+	firstNotPacked   byte = 0b00001111
+	nextPackedFirst  byte = 0b00000001
+	nextPackedSecond byte = 0b00000010
+)
+
+// Decoder decodes a Meatpack stream incrementally.
+type Decoder struct {
+	unbinarizing   bool
+	nospaceEnabled bool
+	cmdActive      bool
+	charBuf        byte
+	cmdCount       int
+	fullCharQueue  int
+	charOutBuf     []byte // characters decoded from the last input byte
+	addSpace       bool
+	lastOut        byte
+	hasLastOut     bool
+}
+
+func (mpu *Decoder) handleCommand(c byte) {
+	switch c {
+	case commandEnablePacking:
+		mpu.unbinarizing = true
+	case commandDisablePacking:
+		mpu.unbinarizing = false
+	case commandEnableNoSpaces:
+		mpu.nospaceEnabled = true
+	case commandDisableNoSpaces:
+		mpu.nospaceEnabled = false
+	case commandResetAll:
+		mpu.unbinarizing = false
+	}
+}
+func (mpu *Decoder) handleOutputChar(c byte) {
+	mpu.charOutBuf = append(mpu.charOutBuf, c)
+}
+
+func (mpu *Decoder) getChar(c byte) byte {
+	switch c {
+	case 0b0000:
+		return '0'
+	case 0b0001:
+		return '1'
+	case 0b0010:
+		return '2'
+	case 0b0011:
+		return '3'
+	case 0b0100:
+		return '4'
+	case 0b0101:
+		return '5'
+	case 0b0110:
+		return '6'
+	case 0b0111:
+		return '7'
+	case 0b1000:
+		return '8'
+	case 0b1001:
+		return '9'
+	case 0b1010:
+		return '.'
+	case 0b1011:
+		if mpu.nospaceEnabled {
+			return 'E'
+		}
+		return ' '
+	case 0b1100:
+		return '\n'
+	case 0b1101:
+		return 'G'
+	case 0b1110:
+		return 'X'
+	}
+	return 0
+}
+
+func (mpu *Decoder) unpackChars(pk byte) (byte, []byte) {
+	out := byte(0)
+	charsOut := make([]byte, 2)
+	if (pk & firstNotPacked) == firstNotPacked {
+		out |= nextPackedFirst
+	} else {
+		charsOut[0] = mpu.getChar(pk & 0xF)
+	}
+	if (pk & secondNotPacked) == secondNotPacked {
+		out |= nextPackedSecond
+	} else {
+		charsOut[1] = mpu.getChar((pk >> 4) & 0xF)
+	}
+	return out, charsOut
+}
+
+func (mpu *Decoder) handleRxChar(c byte) {
+	if !mpu.unbinarizing {
+		mpu.handleOutputChar(c)
+		return
+	}
+
+	if mpu.fullCharQueue > 0 {
+		mpu.handleOutputChar(c)
+		if mpu.charBuf > 0 {
+			mpu.handleOutputChar(mpu.charBuf)
+			mpu.charBuf = 0
+		}
+		mpu.fullCharQueue--
+		return
+	}
+	res, buf := mpu.unpackChars(c)
+	if (res & nextPackedFirst) != 0 {
+		mpu.fullCharQueue++
+		if (res & nextPackedSecond) != 0 {
+			mpu.fullCharQueue++
+		} else {
+			mpu.charBuf = buf[1]
+		}
+		return
+	}
+
+	mpu.handleOutputChar(buf[0])
+	if buf[0] == '\n' {
+		return
+	}
+	if (res & nextPackedSecond) != 0 {
+		mpu.fullCharQueue++
+		return
+	}
+	mpu.handleOutputChar(buf[1])
+}
+
+// NewDecoder returns a decoder positioned at the start of a Meatpack stream.
+func NewDecoder() *Decoder {
+	// A single input byte decodes into at most four characters: two for
+	// a signal byte that turned out not to start a command, and two for
+	// the byte itself.
+	return &Decoder{charOutBuf: make([]byte, 0, 4)}
+}
+
+// Append decodes src, the continuation of the stream decoded so far, and
+// appends the resulting G-code to dst.
+func (mpu *Decoder) Append(dst, src []byte) []byte {
+	for _, c := range src {
+		dst = mpu.unbinarizeByte(dst, c)
+	}
+	return dst
+}
+
+// unbinarizeByte feeds c into the decoder and appends the resulting output
+// to dst.
+func (mpu *Decoder) unbinarizeByte(dst []byte, c byte) []byte {
+	switch {
+	case c == commandSignalByte && mpu.cmdCount > 0:
+		mpu.cmdActive = true
+		mpu.cmdCount = 0
+	case c == commandSignalByte:
+		mpu.cmdCount++
+	case mpu.cmdActive:
+		mpu.handleCommand(c)
+		mpu.cmdActive = false
+	default:
+		if mpu.cmdCount > 0 {
+			mpu.handleRxChar(commandSignalByte)
+			mpu.cmdCount = 0
+		}
+		mpu.handleRxChar(c)
+	}
+
+	for _, c := range mpu.charOutBuf {
+		if c == 'G' && (!mpu.hasLastOut || mpu.lastOut == '\n') {
+			mpu.addSpace = true
+		} else if c == '\n' {
+			mpu.addSpace = false
+		}
+		if mpu.addSpace && (!mpu.hasLastOut || mpu.lastOut != ' ') && isGlineParameter(c) {
+			dst = mpu.emit(dst, ' ')
+		}
+		if c != '\n' || !mpu.hasLastOut || mpu.lastOut != '\n' {
+			dst = mpu.emit(dst, c)
+		}
+	}
+	mpu.charOutBuf = mpu.charOutBuf[:0]
+	return dst
+}
+
+func (mpu *Decoder) emit(dst []byte, c byte) []byte {
+	mpu.lastOut = c
+	mpu.hasLastOut = true
+	return append(dst, c)
+}
+
+type reader struct {
+	r   io.Reader
+	mpu *Decoder
+	in  []byte
+	out []byte
+	pos int
+	err error
+}
+
+// NewReader returns a reader that decodes the Meatpack stream read from r.
+func NewReader(r io.Reader) io.Reader {
+	return &reader{
+		r:   r,
+		mpu: NewDecoder(),
+		in:  make([]byte, 4096),
+	}
+}
+
+func (mr *reader) Read(p []byte) (int, error) {
+	for mr.pos == len(mr.out) {
+		if mr.err != nil {
+			return 0, mr.err
+		}
+		n, err := mr.r.Read(mr.in)
+		mr.out, mr.pos = mr.out[:0], 0
+		mr.out = mr.mpu.Append(mr.out, mr.in[:n])
+		mr.err = err
+	}
+	n := copy(p, mr.out[mr.pos:])
+	mr.pos += n
+	return n, nil
+}
+
+func isGlineParameter(c byte) bool {
+	parameters := []byte{'X', 'Y', 'Z', 'E', 'F', 'I', 'J', 'R', 'P', 'W', 'H', 'C', 'A'}
+	return slices.Contains(parameters, c)
+}
+
+// Encode packs G-code. Comments are stored unpacked when keepComments is
+// set, and dropped otherwise. Empty lines are dropped, as they do not
+// survive decoding.
+func Encode(gcode string, keepComments bool) []byte {
+	mpb := &encoder{comments: keepComments}
+	dst := make([]byte, 0, len(gcode)/2)
+	dst = mpb.command(dst, commandEnablePacking)
+	dst = mpb.command(dst, commandEnableNoSpaces)
+	for len(gcode) > 0 {
+		line, rest, terminated := strings.Cut(gcode, "\n")
+		gcode = rest
+		eol := ""
+		if terminated {
+			eol = "\n"
+			if l, ok := strings.CutSuffix(line, "\r"); ok {
+				line, eol = l, "\r\n"
+			}
+		}
+		dst = mpb.binarizeLine(dst, line, eol)
+	}
+	if !mpb.comments {
+		dst = mpb.command(dst, commandResetAll)
+	}
+	return dst
+}
+
+type encoder struct {
+	comments bool
+	disabled bool
+}
+
+func (mpb *encoder) command(dst []byte, cmd byte) []byte {
+	return append(dst, commandSignalByte, commandSignalByte, cmd)
+}
+
+// binarizeLine appends a G-code line, terminated by eol. Lines holding
+// comments are stored unpacked, as comments are not packable and splitting
+// a line between packed and unpacked output is not worth the trouble.
+func (mpb *encoder) binarizeLine(dst []byte, line, eol string) []byte {
+	code, _, hasComment := strings.Cut(line, ";")
+	if !mpb.comments {
+		line = strings.TrimRight(code, " ")
+	}
+	if strings.TrimSpace(line) == "" {
+		return dst
+	}
+	if mpb.comments && hasComment {
+		if !mpb.disabled {
+			dst = mpb.command(dst, commandDisablePacking)
+			mpb.disabled = true
+		}
+		return append(append(dst, line...), eol...)
+	}
+	if mpb.disabled {
+		dst = mpb.command(dst, commandEnablePacking)
+		mpb.disabled = false
+	}
+	return mpb.pack(dst, line+eol)
+}
+
+// pack appends the packed form of a G-code line. Spaces the decoder restores
+// on its own, before the parameters of G commands, are omitted.
+func (mpb *encoder) pack(dst []byte, line string) []byte {
+	chars := make([]byte, 0, len(line))
+	gline := strings.HasPrefix(line, "G")
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if gline && c == ' ' && i+1 < len(line) && isGlineParameter(line[i+1]) && line[i-1] != ' ' {
+			continue
+		}
+		chars = append(chars, c)
+	}
+	for i := 0; i < len(chars); i += 2 {
+		first, ok1 := packChar(chars[i])
+		if chars[i] == '\n' || i+1 == len(chars) {
+			// The decoder ignores the second half of a byte starting
+			// with a newline, and waits forever for the full character
+			// announced by an unpackable second half.
+			dst = append(dst, 0xF0|first)
+			if !ok1 {
+				dst = append(dst, chars[i])
+			}
+			continue
+		}
+		second, ok2 := packChar(chars[i+1])
+		dst = append(dst, second<<4|first)
+		if !ok1 {
+			dst = append(dst, chars[i])
+		}
+		if !ok2 {
+			dst = append(dst, chars[i+1])
+		}
+	}
+	return dst
+}
+
+// packChar returns the 4-bit code of c, or 0b1111 if c cannot be packed.
+// Spaces cannot be packed, as their code stands for 'E' once spaces are
+// omitted.
+func packChar(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c == '.':
+		return 0b1010, true
+	case c == 'E':
+		return 0b1011, true
+	case c == '\n':
+		return 0b1100, true
+	case c == 'G':
+		return 0b1101, true
+	case c == 'X':
+		return 0b1110, true
+	}
+	return 0b1111, false
+}
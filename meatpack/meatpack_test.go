@@ -0,0 +1,109 @@
+package meatpack
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNewReader(t *testing.T) {
+	tests := []struct {
+		name         string
+		gcode        string
+		keepComments bool
+		want         string
+	}{
+		{"packed", "G28\nM104 S215\nG1 X10.5 Y-3 E.2\n", false, "G28\nM104 S215\nG1 X10.5 Y-3 E.2\n"},
+		{"comments dropped", "; comment\nG28 ; home\nG1 X1\n", false, "G28\nG1 X1\n"},
+		{"comments kept", "; comment\nG28 ; home\nG1 X1\n", true, "; comment\nG28 ; home\nG1 X1\n"},
+		{"crlf", "G28\r\nG1 X1\r\n", false, "G28\r\nG1 X1\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packed := Encode(tt.gcode, tt.keepComments)
+			got, err := io.ReadAll(NewReader(iotest.OneByteReader(bytes.NewReader(packed))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("NewReader(Encode()) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoder_Append(t *testing.T) {
+	// EnablePacking, then "G1" packed in a single byte and a newline with
+	// an ignored second half.
+	stream := []byte{0xFF, 0xFF, 251, 0x1D, 0xFC}
+	dec := NewDecoder()
+	var got []byte
+	for _, c := range stream {
+		got = dec.Append(got, []byte{c})
+	}
+	if string(got) != "G1\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+func TestDecoder_Append_overflow(t *testing.T) {
+	// EnablePacking, then a byte whose first character is sent in full, a
+	// signal byte that does not start a command, and a byte packing two
+	// characters: the last two input bytes decode into four characters.
+	stream := []byte{0xFF, 0xFF, 251, 0x1F, 0xFF, 0x41}
+	if got, want := string(NewDecoder().Append(nil, stream)), "\xff114"; got != want {
+		t.Errorf("Append() = %q, want %q", got, want)
+	}
+}
+
+func FuzzMeatpack(f *testing.F) {
+	f.Add([]byte{0xFF, 0xFF, 251, 0x1F, 0xFF, 0x41}, 3)
+	f.Add(Encode("G28\nM104 S215\nG1 X10.5 Y-3 E.2\n", false), 5)
+	f.Add(Encode("; comment\nG28 ; home\r\nG1 X1\n", true), 1)
+	f.Fuzz(func(t *testing.T, packed []byte, split int) {
+		want := NewDecoder().Append(nil, packed)
+		if split < 0 || split > len(packed) {
+			split = len(packed) / 2
+		}
+		dec := NewDecoder()
+		got := dec.Append(dec.Append(nil, packed[:split]), packed[split:])
+		if !bytes.Equal(got, want) {
+			t.Errorf("Append() split at %d = %q, want %q", split, got, want)
+		}
+		streamed, err := io.ReadAll(NewReader(iotest.OneByteReader(bytes.NewReader(packed))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(streamed, want) {
+			t.Errorf("NewReader() = %q, want %q", streamed, want)
+		}
+	})
+}
+
+func BenchmarkDecoder_Append(b *testing.B) {
+	gcode, err := os.ReadFile("../_testdata/mini_cube_b.gcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	packed := Encode(string(gcode), true)
+	b.SetBytes(int64(len(gcode)))
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		buf = NewDecoder().Append(buf[:0], packed)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	gcode, err := os.ReadFile("../_testdata/mini_cube_b.gcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(gcode)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Encode(string(gcode), true)
+	}
+}
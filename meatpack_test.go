@@ -0,0 +1,90 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestBinarize(t *testing.T) {
+	tests := []struct {
+		name     string
+		gcode    string
+		encoding GCodeEncoding
+		want     string
+	}{
+		{"none", "G28 ; home\nG1 X1\n", GCodeEncodingNone, "G28 ; home\nG1 X1\n"},
+		{"meatpack", "G28 ; home\nM104 S215\nG1 X10.5 Y-3 E.2\n", GCodeEncodingMeatpack, "G28\nM104 S215\nG1 X10.5 Y-3 E.2\n"},
+		{"meatpack comment lines", "; comment\nG1 X1\n;another\n", GCodeEncodingMeatpack, "G1 X1\n"},
+		{"meatpack with comments", "; comment\nG28 ; home\nG1 X10.5 Y-3 E.2\nM73 P0 R32\n", GCodeEncodingMeatpackWithComments, "; comment\nG28 ; home\nG1 X10.5 Y-3 E.2\nM73 P0 R32\n"},
+		{"empty lines", "G28\n\n\nG1 X1\n", GCodeEncodingMeatpackWithComments, "G28\nG1 X1\n"},
+		{"unterminated", "G28\nG1 X1", GCodeEncodingMeatpack, "G28\nG1 X1"},
+		{"unterminated odd", "G28\nM84", GCodeEncodingMeatpack, "G28\nM84"},
+		{"crlf", "G28 ; home\r\nG1 X1\r\n", GCodeEncodingMeatpack, "G28\r\nG1 X1\r\n"},
+		{"repeated spaces", "G1  X1 Y2\n", GCodeEncodingMeatpack, "G1  X1 Y2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packed, err := Binarize(tt.gcode, tt.encoding)
+			checkErr(t, err)
+			if got := Unbinarize(packed); got != tt.want {
+				t.Errorf("Unbinarize(Binarize()) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := Binarize("G28\n", 3); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("expected ErrUnsupportedEncoding, got: %v", err)
+	}
+}
+
+func TestBinarize_fixture(t *testing.T) {
+	f := decodeFixture(t)
+	for i, bg := range f.GCode {
+		packed, err := Binarize(bg.Body, GCodeEncodingMeatpackWithComments)
+		checkErr(t, err)
+		if got := Unbinarize(packed); got != bg.Body {
+			t.Errorf("block %d: round trip mismatch", i)
+		}
+		if len(packed) >= len(bg.Body) {
+			t.Errorf("block %d: packed body is not smaller than the G-code", i)
+		}
+		packed, err = Binarize(bg.Body, GCodeEncodingMeatpack)
+		checkErr(t, err)
+		if got := Unbinarize(packed); strings.Contains(got, ";") {
+			t.Errorf("block %d: comments not dropped", i)
+		}
+	}
+}
+
+func TestUnbinarizeStreams(t *testing.T) {
+	f := decodeFixture(t)
+	var packed []byte
+	for _, bg := range f.GCode {
+		p, err := Binarize(bg.Body, GCodeEncodingMeatpackWithComments)
+		checkErr(t, err)
+		packed = append(packed, p...)
+	}
+	want := Unbinarize(packed)
+
+	got, err := io.ReadAll(NewUnbinarizeReader(iotest.OneByteReader(bytes.NewReader(packed))))
+	checkErr(t, err)
+	if string(got) != want {
+		t.Error("unexpected output from NewUnbinarizeReader")
+	}
+
+	out := &bytes.Buffer{}
+	w := NewUnbinarizeWriter(out)
+	for rest := packed; len(rest) > 0; {
+		chunk := rest[:min(7, len(rest))]
+		rest = rest[len(chunk):]
+		if n, err := w.Write(chunk); err != nil || n != len(chunk) {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+	}
+	if out.String() != want {
+		t.Error("unexpected output from NewUnbinarizeWriter")
+	}
+}
@@ -0,0 +1,319 @@
+package bgcodego
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata holds the key-value tables of the metadata blocks of a file. It
+// is encoded to JSON as an object with one member per table present, each
+// holding the table as encoded by KeyValues.MarshalJSON.
+type Metadata struct {
+	File    KeyValues `json:"file,omitempty"`
+	Printer KeyValues `json:"printer,omitempty"`
+	Print   KeyValues `json:"print,omitempty"`
+	Slicer  KeyValues `json:"slicer,omitempty"`
+}
+
+// DecodeMetadata reads only the metadata blocks of a BGCode input. G-code and
+// thumbnail blocks are skipped without being decompressed, which makes it
+// much cheaper than Decode for callers that only need to index files.
+func DecodeMetadata(r io.Reader, opts ...DecodeOption) (*Metadata, error) {
+	return decodeMetadata(r, newDecodeOptions(opts))
+}
+
+// ParseMetadata is like DecodeMetadata, but when r is an io.Seeker, it seeks
+// past G-code and thumbnail blocks instead of reading them, so only the
+// metadata blocks are read from storage. Skipped blocks are therefore not
+// verified.
+func ParseMetadata(r io.Reader, opts ...DecodeOption) (*Metadata, error) {
+	o := newDecodeOptions(opts)
+	o.seekSkipped = true
+	return decodeMetadata(r, o)
+}
+
+func decodeMetadata(r io.Reader, o *DecodeOptions) (*Metadata, error) {
+	o.OnlyTypes = []BlockHeaderType{
+		BlockHeaderTypeFileMetadata,
+		BlockHeaderTypePrinterMetadata,
+		BlockHeaderTypePrintMetadata,
+		BlockHeaderTypeSlicerMetadata,
+	}
+	f, err := decode(r, o)
+	if err != nil {
+		return nil, err
+	}
+	return f.Metadata(), nil
+}
+
+// Metadata gathers the key-value tables of the metadata blocks of the file.
+func (f *File) Metadata() *Metadata {
+	m := &Metadata{}
+	if f.FileMetadata != nil {
+		m.File = f.FileMetadata.Values
+	}
+	if f.PrinterMetadata != nil {
+		m.Printer = f.PrinterMetadata.Values
+	}
+	if f.PrintMetadata != nil {
+		m.Print = f.PrintMetadata.Values
+	}
+	if f.SlicerMetadata != nil {
+		m.Slicer = f.SlicerMetadata.Values
+	}
+	return m
+}
+
+// Producer reports the application that produced the file.
+func (m *Metadata) Producer() string {
+	return m.File.First("Producer")
+}
+
+// PrinterModel reports the printer model the file was sliced for.
+func (m *Metadata) PrinterModel() string {
+	kv, name := findKey("printer_model", m.Printer, m.Slicer)
+	return kv.First(name)
+}
+
+// EstimatedTime reports the estimated printing time in normal mode, under
+// whichever of its names, as listed by KeyAliases, the slicer used.
+func (m *Metadata) EstimatedTime() (time.Duration, error) {
+	kv, name := findKey("estimated printing time (normal mode)", m.Print, m.Printer)
+	return kv.Duration(name)
+}
+
+// FilamentUsedGrams reports the weight of filament used by each extruder.
+func (m *Metadata) FilamentUsedGrams() ([]float64, error) {
+	kv, name := findKey("filament used [g]", m.Print, m.Printer)
+	return kv.Floats(name)
+}
+
+// findKey returns the first of tables holding a canonical key or one of its
+// aliases, along with the name found. When none does, it returns the last
+// table and the key, for accessors to report the key as missing.
+func findKey(key string, tables ...KeyValues) (KeyValues, string) {
+	tv := &typedValues{tables: tables}
+	if kv, name, ok := tv.lookup(key); ok {
+		return kv, name
+	}
+	return tables[len(tables)-1], key
+}
+
+// parseSlicerDuration parses durations as formatted by PrusaSlicer, such as
+// "1d 2h 3m 4s" or "32m 6s".
+func parseSlicerDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	for _, field := range fields {
+		if len(field) < 2 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		n, err := strconv.Atoi(field[:len(field)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		switch field[len(field)-1] {
+		case 'd':
+			d += time.Duration(n) * 24 * time.Hour
+		case 'h':
+			d += time.Duration(n) * time.Hour
+		case 'm':
+			d += time.Duration(n) * time.Minute
+		case 's':
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+	}
+	return d, nil
+}
+
+// EstimatedCost combines the filament cost per kilogram found in the slicer
+// metadata with the filament weight found in the print metadata to estimate
+// the cost of the print for each extruder.
+func (f *File) EstimatedCost() ([]float64, error) {
+	if f.SlicerMetadata == nil {
+		return nil, errors.New("missing slicer metadata block")
+	}
+	if f.PrintMetadata == nil {
+		return nil, errors.New("missing print metadata block")
+	}
+	costs, err := f.SlicerMetadata.Values.Floats("filament_cost")
+	if err != nil {
+		return nil, err
+	}
+	weights, err := f.PrintMetadata.Values.Floats("filament used [g]")
+	if err != nil {
+		return nil, err
+	}
+	if len(costs) != len(weights) {
+		return nil, fmt.Errorf("filament_cost lists %d extruders but filament used [g] lists %d", len(costs), len(weights))
+	}
+	ret := make([]float64, len(costs))
+	for i := range costs {
+		ret[i] = costs[i] * weights[i] / 1000
+	}
+	return ret, nil
+}
+
+// EstimatedTotalCost is the sum of the per-extruder costs reported by
+// EstimatedCost.
+func (f *File) EstimatedTotalCost() (float64, error) {
+	costs, err := f.EstimatedCost()
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, c := range costs {
+		total += c
+	}
+	return total, nil
+}
+
+// WritePrinterConfig writes the printer metadata as a standalone INI file,
+// preserving the order and duplicates of its keys.
+func (f *File) WritePrinterConfig(w io.Writer) error {
+	if f.PrinterMetadata == nil {
+		return errors.New("missing printer metadata block")
+	}
+	_, err := w.Write(iniEncode(f.PrinterMetadata.Values))
+	return err
+}
+
+// perExtruderKeys lists the metadata keys holding one value per extruder,
+// along with the separator PrusaSlicer uses between values.
+var perExtruderKeys = []struct {
+	key string
+	sep string
+}{
+	{"extruder_colour", ";"},
+	{"filament_colour", ";"},
+	{"filament_cost", ","},
+	{"filament_density", ","},
+	{"filament_type", ";"},
+	{"filament used [cm3]", ","},
+	{"filament used [g]", ","},
+	{"filament used [mm]", ","},
+	{"filament cost", ","},
+	{"nozzle_diameter", ","},
+	{"temperature", ","},
+}
+
+// Validate reports non-fatal inconsistencies in the file.
+func (f *File) Validate() []Warning {
+	return f.CheckMetadataConsistency()
+}
+
+// CheckMetadataConsistency reports per-extruder metadata lists whose length
+// disagrees with the first per-extruder list found, so that consumers
+// zipping these lists together can tell in advance that they will not line
+// up.
+func (f *File) CheckMetadataConsistency() []Warning {
+	type source struct {
+		block  string
+		values KeyValues
+	}
+	var sources []source
+	if f.PrinterMetadata != nil {
+		sources = append(sources, source{"printer metadata", f.PrinterMetadata.Values})
+	}
+	if f.PrintMetadata != nil {
+		sources = append(sources, source{"print metadata", f.PrintMetadata.Values})
+	}
+	if f.SlicerMetadata != nil {
+		sources = append(sources, source{"slicer metadata", f.SlicerMetadata.Values})
+	}
+	var (
+		warnings []Warning
+		refKey   string
+		refBlock string
+		refLen   int
+	)
+	for _, src := range sources {
+		for _, pek := range perExtruderKeys {
+			idx := src.values.index(pek.key)
+			if idx == -1 {
+				continue
+			}
+			n := len(strings.Split(src.values[idx].Value, pek.sep))
+			if refKey == "" {
+				refKey, refBlock, refLen = pek.key, src.block, n
+				continue
+			}
+			if n != refLen {
+				warnings = append(warnings, Warning{
+					Index:   -1,
+					Message: fmt.Sprintf("%s %q lists %d extruders, but %s %q lists %d", src.block, pek.key, n, refBlock, refKey, refLen),
+				})
+			}
+		}
+	}
+	return warnings
+}
+
+// splitFloats parses per-extruder vectors, which PrusaSlicer separates with
+// either commas or semicolons. Empty entries, as in "12.3,,4.5", are taken
+// as zero so that every value stays at the position of its extruder.
+func splitFloats(s string) ([]float64, error) {
+	if strings.TrimSpace(s) == "" {
+		return []float64{}, nil
+	}
+	fields := strings.Split(strings.ReplaceAll(s, ";", ","), ",")
+	ret := make([]float64, 0, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			ret = append(ret, 0)
+			continue
+		}
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+// splitStrings parses per-extruder lists of strings, which PrusaSlicer
+// separates with semicolons and quotes when needed, such as
+// "#FF8000";"#000000". Separators within quotes are kept.
+func splitStrings(s string) []string {
+	var (
+		ret    []string
+		field  strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted && i+1 < len(s):
+			field.WriteByte(c)
+			i++
+			field.WriteByte(s[i])
+			continue
+		case c == '"':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			ret = append(ret, unquoteField(field.String()))
+			field.Reset()
+			continue
+		}
+		field.WriteByte(s[i])
+	}
+	return append(ret, unquoteField(field.String()))
+}
+
+func unquoteField(field string) string {
+	field = strings.TrimSpace(field)
+	if unquoted, err := strconv.Unquote(field); err == nil {
+		return unquoted
+	}
+	return field
+}
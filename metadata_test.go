@@ -0,0 +1,215 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestFile_EstimatedCost(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+		checkErr(t, err)
+		t.Cleanup(func() { fd.Close() })
+		f, err := Decode(fd)
+		checkErr(t, err)
+		got, err := f.EstimatedCost()
+		checkErr(t, err)
+		if len(got) != 1 || math.Round(got[0]*100)/100 != 0.08 {
+			t.Errorf("EstimatedCost() = %v, want [0.08]", got)
+		}
+	})
+	newFile := func(cost, weight string) *File {
+		f := &File{
+			SlicerMetadata: &BlockSlicerMetadata{},
+			PrintMetadata:  &BlockPrintMetadata{},
+		}
+		if cost != "" {
+			f.SlicerMetadata.Values = KeyValues{{Key: "filament_cost", Value: cost}}
+		}
+		if weight != "" {
+			f.PrintMetadata.Values = KeyValues{{Key: "filament used [g]", Value: weight}}
+		}
+		return f
+	}
+	tests := []struct {
+		name      string
+		file      *File
+		want      []float64
+		wantTotal float64
+		wantErr   bool
+	}{
+		{"single extruder", newFile("25", "40"), []float64{1}, 1, false},
+		{"multiple extruders", newFile("25,30", "40, 0, 10"), nil, 0, true},
+		{"multiple extruders matching", newFile("25,30,20", "40, 0, 10"), []float64{1, 0, 0.2}, 1.2, false},
+		{"semicolon separated", newFile("25;30", "40, 10"), []float64{1, 0.3}, 1.3, false},
+		{"missing cost", newFile("", "40"), nil, 0, true},
+		{"missing weight", newFile("25", ""), nil, 0, true},
+		{"bad cost", newFile("abc", "40"), nil, 0, true},
+		{"missing blocks", &File{}, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.file.EstimatedCost()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EstimatedCost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("EstimatedCost() mismatch (-want +got):\n%s", diff)
+			}
+			total, err := tt.file.EstimatedTotalCost()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EstimatedTotalCost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if math.Abs(total-tt.wantTotal) > 1e-9 {
+				t.Errorf("EstimatedTotalCost() = %v, want %v", total, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestFile_WritePrinterConfig(t *testing.T) {
+	f := decodeFixture(t)
+	out := &bytes.Buffer{}
+	checkErr(t, f.WritePrinterConfig(out))
+	values, err := iniDecode(out.Bytes())
+	checkErr(t, err)
+	if diff := cmp.Diff(f.PrinterMetadata.Values, values); diff != "" {
+		t.Errorf("WritePrinterConfig() round trip mismatch (-want +got):\n%s", diff)
+	}
+	if !strings.HasPrefix(out.String(), "printer_model=MINI\nfilament_type=PETG\n") {
+		t.Errorf("unexpected output: %.60q", out.String())
+	}
+	if err := (&File{}).WritePrinterConfig(out); err == nil {
+		t.Error("expected error for missing printer metadata")
+	}
+}
+
+func TestFile_CheckMetadataConsistency(t *testing.T) {
+	if warnings := decodeFixture(t).Validate(); len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	fd, err := os.Open("_testdata/mismatched_extruders.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	f, err := Decode(fd)
+	checkErr(t, err)
+	want := []Warning{
+		{Index: -1, Message: `printer metadata "nozzle_diameter" lists 1 extruders, but printer metadata "extruder_colour" lists 2`},
+		{Index: -1, Message: `print metadata "filament used [g]" lists 1 extruders, but printer metadata "extruder_colour" lists 2`},
+	}
+	if diff := cmp.Diff(want, f.CheckMetadataConsistency()); diff != "" {
+		t.Errorf("CheckMetadataConsistency() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, f.Validate()); diff != "" {
+		t.Errorf("Validate() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	m, err := DecodeMetadata(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	f := decodeFixture(t)
+	if diff := cmp.Diff(f.Metadata(), m); diff != "" {
+		t.Errorf("DecodeMetadata() mismatch (-want +got):\n%s", diff)
+	}
+	if got := m.Producer(); got != "PrusaSlicer 2.6.0" {
+		t.Errorf("Producer() = %q", got)
+	}
+	if got := m.PrinterModel(); got != "MINI" {
+		t.Errorf("PrinterModel() = %q", got)
+	}
+	eta, err := m.EstimatedTime()
+	checkErr(t, err)
+	if eta != 32*time.Minute+6*time.Second {
+		t.Errorf("EstimatedTime() = %v", eta)
+	}
+	used, err := m.FilamentUsedGrams()
+	checkErr(t, err)
+	if diff := cmp.Diff([]float64{3.01}, used); diff != "" {
+		t.Errorf("FilamentUsedGrams() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+type readCountingSeeker struct {
+	*bytes.Reader
+	n int
+}
+
+func (r *readCountingSeeker) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestParseMetadata(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	bgcode[30000] ^= 0xFF // inside the second G-code block
+	if _, err := DecodeMetadata(bytes.NewReader(bgcode)); !errors.Is(err, ErrBadChecksum) {
+		t.Fatalf("expected ErrBadChecksum, got: %v", err)
+	}
+	r := &readCountingSeeker{Reader: bytes.NewReader(bgcode)}
+	m, err := ParseMetadata(r)
+	checkErr(t, err)
+	if diff := cmp.Diff(decodeFixture(t).Metadata(), m); diff != "" {
+		t.Errorf("ParseMetadata() mismatch (-want +got):\n%s", diff)
+	}
+	if r.n > 10000 {
+		t.Errorf("read %d bytes, expected only the metadata blocks to be read", r.n)
+	}
+}
+
+func TestParseSlicerDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"32m 6s", 32*time.Minute + 6*time.Second, false},
+		{"1d 2h 3m 4s", 26*time.Hour + 3*time.Minute + 4*time.Second, false},
+		{"45s", 45 * time.Second, false},
+		{"", 0, true},
+		{"5x", 0, true},
+		{"m", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSlicerDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSlicerDuration(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func BenchmarkDecodeMetadata(b *testing.B) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := DecodeMetadata(bytes.NewReader(bgcode)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parse", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseMetadata(bytes.NewReader(bgcode)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
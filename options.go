@@ -0,0 +1,363 @@
+package bgcodego
+
+import (
+	"context"
+	"io"
+	"slices"
+)
+
+// DecodeOptions controls how a BGCode input is decoded.
+type DecodeOptions struct {
+	// Strict enforces the block layout mandated by the specification
+	// instead of accepting whatever producers emit.
+	Strict bool
+
+	// OnlyTypes restricts decoding to the listed block types. Blocks of
+	// other types are skipped without being decompressed, although their
+	// checksums are still verified. When empty, all blocks are decoded.
+	OnlyTypes []BlockHeaderType
+
+	// SkipUnknownBlocks skips well-formed blocks whose type is not known to
+	// this package, recording a warning, instead of failing. This keeps the
+	// decoder forward-compatible with future revisions of the
+	// specification. In Version1 files, such blocks are taken to carry the
+	// 2 bytes of parameters of metadata and G-code blocks; layouts that
+	// leave their parameters undefined fail with an
+	// *UnsupportedBlockTypeError instead, as their size cannot be told.
+	SkipUnknownBlocks bool
+
+	// SkipChecksum skips the verification of block checksums, to recover
+	// what is left of corrupted files or to save time on trusted inputs.
+	SkipChecksum bool
+
+	// ChecksumPolicy controls what happens to blocks whose checksum does
+	// not match their contents. NewVerifyingReader ignores it, and always
+	// fails on mismatches.
+	ChecksumPolicy ChecksumPolicy
+
+	// KeepPacked retains the decompressed but still Meatpack-encoded body
+	// of G-code blocks, available through BlockGCode.Packed.
+	KeepPacked bool
+
+	// StripComments removes comments from the decoded G-code, along with
+	// the lines left empty, as if it had been encoded with
+	// GCodeEncodingMeatpack. By default, comments kept by
+	// GCodeEncodingMeatpackWithComments are rendered.
+	StripComments bool
+
+	// LineEnding, when set, is the line terminator the decoded G-code is
+	// normalized to. By default, line terminators are kept as stored,
+	// which matters for blocks with GCodeEncodingNone, whose G-code is
+	// otherwise rendered verbatim.
+	LineEnding LineEnding
+
+	// TrimTrailingSpace removes the whitespace at the end of the lines of
+	// the decoded G-code.
+	TrimTrailingSpace bool
+
+	// DetectContainers unwraps inputs compressed with gzip, such as
+	// .bgcode.gz files, and zip-based containers, such as 3MF projects,
+	// whose BGCode payload is located by FindInArchive. Zip-based
+	// containers are read into memory unless the input is an io.ReaderAt
+	// and an io.Seeker. Offsets and progress then refer to the payload.
+	DetectContainers bool
+
+	// Render controls how Parse, ParseContext, ParseTo and AppendGCode
+	// render the decoded file.
+	Render RenderOptions
+
+	// Progress, when set, is called after each block is processed.
+	Progress func(ProgressEvent)
+
+	// TotalSize is the size of the input, reported in progress events.
+	// When zero, it is determined by seeking if the input is an
+	// io.Seeker, and reported as -1 otherwise.
+	TotalSize int64
+
+	// MaxTotalSize caps the size of the decoded output: the rendered
+	// output when streaming, and the decoded data of all blocks kept,
+	// thumbnails and metadata included, when decoding into a File.
+	// Decoding fails with a *LimitError matching ErrOutputTooLarge as soon
+	// as the cap is exceeded. When zero, DefaultMaxTotalSize applies; when
+	// negative, the output is unbounded.
+	MaxTotalSize int64
+
+	// MaxBlockSize caps the compressed and uncompressed sizes declared by
+	// block headers, which are otherwise trusted to size buffers. When
+	// zero, DefaultMaxBlockSize applies; when negative, block sizes are
+	// unbounded.
+	MaxBlockSize int64
+
+	// MaxThumbnailSize caps the size of thumbnail blocks. When zero,
+	// DefaultMaxThumbnailSize applies; when negative, only MaxBlockSize
+	// bounds thumbnails.
+	MaxThumbnailSize int64
+
+	// MaxBlocks caps the number of blocks of the input. When zero,
+	// DefaultMaxBlocks applies; when negative, the number of blocks is
+	// unbounded.
+	MaxBlocks int
+
+	ctx context.Context
+
+	// seekSkipped seeks past skipped blocks instead of reading and
+	// verifying them, when the input is an io.Seeker.
+	seekSkipped bool
+}
+
+// ChecksumPolicy controls how decoding handles blocks whose checksum does not
+// match their contents.
+type ChecksumPolicy int
+
+const (
+	// ChecksumFail fails decoding with a *BlockError wrapping a
+	// *ChecksumError.
+	ChecksumFail ChecksumPolicy = iota
+
+	// ChecksumWarn keeps the block as decoded and records a warning, so
+	// that recovery tools extract as much as possible from damaged files.
+	ChecksumWarn
+
+	// ChecksumIgnore skips the verification of checksums, as SkipChecksum
+	// does.
+	ChecksumIgnore
+)
+
+// ProgressEvent reports how far the decoding of an input has gone.
+type ProgressEvent struct {
+	BytesRead  int64           // Bytes consumed from the input so far
+	TotalBytes int64           // Size of the input, or -1 when unknown
+	Blocks     int             // Number of blocks processed so far
+	BlockType  BlockHeaderType // Type of the last processed block
+}
+
+// DecodeOption configures the decoding of a BGCode input.
+type DecodeOption func(*DecodeOptions)
+
+// WithStrict rejects inputs that do not follow the block layout mandated by
+// the specification.
+func WithStrict() DecodeOption {
+	return func(o *DecodeOptions) {
+		o.Strict = true
+	}
+}
+
+// WithContainerDetection unwraps BGCode compressed with gzip or held in a
+// zip-based container.
+func WithContainerDetection() DecodeOption {
+	return func(o *DecodeOptions) {
+		o.DetectContainers = true
+	}
+}
+
+// WithOnlyTypes restricts decoding to the given block types.
+func WithOnlyTypes(types ...BlockHeaderType) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.OnlyTypes = append(o.OnlyTypes, types...)
+	}
+}
+
+// WithSkipUnknownBlocks skips blocks of unknown type instead of failing.
+func WithSkipUnknownBlocks() DecodeOption {
+	return func(o *DecodeOptions) {
+		o.SkipUnknownBlocks = true
+	}
+}
+
+// WithSkipChecksum skips the verification of block checksums.
+func WithSkipChecksum() DecodeOption {
+	return func(o *DecodeOptions) {
+		o.SkipChecksum = true
+	}
+}
+
+// WithChecksumPolicy sets how blocks whose checksum does not match are
+// handled.
+func WithChecksumPolicy(p ChecksumPolicy) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.ChecksumPolicy = p
+	}
+}
+
+// WithKeepPacked retains the Meatpack-encoded body of G-code blocks.
+func WithKeepPacked() DecodeOption {
+	return func(o *DecodeOptions) {
+		o.KeepPacked = true
+	}
+}
+
+// WithStripComments removes comments from the decoded G-code.
+func WithStripComments() DecodeOption {
+	return func(o *DecodeOptions) {
+		o.StripComments = true
+	}
+}
+
+// WithNormalizedLineEnding normalizes the line terminators of the decoded
+// G-code to le.
+func WithNormalizedLineEnding(le LineEnding) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.LineEnding = le
+	}
+}
+
+// WithTrimTrailingSpace removes the whitespace at the end of the lines of
+// the decoded G-code.
+func WithTrimTrailingSpace() DecodeOption {
+	return func(o *DecodeOptions) {
+		o.TrimTrailingSpace = true
+	}
+}
+
+// WithRenderOptions sets how Parse, ParseContext, ParseTo and AppendGCode
+// render the decoded file.
+func WithRenderOptions(opts ...RenderOption) DecodeOption {
+	return func(o *DecodeOptions) {
+		for _, opt := range opts {
+			opt(&o.Render)
+		}
+	}
+}
+
+// WithProgress sets a callback that is called after each block is processed.
+func WithProgress(fn func(ProgressEvent)) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.Progress = fn
+	}
+}
+
+// WithTotalSize declares the size of the input for progress reporting, for
+// inputs that cannot be measured by seeking, such as HTTP request bodies
+// with a known Content-Length.
+func WithTotalSize(size int64) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.TotalSize = size
+	}
+}
+
+// WithMaxTotalSize caps the size of the decoded output. A negative size
+// lifts the default limit.
+func WithMaxTotalSize(size int64) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.MaxTotalSize = size
+	}
+}
+
+// Default resource limits, generous enough for any file produced by a
+// slicer. G-code blocks are 64 KiB once inflated, as written by libbgcode.
+const (
+	DefaultMaxBlockSize     = 64 << 20
+	DefaultMaxThumbnailSize = 16 << 20
+	DefaultMaxBlocks        = 1 << 20
+	DefaultMaxTotalSize     = 4 << 30
+)
+
+// WithMaxBlockSize caps the sizes declared by block headers. A negative size
+// lifts the default limit.
+func WithMaxBlockSize(size int64) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.MaxBlockSize = size
+	}
+}
+
+// WithMaxThumbnailSize caps the size of thumbnail blocks. A negative size
+// lifts the default limit.
+func WithMaxThumbnailSize(size int64) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.MaxThumbnailSize = size
+	}
+}
+
+// WithMaxBlocks caps the number of blocks of the input. A negative count
+// lifts the default limit.
+func WithMaxBlocks(n int) DecodeOption {
+	return func(o *DecodeOptions) {
+		o.MaxBlocks = n
+	}
+}
+
+// limit resolves a limit of the decoding options, returning 0 when
+// unbounded.
+func limit[T int | int64](v, def T) T {
+	switch {
+	case v == 0:
+		return def
+	case v < 0:
+		return 0
+	}
+	return v
+}
+
+// maxTotalSize resolves MaxTotalSize, returning 0 when unbounded.
+func (o *DecodeOptions) maxTotalSize() int64 {
+	return limit(o.MaxTotalSize, DefaultMaxTotalSize)
+}
+
+// checkLimits validates the header of the idx-th block against the resource
+// limits.
+func (o *DecodeOptions) checkLimits(hdr *BlockHeader, idx int) error {
+	if lim := limit(o.MaxBlocks, DefaultMaxBlocks); lim > 0 && idx >= lim {
+		return &LimitError{Limit: limitBlocks, Max: int64(lim), Value: int64(idx) + 1}
+	}
+	size := int64(max(hdr.Length(), hdr.UncompressedSize()))
+	if lim := limit(o.MaxBlockSize, DefaultMaxBlockSize); lim > 0 && size > lim {
+		return &LimitError{Limit: limitBlockSize, Max: lim, Value: size}
+	}
+	if hdr.Type() != BlockHeaderTypeThumbnail {
+		return nil
+	}
+	if lim := limit(o.MaxThumbnailSize, DefaultMaxThumbnailSize); lim > 0 && size > lim {
+		return &LimitError{Limit: limitThumbnailSize, Max: lim, Value: size}
+	}
+	return nil
+}
+
+// totalSize determines the size of the remaining input for progress
+// reporting.
+func (o *DecodeOptions) totalSize(r io.Reader) int64 {
+	if o.TotalSize > 0 {
+		return o.TotalSize
+	}
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err := s.Seek(cur, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - cur
+}
+
+func (o *DecodeOptions) wants(bht BlockHeaderType) bool {
+	return len(o.OnlyTypes) == 0 || slices.Contains(o.OnlyTypes, bht)
+}
+
+func newDecodeOptions(opts []DecodeOption) *DecodeOptions {
+	o := &DecodeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ctxReader fails reads once its context is done, so that decoding stops
+// between blocks as well as within large blocks.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,100 @@
+package bgcodego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecode_limits(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	huge := bytes.Clone(bgcode)
+	binary.LittleEndian.PutUint32(huge[10+4:], 0xFFFFFFF0) // uncompressed size of the file metadata block
+
+	tests := []struct {
+		name      string
+		input     []byte
+		opts      []DecodeOption
+		wantIndex int
+		want      *LimitError
+	}{
+		{"default block size", huge, nil, 0, &LimitError{Limit: "block size", Max: DefaultMaxBlockSize, Value: 0xFFFFFFF0}},
+		{"block size", bgcode, []DecodeOption{WithMaxBlockSize(1000)}, 3, &LimitError{Limit: "block size", Max: 1000, Value: 4836}},
+		{"thumbnail size", bgcode, []DecodeOption{WithMaxThumbnailSize(100)}, 2, &LimitError{Limit: "thumbnail size", Max: 100, Value: 461}},
+		{"block count", bgcode, []DecodeOption{WithMaxBlocks(10)}, 10, &LimitError{Limit: "block count", Max: 10, Value: 11}},
+		{"output size", bgcode, []DecodeOption{WithMaxTotalSize(1000)}, 3, &LimitError{Limit: "output size", Max: 1000, Value: 5669}},
+		{"G-code output size", bgcode, []DecodeOption{WithMaxTotalSize(1000), WithOnlyTypes(BlockHeaderTypeGCode)}, 6, &LimitError{Limit: "output size", Max: 1000, Value: 65515}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tt.input), tt.opts...)
+			var blockErr *BlockError
+			var limitErr *LimitError
+			if !errors.As(err, &blockErr) || !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("expected *LimitError within *BlockError, got: %v", err)
+			}
+			if blockErr.Index != tt.wantIndex {
+				t.Errorf("failed at block #%d, want #%d", blockErr.Index, tt.wantIndex)
+			}
+			if diff := cmp.Diff(tt.want, limitErr); diff != "" {
+				t.Errorf("LimitError mismatch (-want +got):\n%s", diff)
+			}
+			if got, want := errors.Is(err, ErrOutputTooLarge), tt.want.Limit == "output size"; got != want {
+				t.Errorf("errors.Is(err, ErrOutputTooLarge) = %v, want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("header limits apply to every entry point", func(t *testing.T) {
+		if err := Verify(bytes.NewReader(huge)); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Verify() error = %v, want ErrLimitExceeded", err)
+		}
+		r, err := NewVerifyingReader(bytes.NewReader(huge))
+		checkErr(t, err)
+		if _, err := io.Copy(io.Discard, r); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("NewVerifyingReader() error = %v, want ErrLimitExceeded", err)
+		}
+	})
+	t.Run("default output size", func(t *testing.T) {
+		for _, tt := range []struct {
+			size, want int64
+		}{{0, DefaultMaxTotalSize}, {-1, 0}, {1000, 1000}} {
+			if got := (&DecodeOptions{MaxTotalSize: tt.size}).maxTotalSize(); got != tt.want {
+				t.Errorf("maxTotalSize() of %d = %d, want %d", tt.size, got, tt.want)
+			}
+		}
+	})
+	t.Run("lifted limits", func(t *testing.T) {
+		_, err := Decode(bytes.NewReader(bgcode), WithMaxBlockSize(-1), WithMaxThumbnailSize(-1), WithMaxBlocks(-1), WithMaxTotalSize(-1))
+		checkErr(t, err)
+		_, err = Decode(bytes.NewReader(bgcode), WithMaxBlocks(16))
+		checkErr(t, err)
+	})
+}
+
+func TestDecode_inflatedTooLarge(t *testing.T) {
+	gcode := strings.Repeat("G1 X1 Y1\n", 1000)
+	bgcode, err := Marshal(&File{GCode: []*BlockGCode{{Body: gcode}}},
+		WithCompression(BlockHeaderCompressionDeflate), WithGCodeEncoding(GCodeEncodingNone))
+	checkErr(t, err)
+	fi, err := Index(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	bi, ok := fi.Find(BlockHeaderTypeGCode)
+	if !ok {
+		t.Fatal("no G-code block")
+	}
+	binary.LittleEndian.PutUint32(bgcode[bi.Offset+4:], uint32(len(gcode)/2))
+	if _, err := Decode(bytes.NewReader(bgcode), WithSkipChecksum()); !errors.Is(err, errInflatedTooLarge) {
+		t.Errorf("Decode() error = %v, want errInflatedTooLarge", err)
+	}
+	if _, err := Parse(bytes.NewReader(bgcode), WithSkipChecksum()); !errors.Is(err, errInflatedTooLarge) {
+		t.Errorf("Parse() error = %v, want errInflatedTooLarge", err)
+	}
+}
@@ -0,0 +1,85 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer bounds the capacity of the buffers kept for reuse, so that
+// a single oversized block does not pin its memory for the lifetime of the
+// process.
+const maxPooledBuffer = 4 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any { return &bytes.Buffer{} },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// readBody reads the block data that follows the block parameters and
+// decompresses it. The returned body is only valid until release is called.
+func readBody(r io.Reader, hdr *BlockHeader) (body []byte, release func(), err error) {
+	src := getBuffer()
+	src.Grow(int(hdr.Length()))
+	if _, err := io.CopyN(src, r, int64(hdr.Length())); err != nil {
+		putBuffer(src)
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, fmt.Errorf("cannot read block data: %w", err)
+	}
+	if hdr.Compression() == BlockHeaderCompressionNone {
+		return src.Bytes(), func() { putBuffer(src) }, nil
+	}
+	defer putBuffer(src)
+	dst := getBuffer()
+	if err := hdr.inflateTo(dst, src); err != nil {
+		putBuffer(dst)
+		return nil, nil, err
+	}
+	return dst.Bytes(), func() { putBuffer(dst) }, nil
+}
+
+// inflaterPools holds, per compression algorithm, the decompressors that can
+// be reset to read another block.
+var inflaterPools sync.Map // map[BlockHeaderCompression]*sync.Pool
+
+// resetReader is implemented by decompressors that can be reused.
+type resetReader interface {
+	io.Reader
+	Reset(r io.Reader) error
+}
+
+func getInflater(bhc BlockHeaderCompression, c Compression, r io.Reader) (io.Reader, error) {
+	if p, ok := inflaterPools.Load(bhc); ok {
+		if rr, ok := p.(*sync.Pool).Get().(resetReader); ok {
+			if err := rr.Reset(r); err != nil {
+				return nil, err
+			}
+			return rr, nil
+		}
+	}
+	return c.NewReader(r)
+}
+
+func putInflater(bhc BlockHeaderCompression, r io.Reader) {
+	rr, ok := r.(resetReader)
+	if !ok {
+		return
+	}
+	p, _ := inflaterPools.LoadOrStore(bhc, &sync.Pool{})
+	p.(*sync.Pool).Put(rr)
+}
@@ -0,0 +1,177 @@
+// Package prusalink uploads prints to printers running PrusaLink, through
+// version 1 of its HTTP API.
+//
+//	c := &prusalink.Client{BaseURL: "http://prusa-mini.local", APIKey: key}
+//	err := c.Upload(ctx, "cube.bgcode", fd, prusalink.WithPrintAfterUpload())
+//
+// Printers that only accept BGCode, such as the MINI and the MK4, are fed
+// ASCII G-code by setting ConvertToBGCode.
+package prusalink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"cirello.io/bgcodego"
+)
+
+// DefaultStorage is the storage files are uploaded to when Client.Storage is
+// empty: the USB drive of the printer.
+const DefaultStorage = "usb"
+
+// Client uploads files to a PrusaLink instance.
+type Client struct {
+	// BaseURL is the address of the printer, such as
+	// "http://192.168.1.10".
+	BaseURL string
+
+	// APIKey authenticates requests, as shown in the PrusaLink settings of
+	// the printer.
+	APIKey string
+
+	// Storage is the storage files are uploaded to. Defaults to
+	// DefaultStorage.
+	Storage string
+
+	// HTTPClient sends the requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// ConvertToBGCode converts ASCII G-code into BGCode before uploading
+	// it, and renames files with the .gcode extension accordingly. BGCode
+	// is uploaded as is. Inputs of unknown format fail with
+	// bgcodego.ErrUnknownFormat.
+	ConvertToBGCode bool
+
+	// EncodeOptions are used for converting ASCII G-code into BGCode.
+	EncodeOptions []bgcodego.EncodeOption
+}
+
+// UploadOptions controls how a file is uploaded.
+type UploadOptions struct {
+	// PrintAfterUpload starts printing the file once uploaded.
+	PrintAfterUpload bool
+
+	// Overwrite replaces the file of the same name, if any. By default,
+	// the upload fails with a *StatusError of code 409.
+	Overwrite bool
+}
+
+// UploadOption configures an upload.
+type UploadOption func(*UploadOptions)
+
+// WithPrintAfterUpload starts printing the file once uploaded.
+func WithPrintAfterUpload() UploadOption {
+	return func(o *UploadOptions) {
+		o.PrintAfterUpload = true
+	}
+}
+
+// WithOverwrite replaces the file of the same name, if any.
+func WithOverwrite() UploadOption {
+	return func(o *UploadOptions) {
+		o.Overwrite = true
+	}
+}
+
+// StatusError is returned when PrusaLink rejects a request.
+type StatusError struct {
+	StatusCode int
+	Message    string // Body of the response, if any
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("prusalink: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("prusalink: %s: %s", http.StatusText(e.StatusCode), e.Message)
+}
+
+// maxMessageSize caps the size of error messages read from responses.
+const maxMessageSize = 1 << 10
+
+// Upload uploads the content of r as the file name, which may include
+// directories of the storage.
+func (c *Client) Upload(ctx context.Context, name string, r io.Reader, opts ...UploadOption) error {
+	o := &UploadOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	body := &bytes.Buffer{}
+	if c.ConvertToBGCode {
+		if err := bgcodego.ConvertToBGCode(body, r, c.EncodeOptions...); err != nil {
+			return fmt.Errorf("cannot convert %s: %w", name, err)
+		}
+		if ext := path.Ext(name); strings.EqualFold(ext, ".gcode") {
+			name = strings.TrimSuffix(name, ext) + ".bgcode"
+		}
+	} else if _, err := io.Copy(body, r); err != nil {
+		return fmt.Errorf("cannot read %s: %w", name, err)
+	}
+	return c.put(ctx, name, body, o)
+}
+
+// UploadFile encodes f as BGCode, with the EncodeOptions of the client, and
+// uploads it as the file name.
+func (c *Client) UploadFile(ctx context.Context, name string, f *bgcodego.File, opts ...UploadOption) error {
+	data, err := bgcodego.Marshal(f, c.EncodeOptions...)
+	if err != nil {
+		return fmt.Errorf("cannot encode %s: %w", name, err)
+	}
+	o := &UploadOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return c.put(ctx, name, bytes.NewBuffer(data), o)
+}
+
+func (c *Client) put(ctx context.Context, name string, body *bytes.Buffer, o *UploadOptions) error {
+	storage := c.Storage
+	if storage == "" {
+		storage = DefaultStorage
+	}
+	segments := []string{"api", "v1", "files", url.PathEscape(storage)}
+	for _, s := range strings.Split(strings.Trim(name, "/"), "/") {
+		segments = append(segments, url.PathEscape(s))
+	}
+	endpoint := strings.TrimSuffix(c.BaseURL, "/") + "/" + strings.Join(segments, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("cannot upload %s: %w", name, err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Api-Key", c.APIKey)
+	req.Header.Set("Print-After-Upload", structuredBool(o.PrintAfterUpload))
+	req.Header.Set("Overwrite", structuredBool(o.Overwrite))
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot upload %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	return fmt.Errorf("cannot upload %s: %w", name, &StatusError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(msg)),
+	})
+}
+
+// structuredBool formats a boolean as an HTTP structured field, as PrusaLink
+// expects in headers.
+func structuredBool(b bool) string {
+	if b {
+		return "?1"
+	}
+	return "?0"
+}
@@ -0,0 +1,122 @@
+package prusalink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"cirello.io/bgcodego"
+)
+
+const fixture = "../_testdata/mini_cube_b"
+
+func checkErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type upload struct {
+	path    string
+	headers http.Header
+	body    []byte
+}
+
+func newPrinter(t *testing.T) (*httptest.Server, *[]upload) {
+	t.Helper()
+	var uploads []upload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("X-Api-Key") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength != int64(len(body)) {
+			http.Error(w, "missing content length", http.StatusLengthRequired)
+			return
+		}
+		for _, u := range uploads {
+			if u.path == r.URL.EscapedPath() && r.Header.Get("Overwrite") != "?1" {
+				http.Error(w, "file exists", http.StatusConflict)
+				return
+			}
+		}
+		uploads = append(uploads, upload{r.URL.EscapedPath(), r.Header, body})
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &uploads
+}
+
+func TestClient_Upload(t *testing.T) {
+	bgcode, err := os.ReadFile(fixture + ".bgcode")
+	checkErr(t, err)
+	gcode, err := os.ReadFile(fixture + ".gcode")
+	checkErr(t, err)
+	srv, uploads := newPrinter(t)
+	ctx := context.Background()
+
+	c := &Client{BaseURL: srv.URL + "/", APIKey: "secret"}
+	checkErr(t, c.Upload(ctx, "prints/mini cube.bgcode", bytes.NewReader(bgcode), WithPrintAfterUpload()))
+	got := (*uploads)[0]
+	if got.path != "/api/v1/files/usb/prints/mini%20cube.bgcode" {
+		t.Errorf("unexpected path: %s", got.path)
+	}
+	if got.headers.Get("Print-After-Upload") != "?1" || got.headers.Get("Overwrite") != "?0" {
+		t.Errorf("unexpected headers: %v", got.headers)
+	}
+	if !bytes.Equal(got.body, bgcode) {
+		t.Error("unexpected body")
+	}
+
+	var se *StatusError
+	err = c.Upload(ctx, "prints/mini cube.bgcode", bytes.NewReader(bgcode))
+	if !errors.As(err, &se) || se.StatusCode != http.StatusConflict || se.Message != "file exists" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	checkErr(t, c.Upload(ctx, "prints/mini cube.bgcode", bytes.NewReader(bgcode), WithOverwrite()))
+
+	c = &Client{BaseURL: srv.URL, APIKey: "secret", Storage: "local", ConvertToBGCode: true}
+	checkErr(t, c.Upload(ctx, "mini_cube_b.gcode", bytes.NewReader(gcode)))
+	got = (*uploads)[len(*uploads)-1]
+	if got.path != "/api/v1/files/local/mini_cube_b.bgcode" {
+		t.Errorf("unexpected path: %s", got.path)
+	}
+	rendered, err := bgcodego.Parse(bytes.NewReader(got.body))
+	checkErr(t, err)
+	if rendered != string(gcode) {
+		t.Error("unexpected converted body")
+	}
+	if err := c.Upload(ctx, "notes.txt", strings.NewReader("\x00\x01")); !errors.Is(err, bgcodego.ErrUnknownFormat) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	c = &Client{BaseURL: srv.URL, APIKey: "wrong"}
+	if err := c.Upload(ctx, "mini_cube_b.bgcode", bytes.NewReader(bgcode)); !errors.As(err, &se) || se.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestClient_UploadFile(t *testing.T) {
+	f, err := bgcodego.DecodeFile(fixture + ".bgcode")
+	checkErr(t, err)
+	srv, uploads := newPrinter(t)
+	c := &Client{BaseURL: srv.URL, APIKey: "secret", EncodeOptions: []bgcodego.EncodeOption{bgcodego.WithGCodeEncoding(bgcodego.GCodeEncodingMeatpackWithComments)}}
+	checkErr(t, c.UploadFile(context.Background(), "mini_cube_b.bgcode", f))
+	got, err := bgcodego.Decode(bytes.NewReader((*uploads)[0].body))
+	checkErr(t, err)
+	if got.Render() != f.Render() || got.GCode[0].Encoding() != bgcodego.GCodeEncodingMeatpackWithComments {
+		t.Error("unexpected uploaded file")
+	}
+}
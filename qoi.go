@@ -0,0 +1,173 @@
+package bgcodego
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+)
+
+// decodeQOI decodes an image in the Quite OK Image format, according to
+// https://qoiformat.org/qoi-specification.pdf
+func decodeQOI(data []byte) (image.Image, error) {
+	const (
+		headerSize = 14
+		opIndex    = 0b00000000
+		opDiff     = 0b01000000
+		opLuma     = 0b10000000
+		opRun      = 0b11000000
+		opRGB      = 0b11111110
+		opRGBA     = 0b11111111
+		opMask     = 0b11000000
+		maxRun     = 62
+
+		// maxPixels bounds the decoded image to the default limit on
+		// thumbnail blocks, 2048x2048 pixels, which is far above the
+		// thumbnails of any printer.
+		maxPixels = DefaultMaxThumbnailSize / 4
+	)
+	if len(data) < headerSize || string(data[:4]) != "qoif" {
+		return nil, errors.New("qoi: invalid header")
+	}
+	width := binary.BigEndian.Uint32(data[4:])
+	height := binary.BigEndian.Uint32(data[8:])
+	if channels := data[12]; channels != 3 && channels != 4 {
+		return nil, errors.New("qoi: invalid number of channels")
+	}
+	data = data[headerSize:]
+	pixels := uint64(width) * uint64(height)
+	if pixels > maxPixels {
+		return nil, errors.New("qoi: image too large")
+	}
+	if pixels > uint64(len(data))*maxRun {
+		return nil, errors.New("qoi: image size exceeds data")
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+	var index [64]color.NRGBA
+	px := color.NRGBA{A: 255}
+	run := 0
+	pos := 0
+	next := func() (byte, bool) {
+		if pos >= len(data) {
+			return 0, false
+		}
+		pos++
+		return data[pos-1], true
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		if run > 0 {
+			run--
+		} else {
+			b1, ok := next()
+			if !ok {
+				return nil, errors.New("qoi: truncated data")
+			}
+			switch {
+			case b1 == opRGB:
+				r, _ := next()
+				g, _ := next()
+				b, ok := next()
+				if !ok {
+					return nil, errors.New("qoi: truncated data")
+				}
+				px.R, px.G, px.B = r, g, b
+			case b1 == opRGBA:
+				r, _ := next()
+				g, _ := next()
+				b, _ := next()
+				a, ok := next()
+				if !ok {
+					return nil, errors.New("qoi: truncated data")
+				}
+				px = color.NRGBA{R: r, G: g, B: b, A: a}
+			case b1&opMask == opIndex:
+				px = index[b1]
+			case b1&opMask == opDiff:
+				px.R += (b1>>4)&0x03 - 2
+				px.G += (b1>>2)&0x03 - 2
+				px.B += b1&0x03 - 2
+			case b1&opMask == opLuma:
+				b2, ok := next()
+				if !ok {
+					return nil, errors.New("qoi: truncated data")
+				}
+				dg := b1&0x3f - 32
+				px.R += dg + (b2>>4)&0x0f - 8
+				px.G += dg
+				px.B += dg + b2&0x0f - 8
+			case b1&opMask == opRun:
+				run = int(b1 & 0x3f)
+			}
+			index[(int(px.R)*3+int(px.G)*5+int(px.B)*7+int(px.A)*11)%64] = px
+		}
+		img.Pix[i+0] = px.R
+		img.Pix[i+1] = px.G
+		img.Pix[i+2] = px.B
+		img.Pix[i+3] = px.A
+	}
+	return img, nil
+}
+
+// encodeQOI encodes an image in the Quite OK Image format, according to
+// https://qoiformat.org/qoi-specification.pdf
+func encodeQOI(img *image.NRGBA) []byte {
+	const (
+		opIndex = 0b00000000
+		opDiff  = 0b01000000
+		opLuma  = 0b10000000
+		opRun   = 0b11000000
+		opRGB   = 0b11111110
+		opRGBA  = 0b11111111
+		maxRun  = 62
+	)
+	b := img.Bounds()
+	data := []byte("qoif")
+	data = binary.BigEndian.AppendUint32(data, uint32(b.Dx()))
+	data = binary.BigEndian.AppendUint32(data, uint32(b.Dy()))
+	data = append(data, 4, 0)
+	var index [64]color.NRGBA
+	prev := color.NRGBA{A: 255}
+	run := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			px := img.NRGBAAt(x, y)
+			if px == prev {
+				if run++; run == maxRun {
+					data = append(data, opRun|byte(run-1))
+					run = 0
+				}
+				continue
+			}
+			if run > 0 {
+				data = append(data, opRun|byte(run-1))
+				run = 0
+			}
+			hash := (int(px.R)*3 + int(px.G)*5 + int(px.B)*7 + int(px.A)*11) % 64
+			switch {
+			case index[hash] == px:
+				data = append(data, opIndex|byte(hash))
+			case px.A != prev.A:
+				data = append(data, opRGBA, px.R, px.G, px.B, px.A)
+			default:
+				dr := int(int8(px.R - prev.R))
+				dg := int(int8(px.G - prev.G))
+				db := int(int8(px.B - prev.B))
+				drg, dbg := dr-dg, db-dg
+				switch {
+				case dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1:
+					data = append(data, opDiff|byte(dr+2)<<4|byte(dg+2)<<2|byte(db+2))
+				case dg >= -32 && dg <= 31 && drg >= -8 && drg <= 7 && dbg >= -8 && dbg <= 7:
+					data = append(data, opLuma|byte(dg+32), byte(drg+8)<<4|byte(dbg+8))
+				default:
+					data = append(data, opRGB, px.R, px.G, px.B)
+				}
+			}
+			index[hash] = px
+			prev = px
+		}
+	}
+	if run > 0 {
+		data = append(data, opRun|byte(run-1))
+	}
+	return append(data, 0, 0, 0, 0, 0, 0, 0, 1)
+}
@@ -0,0 +1,80 @@
+package bgcodego
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeQOI(t *testing.T) {
+	header := []byte{'q', 'o', 'i', 'f', 0, 0, 0, 3, 0, 0, 0, 2, 4, 0}
+	ops := []byte{
+		0xFE, 10, 20, 30, // RGB
+		0x79,       // DIFF +1 0 -1
+		0xA5, 0xA5, // LUMA +5, +2 -3
+		0x09,             // INDEX of the first pixel
+		0xFF, 1, 2, 3, 4, // RGBA
+		0xC0, // RUN 1
+	}
+	end := []byte{0, 0, 0, 0, 0, 0, 0, 1}
+	data := append(append(append([]byte{}, header...), ops...), end...)
+	img, err := decodeQOI(data)
+	checkErr(t, err)
+	want := []color.NRGBA{
+		{10, 20, 30, 255}, {11, 20, 29, 255}, {18, 25, 31, 255},
+		{10, 20, 30, 255}, {1, 2, 3, 4}, {1, 2, 3, 4},
+	}
+	var got []color.NRGBA
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			got = append(got, img.At(x, y).(color.NRGBA))
+		}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("decodeQOI() mismatch (-want +got):\n%s", diff)
+	}
+
+	bt := &BlockThumbnail{Body: data}
+	bt.header.Format = BlockThumbnailFormatQOI
+	if _, err := bt.Image(); err != nil {
+		t.Errorf("unexpected error decoding QOI thumbnail: %v", err)
+	}
+
+	invalid := map[string][]byte{
+		"bad magic": append([]byte("qoix"), data[4:]...),
+		"truncated": append(append([]byte{}, header...), ops[:8]...),
+		"too large": append([]byte{'q', 'o', 'i', 'f', 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 4, 0}, end...),
+	}
+	for name, data := range invalid {
+		if _, err := decodeQOI(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	// Enough data for the declared size, yet too large to allocate.
+	huge := append([]byte{'q', 'o', 'i', 'f', 0, 0, 0x10, 0, 0, 0, 0x10, 0, 4, 0}, make([]byte, 4096*4096/62+1)...)
+	if _, err := decodeQOI(huge); err == nil || err.Error() != "qoi: image too large" {
+		t.Errorf("expected image too large error, got: %v", err)
+	}
+}
+
+func TestEncodeQOI(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 70, 3))
+	for i := 0; i < len(img.Pix); i += 4 {
+		switch px := i / 4; {
+		case px < 65: // long run
+			copy(img.Pix[i:], []byte{0, 0, 0, 255})
+		case px%3 == 0:
+			copy(img.Pix[i:], []byte{byte(px), byte(px * 7), 200, 255})
+		default:
+			copy(img.Pix[i:], []byte{byte(px * 31), byte(px), byte(px * 3), byte(px * 5)})
+		}
+	}
+	got, err := decodeQOI(encodeQOI(img))
+	checkErr(t, err)
+	if diff := cmp.Diff(img, got); diff != "" {
+		t.Errorf("encodeQOI() round trip mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,389 @@
+package bgcodego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Reader reads a BGCode input block by block, letting callers inspect each
+// block header before deciding whether to decode or skip the block.
+type Reader struct {
+	// Header is the file header, read by NewReader.
+	Header FileHeader
+
+	// Warnings lists the non-fatal issues found so far.
+	Warnings []Warning
+
+	// Stats totals the blocks read so far.
+	Stats BlockStats
+
+	o      *DecodeOptions
+	cr     *countingReader
+	seeker io.Seeker // set when skipped blocks are seeked past
+	total  int64
+	idx    int
+	cur    *Block
+	err    error
+}
+
+// NewReader reads the file header of a BGCode input and prepares to read its
+// blocks.
+func NewReader(r io.Reader, opts ...DecodeOption) (*Reader, error) {
+	return newReader(r, newDecodeOptions(opts))
+}
+
+func newReader(r io.Reader, o *DecodeOptions) (*Reader, error) {
+	wrapped, size := false, int64(0)
+	if o.DetectContainers {
+		var err error
+		if r, wrapped, size, err = unwrapContainer(r); err != nil {
+			return nil, err
+		}
+	}
+	br := &Reader{
+		o:  o,
+		cr: &countingReader{r: r},
+	}
+	switch {
+	case o.Progress == nil:
+	case wrapped:
+		br.total = size
+	default:
+		br.total = o.totalSize(r)
+	}
+	if s, ok := r.(io.Seeker); ok && o.seekSkipped && !wrapped {
+		br.seeker = s
+	}
+	if o.ctx != nil {
+		br.cr.r = &ctxReader{ctx: o.ctx, r: r}
+	}
+	if err := br.Header.Parse(br.cr); err != nil {
+		return nil, fmt.Errorf("cannot parse file header: %w", err)
+	}
+	return br, nil
+}
+
+// Block is a block of a BGCode input whose header has been read. Its
+// contents are either decoded with Decode or skipped with Skip; blocks left
+// untouched are skipped by the next call to Reader.NextBlock. Either way,
+// the block checksum is verified, unless decoding with WithSkipChecksum.
+type Block struct {
+	Header *BlockHeader
+	Index  int   // Position of the block in the file, starting at 0
+	Offset int64 // Position of the block header in the input
+
+	r      *Reader
+	body   io.Reader // block contents, as they are read from the input
+	sum    hash.Hash // checksum of the block, computed as it is read
+	params []byte
+	done   bool
+
+	replaced     bool // set by Replace
+	replacements []BlockRenderer
+	inserted     []BlockRenderer
+}
+
+// NextBlock reads the header of the next block. It returns io.EOF when there
+// are no more blocks.
+func (r *Reader) NextBlock() (*Block, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.cur != nil && !r.cur.done {
+		if err := r.cur.Skip(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if r.o.ctx != nil {
+			if err := r.o.ctx.Err(); err != nil {
+				r.err = err
+				return nil, err
+			}
+		}
+		b, err := r.nextBlock()
+		if err != nil {
+			r.err = err
+			return nil, err
+		}
+		r.cur = b
+		if b.Header.Type().IsValid() {
+			return b, nil
+		}
+		r.Warnings = append(r.Warnings, Warning{
+			Index:   b.Index,
+			Offset:  b.Offset,
+			Message: fmt.Sprintf("skipped block of unknown type %d", b.Header.Type()),
+		})
+		if err := b.Skip(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *Reader) nextBlock() (*Block, error) {
+	b := &Block{
+		Header: &BlockHeader{fileLayout: r.Header.layout(), offset: r.cr.n},
+		Index:  r.idx,
+		Offset: r.cr.n,
+		r:      r,
+		body:   r.cr,
+	}
+	if r.verifies() {
+		b.sum = r.Header.ChecksumType.newHash()
+		b.body = io.TeeReader(r.cr, b.sum)
+	}
+	err := b.Header.Parse(b.body)
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	r.idx++
+	unknown := skippable(err)
+	if err != nil && !(unknown && r.o.SkipUnknownBlocks) {
+		return nil, b.blockErr(fmt.Errorf("cannot parse block header: %w", err))
+	}
+	if err := r.o.checkLimits(b.Header, b.Index); err != nil {
+		return nil, b.blockErr(err)
+	}
+	r.Stats.add(b.Header)
+	if r.o.Strict && b.Index == 0 && b.Header.Type() != BlockHeaderTypeFileMetadata {
+		return nil, b.blockErr(ErrUnexpectedFirstBlock)
+	}
+	return b, nil
+}
+
+// verifies reports whether block checksums are to be verified.
+func (r *Reader) verifies() bool {
+	return r.Header.ChecksumType != ChecksumTypeNone && !r.o.SkipChecksum && r.o.ChecksumPolicy != ChecksumIgnore
+}
+
+// Decode decodes the contents of the block, returning one of
+// *BlockFileMetadata, *BlockPrinterMetadata, *BlockThumbnail,
+// *BlockPrintMetadata, *BlockSlicerMetadata, *BlockGCode, or the block
+// constructed for types registered with RegisterBlockType.
+func (b *Block) Decode() (BlockRenderer, error) {
+	if b.done {
+		return nil, errors.New("block already consumed")
+	}
+	block := newBlock(b.Header.Type())
+	if bg, ok := block.(*BlockGCode); ok {
+		bg.keepPacked = b.r.o.KeepPacked
+		bg.filters = b.r.o.gcodeFilters()
+	}
+	contents := io.LimitReader(b.body, int64(b.Header.ParametersSize())+int64(b.Header.Length()))
+	if err := block.Parse(contents, b.Header); err != nil {
+		return nil, b.fail(fmt.Errorf("cannot parse %v block: %w", b.Header.Type(), err))
+	}
+	if _, err := io.Copy(io.Discard, contents); err != nil {
+		return nil, b.fail(fmt.Errorf("cannot skip %v block: %w", b.Header.Type(), err))
+	}
+	if err := b.finish(); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// writeGCode decodes the contents of a G-code block straight into w, without
+// holding the decoded G-code in memory.
+func (b *Block) writeGCode(w io.Writer) error {
+	if b.done {
+		return errors.New("block already consumed")
+	}
+	var encoding GCodeEncoding
+	if err := binary.Read(b.body, binary.LittleEndian, &encoding); err != nil {
+		return b.fail(fmt.Errorf("cannot read block parameters: %w", err))
+	}
+	data := &io.LimitedReader{R: b.body, N: int64(b.Header.Length())}
+	inflater, release, err := b.Header.inflater(data)
+	if err != nil {
+		return b.fail(err)
+	}
+	gcode, err := decodeGCode(inflater, encoding, b.r.o)
+	if err != nil {
+		return b.fail(err)
+	}
+	ew := &errWriter{w: w}
+	if _, err := io.Copy(ew, gcode); err != nil {
+		if ew.err != nil {
+			return b.fail(ew.err)
+		}
+		return b.fail(fmt.Errorf("cannot inflate block data: %w", err))
+	}
+	release()
+	if _, err := io.Copy(io.Discard, data); err != nil {
+		return b.fail(fmt.Errorf("cannot read block data: %w", err))
+	}
+	if data.N > 0 {
+		return b.fail(fmt.Errorf("cannot read block data: %w", io.ErrUnexpectedEOF))
+	}
+	return b.finish()
+}
+
+// RawBody returns the contents of the block once decompressed, but before
+// any further decoding, such as Meatpack or INI. The block parameters are
+// available through Parameters afterwards.
+func (b *Block) RawBody() ([]byte, error) {
+	if b.done {
+		return nil, errors.New("block already consumed")
+	}
+	params := make([]byte, b.Header.ParametersSize())
+	if _, err := io.ReadFull(b.body, params); err != nil {
+		return nil, b.fail(fmt.Errorf("cannot read block parameters: %w", err))
+	}
+	data := make([]byte, b.Header.Length())
+	if _, err := io.ReadFull(b.body, data); err != nil {
+		return nil, b.fail(fmt.Errorf("cannot read block data: %w", err))
+	}
+	data, err := b.Header.Inflate(data)
+	if err != nil {
+		return nil, b.fail(err)
+	}
+	if err := b.finish(); err != nil {
+		return nil, err
+	}
+	b.params = params
+	return data, nil
+}
+
+// Parameters returns the raw block parameters read by RawBody, such as the
+// encoding of metadata and G-code blocks, or the format and size of
+// thumbnails.
+func (b *Block) Parameters() []byte {
+	return b.params
+}
+
+// Skip consumes the contents of the block without decoding them.
+func (b *Block) Skip() error {
+	if b.done {
+		return nil
+	}
+	if b.r.seeker != nil {
+		return b.seekPast()
+	}
+	if err := skipBlock(b.body, b.Header); err != nil {
+		return b.fail(fmt.Errorf("cannot skip %v block: %w", b.Header.Type(), err))
+	}
+	return b.finish()
+}
+
+// seekPast skips the contents of the block and its checksum by seeking,
+// without verifying them.
+func (b *Block) seekPast() error {
+	n := int64(b.Header.ParametersSize()) + int64(b.Header.Length()) + int64(b.r.Header.ChecksumType.Size())
+	if _, err := b.r.seeker.Seek(n, io.SeekCurrent); err != nil {
+		return b.fail(fmt.Errorf("cannot skip %v block: %w", b.Header.Type(), err))
+	}
+	b.r.cr.n += n
+	b.done = true
+	b.r.progress(b)
+	return nil
+}
+
+// finish verifies the checksum of the block once its contents are consumed.
+func (b *Block) finish() error {
+	b.done = true
+	if size := b.r.Header.ChecksumType.Size(); size > 0 {
+		end := b.r.cr.n
+		footer := make([]byte, size)
+		if _, err := io.ReadFull(b.r.cr, footer); err != nil {
+			return b.fail(fmt.Errorf("cannot read checksum footer: %w", err))
+		}
+		if b.r.verifies() {
+			if sum := b.sum.Sum(nil); !bytes.Equal(footer, sum) {
+				err := &ChecksumError{Type: b.r.Header.ChecksumType, Stored: footer, Computed: sum, Start: b.Offset, End: end}
+				if b.r.o.ChecksumPolicy != ChecksumWarn {
+					return b.fail(err)
+				}
+				b.r.Warnings = append(b.r.Warnings, Warning{
+					Index:   b.Index,
+					Offset:  b.Offset,
+					Message: err.Error(),
+				})
+			}
+		}
+	}
+	b.r.progress(b)
+	return nil
+}
+
+func (r *Reader) progress(b *Block) {
+	if r.o.Progress != nil {
+		r.o.Progress(ProgressEvent{
+			BytesRead:  r.cr.n,
+			TotalBytes: r.total,
+			Blocks:     b.Index + 1,
+			BlockType:  b.Header.Type(),
+		})
+	}
+}
+
+// fail records err as the sticky error of the reader.
+func (b *Block) fail(err error) error {
+	b.done = true
+	b.r.err = b.blockErr(err)
+	return b.r.err
+}
+
+func (b *Block) blockErr(err error) error {
+	return &BlockError{
+		Type:   b.Header.Type(),
+		Index:  b.Index,
+		Offset: b.Offset,
+		At:     b.r.cr.n,
+		Err:    err,
+	}
+}
+
+// decodeEach decodes the blocks wanted by the decoding options, handing them
+// to fn, and skips the others. Errors returned by fn are reported as
+// failures of the block being handed.
+func (r *Reader) decodeEach(fn func(BlockRenderer) error) error {
+	for {
+		b, err := r.NextBlock()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !r.o.wants(b.Header.Type()) {
+			if err := b.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		block, err := b.Decode()
+		if err != nil {
+			return err
+		}
+		if err := fn(block); err != nil {
+			return b.fail(err)
+		}
+	}
+}
+
+// Verify checks the integrity of a BGCode input without decoding it: the
+// file and block headers are validated, every block is read to its declared
+// size and its checksum verified, but block contents are neither
+// decompressed nor rendered. Inputs without checksums are only checked for
+// structure.
+func Verify(r io.Reader, opts ...DecodeOption) error {
+	br, err := NewReader(r, opts...)
+	if err != nil {
+		return err
+	}
+	for {
+		b, err := br.NextBlock()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := b.Skip(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReader(t *testing.T) {
+	fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	r, err := NewReader(fd)
+	checkErr(t, err)
+	if r.Header.ChecksumType != ChecksumTypeCRC32 {
+		t.Errorf("unexpected file header: %+v", r.Header)
+	}
+	type layout struct {
+		Type   BlockHeaderType
+		Offset int64
+	}
+	var (
+		got        []layout
+		thumbnails []*BlockThumbnail
+	)
+	for {
+		b, err := r.NextBlock()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		checkErr(t, err)
+		if b.Index != len(got) {
+			t.Errorf("unexpected block index: %v", b.Index)
+		}
+		got = append(got, layout{b.Header.Type(), b.Offset})
+		switch b.Header.Type() {
+		case BlockHeaderTypeThumbnail:
+			block, err := b.Decode()
+			checkErr(t, err)
+			thumbnails = append(thumbnails, block.(*BlockThumbnail))
+		case BlockHeaderTypePrintMetadata:
+			checkErr(t, b.Skip())
+			if _, err := b.Decode(); err == nil {
+				t.Error("expected error decoding a skipped block")
+			}
+		}
+	}
+	want := []layout{
+		{BlockHeaderTypeFileMetadata, 10},
+		{BlockHeaderTypePrinterMetadata, 51},
+		{BlockHeaderTypeThumbnail, 410},
+		{BlockHeaderTypeThumbnail, 889},
+		{BlockHeaderTypePrintMetadata, 5743},
+		{BlockHeaderTypeSlicerMetadata, 6005},
+	}
+	for _, offset := range []int64{9406, 23961, 38899, 53384, 67984, 82456, 97611, 112133, 127356, 141890} {
+		want = append(want, layout{BlockHeaderTypeGCode, offset})
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("block layout mismatch (-want +got):\n%s", diff)
+	}
+	if len(thumbnails) != 2 || thumbnails[0].Width() != 16 || thumbnails[1].Width() != 220 {
+		t.Errorf("unexpected thumbnails: %v", thumbnails)
+	}
+}
+
+func TestReader_badChecksum(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	bgcode[500] ^= 0xFF // inside the first thumbnail body
+	r, err := NewReader(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	for {
+		_, err = r.NextBlock()
+		if err != nil {
+			break
+		}
+	}
+	var blockErr *BlockError
+	if !errors.Is(err, ErrBadChecksum) || !errors.As(err, &blockErr) || blockErr.Index != 2 {
+		t.Errorf("expected checksum failure on block 2, got: %v", err)
+	}
+	if _, err2 := r.NextBlock(); err2 != err {
+		t.Errorf("expected sticky error, got: %v", err2)
+	}
+}
+
+func TestReader_shortReads(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f, err := Decode(iotest.OneByteReader(bytes.NewReader(bgcode)))
+	checkErr(t, err)
+	if f.Render() != decodeFixture(t).Render() {
+		t.Error("unexpected output when reading one byte at a time")
+	}
+}
+
+func TestBlock_RawBody(t *testing.T) {
+	f := decodeFixture(t)
+	fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	r, err := NewReader(fd)
+	checkErr(t, err)
+	gcodeIdx := 0
+	for {
+		b, err := r.NextBlock()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		checkErr(t, err)
+		raw, err := b.RawBody()
+		checkErr(t, err)
+		if got := len(raw); got != int(b.Header.UncompressedSize()) {
+			t.Errorf("block %d: unexpected raw body size %d", b.Index, got)
+		}
+		if got := len(b.Parameters()); got != b.Header.ParametersSize() {
+			t.Errorf("block %d: unexpected parameters size %d", b.Index, got)
+		}
+		switch b.Header.Type() {
+		case BlockHeaderTypeSlicerMetadata:
+			if got := string(raw); got != string(iniEncode(f.SlicerMetadata.Values)) {
+				t.Error("unexpected slicer metadata raw body")
+			}
+		case BlockHeaderTypeGCode:
+			if got := Unbinarize(raw); got != f.GCode[gcodeIdx].Body {
+				t.Errorf("block %d: unexpected G-code raw body", b.Index)
+			}
+			gcodeIdx++
+		}
+		if _, err := b.RawBody(); err == nil {
+			t.Error("expected error reading a consumed block")
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	checkErr(t, Verify(bytes.NewReader(bgcode)))
+
+	t.Run("bad checksum", func(t *testing.T) {
+		corrupted := bytes.Clone(bgcode)
+		corrupted[500] ^= 0xFF // inside the first thumbnail body
+		err := Verify(bytes.NewReader(corrupted))
+		var be *BlockError
+		if !errors.Is(err, ErrBadChecksum) || !errors.As(err, &be) || be.Offset != 410 {
+			t.Errorf("expected ErrBadChecksum on the block at offset 410, got: %v", err)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		truncated := bgcode[:len(bgcode)-100]
+		err := Verify(bytes.NewReader(truncated))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("expected io.ErrUnexpectedEOF, got: %v", err)
+		}
+		var be *BlockError
+		if !errors.As(err, &be) || be.At != int64(len(truncated)) {
+			t.Errorf("expected failure at offset %d, got: %v", len(truncated), err)
+		}
+	})
+	t.Run("unknown block", func(t *testing.T) {
+		future, err := os.ReadFile("_testdata/future_block.bgcode")
+		checkErr(t, err)
+		if err := Verify(bytes.NewReader(future)); !errors.Is(err, ErrUnknownBlockType) {
+			t.Errorf("expected ErrUnknownBlockType, got: %v", err)
+		}
+		checkErr(t, Verify(bytes.NewReader(future), WithSkipUnknownBlocks()))
+	})
+}
@@ -0,0 +1,300 @@
+package bgcodego
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Section identifies a section of the G-code rendered from a BGCode file.
+type Section int
+
+const (
+	SectionFileMetadata Section = iota
+	SectionPrinterMetadata
+	SectionThumbnails
+	SectionGCode
+	SectionPrintMetadata
+	SectionSlicerMetadata
+	SectionCustom // Blocks of types registered with RegisterBlockType
+)
+
+// defaultSections is the order in which libbgcode renders the sections.
+var defaultSections = []Section{
+	SectionFileMetadata,
+	SectionPrinterMetadata,
+	SectionThumbnails,
+	SectionGCode,
+	SectionPrintMetadata,
+	SectionSlicerMetadata,
+	SectionCustom,
+}
+
+// RenderOptions controls how a BGCode file is rendered as G-code.
+type RenderOptions struct {
+	// Sections lists the sections to render, in order. Sections left out
+	// are omitted. When empty, sections are rendered in the order
+	// libbgcode uses: file metadata, printer metadata, thumbnails, G-code,
+	// print metadata, slicer metadata, then custom blocks.
+	Sections []Section
+
+	// OmitThumbnails leaves the thumbnails out, for printers that do not
+	// display them or to keep the output small.
+	OmitThumbnails bool
+
+	// ThumbnailLineWidth is the number of base64 characters per line of
+	// thumbnails. Defaults to 78, as PrusaSlicer wraps them.
+	ThumbnailLineWidth int
+
+	// ThumbnailCommentPrefix starts every line of thumbnails. Defaults to
+	// ";".
+	ThumbnailCommentPrefix string
+
+	// GenericThumbnailMarkers marks thumbnails of every format as in
+	// "; thumbnail begin", for parsers that only know PNG thumbnails. By
+	// default, JPG and QOI thumbnails are marked as in
+	// "; thumbnail_QOI begin", as PrusaSlicer writes them.
+	GenericThumbnailMarkers bool
+
+	// Klipper adapts the output to printers running Klipper: commands
+	// that only Prusa firmware understands, such as the M862 checks and
+	// M115 U, are commented out, and thumbnails are rendered as PNG with
+	// the markers Moonraker parses.
+	Klipper bool
+
+	// Renderers replaces the rendering of the blocks of the given types.
+	// Blocks of types registered with RegisterBlockType are rendered by
+	// their own Render method, and cannot be overridden.
+	Renderers map[BlockHeaderType]Renderer
+}
+
+// Renderer renders blocks as G-code, in place of their Render method. The
+// block is of one of the types returned by Decode, such as
+// *BlockSlicerMetadata for BlockHeaderTypeSlicerMetadata.
+type Renderer interface {
+	RenderBlock(w io.Writer, block BlockRenderer) error
+}
+
+// RendererFunc adapts a function to the Renderer interface.
+type RendererFunc func(w io.Writer, block BlockRenderer) error
+
+// RenderBlock calls fn(w, block).
+func (fn RendererFunc) RenderBlock(w io.Writer, block BlockRenderer) error {
+	return fn(w, block)
+}
+
+// RenderOption configures the rendering of a BGCode file.
+type RenderOption func(*RenderOptions)
+
+// WithoutThumbnails leaves the thumbnails out of the rendered G-code.
+func WithoutThumbnails() RenderOption {
+	return func(o *RenderOptions) {
+		o.OmitThumbnails = true
+	}
+}
+
+// WithSections renders the given sections, in order, omitting the others.
+func WithSections(sections ...Section) RenderOption {
+	return func(o *RenderOptions) {
+		o.Sections = sections
+	}
+}
+
+// WithThumbnailLineWidth wraps the base64 encoding of thumbnails at width
+// characters per line.
+func WithThumbnailLineWidth(width int) RenderOption {
+	return func(o *RenderOptions) {
+		o.ThumbnailLineWidth = width
+	}
+}
+
+// WithThumbnailCommentPrefix starts every line of thumbnails with prefix
+// instead of ";".
+func WithThumbnailCommentPrefix(prefix string) RenderOption {
+	return func(o *RenderOptions) {
+		o.ThumbnailCommentPrefix = prefix
+	}
+}
+
+// WithGenericThumbnailMarkers marks thumbnails of every format as PNG
+// thumbnails are marked.
+func WithGenericThumbnailMarkers() RenderOption {
+	return func(o *RenderOptions) {
+		o.GenericThumbnailMarkers = true
+	}
+}
+
+// WithKlipper adapts the output to printers running Klipper.
+func WithKlipper() RenderOption {
+	return func(o *RenderOptions) {
+		o.Klipper = true
+	}
+}
+
+// WithRenderer renders blocks of the given type with r.
+func WithRenderer(bht BlockHeaderType, r Renderer) RenderOption {
+	return func(o *RenderOptions) {
+		o.Renderers = maps.Clone(o.Renderers)
+		if o.Renderers == nil {
+			o.Renderers = make(map[BlockHeaderType]Renderer)
+		}
+		o.Renderers[bht] = r
+	}
+}
+
+func newRenderOptions(opts []RenderOption) *RenderOptions {
+	o := &RenderOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *RenderOptions) sections() []Section {
+	sections := o.Sections
+	if len(sections) == 0 {
+		sections = defaultSections
+	}
+	if o.OmitThumbnails {
+		sections = slices.DeleteFunc(slices.Clone(sections), func(s Section) bool {
+			return s == SectionThumbnails
+		})
+	}
+	return sections
+}
+
+// thumbnailLayout returns the comment prefix and the line width of
+// thumbnails.
+func (o *RenderOptions) thumbnailLayout() (prefix string, width int) {
+	prefix, width = o.ThumbnailCommentPrefix, o.ThumbnailLineWidth
+	if prefix == "" {
+		prefix = ";"
+	}
+	if width <= 0 {
+		width = 78
+	}
+	return prefix, width
+}
+
+// renders reports whether the section holding blocks of the given type is
+// rendered.
+func (o *RenderOptions) renders(bht BlockHeaderType) bool {
+	return slices.Contains(o.sections(), sectionOf(bht))
+}
+
+// sectionOf returns the section holding blocks of the given type.
+func sectionOf(bht BlockHeaderType) Section {
+	switch bht {
+	case BlockHeaderTypeFileMetadata:
+		return SectionFileMetadata
+	case BlockHeaderTypePrinterMetadata:
+		return SectionPrinterMetadata
+	case BlockHeaderTypeThumbnail:
+		return SectionThumbnails
+	case BlockHeaderTypeGCode:
+		return SectionGCode
+	case BlockHeaderTypePrintMetadata:
+		return SectionPrintMetadata
+	case BlockHeaderTypeSlicerMetadata:
+		return SectionSlicerMetadata
+	}
+	return SectionCustom
+}
+
+// splitSections splits the sections to render into those that precede the
+// G-code and those that follow it. When the G-code is not rendered, all
+// sections are reported as following it.
+func (o *RenderOptions) splitSections() (before, after []Section) {
+	sections := o.sections()
+	i := slices.Index(sections, SectionGCode)
+	if i < 0 {
+		return nil, sections
+	}
+	return sections[:i], sections[i+1:]
+}
+
+// renderBlock writes a block with the renderer set for its type, if any,
+// and with render otherwise.
+func (o *RenderOptions) renderBlock(out *errWriter, bht BlockHeaderType, block BlockRenderer, render func() string) {
+	r, ok := o.Renderers[bht]
+	if !ok {
+		fmt.Fprint(out, render())
+		return
+	}
+	if err := r.RenderBlock(out, block); err != nil && out.err == nil {
+		out.err = fmt.Errorf("cannot render %v block: %w", bht, err)
+	}
+}
+
+// renderGCode renders a G-code block, as renderBlock does, into the joiner
+// of G-code bodies.
+func (o *RenderOptions) renderGCode(gj *gcodeJoiner, out *errWriter, block *BlockGCode) {
+	r, ok := o.Renderers[BlockHeaderTypeGCode]
+	if !ok {
+		gj.write(block.Render())
+		return
+	}
+	body := &strings.Builder{}
+	if err := r.RenderBlock(body, block); err != nil {
+		if out.err == nil {
+			out.err = fmt.Errorf("cannot render %v block: %w", BlockHeaderTypeGCode, err)
+		}
+		return
+	}
+	gj.write(body.String())
+}
+
+// RenderTo writes the G-code rendering of the file into w, as Render does,
+// with the sections selected by opts.
+func (f *File) RenderTo(w io.Writer, opts ...RenderOption) error {
+	return f.render(w, newRenderOptions(opts))
+}
+
+// renderSection writes a section of the file. Every section but the file
+// metadata, whose rendering ends with a blank line, is preceded by a blank
+// line.
+func (f *File) renderSection(out *errWriter, s Section, o *RenderOptions) {
+	switch s {
+	case SectionFileMetadata:
+		if f.FileMetadata != nil {
+			o.renderBlock(out, BlockHeaderTypeFileMetadata, f.FileMetadata, f.FileMetadata.Render)
+		}
+	case SectionPrinterMetadata:
+		if f.PrinterMetadata != nil {
+			fmt.Fprintln(out)
+			o.renderBlock(out, BlockHeaderTypePrinterMetadata, f.PrinterMetadata, f.PrinterMetadata.Render)
+		}
+	case SectionThumbnails:
+		for _, thumbnail := range f.Thumbnails {
+			fmt.Fprintln(out)
+			o.renderBlock(out, BlockHeaderTypeThumbnail, thumbnail, func() string { return thumbnail.render(o) })
+		}
+	case SectionGCode:
+		if len(f.GCode) > 0 {
+			fmt.Fprintln(out)
+			gw, done := o.gcodeWriter(out)
+			gj := &gcodeJoiner{out: gw}
+			for _, gcode := range f.GCode {
+				o.renderGCode(gj, out, gcode)
+			}
+			done()
+		}
+	case SectionPrintMetadata:
+		if f.PrintMetadata != nil {
+			fmt.Fprintln(out)
+			o.renderBlock(out, BlockHeaderTypePrintMetadata, f.PrintMetadata, f.PrintMetadata.Render)
+		}
+	case SectionSlicerMetadata:
+		if f.SlicerMetadata != nil {
+			fmt.Fprintln(out)
+			o.renderBlock(out, BlockHeaderTypeSlicerMetadata, f.SlicerMetadata, f.SlicerMetadata.Render)
+		}
+	case SectionCustom:
+		for _, block := range f.Custom {
+			fmt.Fprintln(out)
+			fmt.Fprint(out, block.Render())
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFile_RenderTo(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f := decodeFixture(t)
+
+	out := &strings.Builder{}
+	checkErr(t, f.RenderTo(out))
+	if out.String() != f.Render() {
+		t.Error("default RenderTo output does not match Render")
+	}
+
+	tests := []struct {
+		name     string
+		sections []Section
+		check    func(t *testing.T, got string)
+	}{
+		{
+			"slicer config first",
+			[]Section{SectionFileMetadata, SectionSlicerMetadata, SectionGCode},
+			func(t *testing.T, got string) {
+				config := strings.Index(got, "; prusaslicer_config = begin")
+				gcode := strings.Index(got, f.GCode[0].Body[:20])
+				if config < 0 || gcode < 0 || config > gcode {
+					t.Error("slicer configuration does not precede the G-code")
+				}
+				if strings.Contains(got, "; thumbnail begin") {
+					t.Error("omitted thumbnails rendered")
+				}
+			},
+		},
+		{
+			"metadata only",
+			[]Section{SectionPrinterMetadata, SectionPrintMetadata},
+			func(t *testing.T, got string) {
+				want := "\n" + f.PrinterMetadata.Render() + "\n" + f.PrintMetadata.Render()
+				if got != want {
+					t.Errorf("unexpected output: %q", got)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &strings.Builder{}
+			checkErr(t, f.RenderTo(out, WithSections(tt.sections...)))
+			tt.check(t, out.String())
+			parsed, err := Parse(bytes.NewReader(bgcode), WithRenderOptions(WithSections(tt.sections...)))
+			checkErr(t, err)
+			if parsed != out.String() {
+				t.Error("Parse output does not match RenderTo")
+			}
+		})
+	}
+}
+
+func TestWithoutThumbnails(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f := decodeFixture(t)
+	want := *f
+	want.Thumbnails = nil
+
+	out := &strings.Builder{}
+	checkErr(t, f.RenderTo(out, WithoutThumbnails()))
+	if out.String() != want.Render() {
+		t.Error("unexpected RenderTo output")
+	}
+	parsed, err := Parse(bytes.NewReader(bgcode), WithRenderOptions(WithoutThumbnails()))
+	checkErr(t, err)
+	if parsed != want.Render() {
+		t.Error("unexpected Parse output")
+	}
+	out.Reset()
+	checkErr(t, f.RenderTo(out, WithoutThumbnails(), WithSections(SectionThumbnails, SectionGCode)))
+	if strings.Contains(out.String(), "; thumbnail begin") {
+		t.Error("thumbnails rendered despite WithoutThumbnails")
+	}
+}
+
+func TestRenderOptions_thumbnails(t *testing.T) {
+	qoi := &BlockThumbnail{Body: []byte("0123456789")}
+	qoi.header.Format = BlockThumbnailFormatQOI
+	qoi.header.Width, qoi.header.Height = 2, 1
+	png := &BlockThumbnail{Body: qoi.Body}
+	png.header.Width, png.header.Height = 2, 1
+	f := &File{Thumbnails: []*BlockThumbnail{qoi, png}}
+
+	out := &strings.Builder{}
+	checkErr(t, f.RenderTo(out, WithSections(SectionThumbnails), WithThumbnailLineWidth(8), WithThumbnailCommentPrefix("//")))
+	const want = "\n//\n// thumbnail_QOI begin 2x1 16\n// MDEyMzQ1\n// Njc4OQ==\n// thumbnail_QOI end\n//\n" +
+		"\n//\n// thumbnail begin 2x1 16\n// MDEyMzQ1\n// Njc4OQ==\n// thumbnail end\n//\n"
+	if out.String() != want {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	out.Reset()
+	checkErr(t, f.RenderTo(out, WithSections(SectionThumbnails)))
+	if want := "\n" + qoi.Render() + "\n" + png.Render(); out.String() != want {
+		t.Errorf("unexpected default output: %q", out)
+	}
+	if !strings.Contains(out.String(), "; thumbnail_QOI begin 2x1 16\n; MDEyMzQ1Njc4OQ==\n; thumbnail_QOI end\n") {
+		t.Errorf("unexpected default layout: %q", out)
+	}
+
+	out.Reset()
+	checkErr(t, f.RenderTo(out, WithSections(SectionThumbnails), WithGenericThumbnailMarkers()))
+	if strings.Count(out.String(), "; thumbnail begin 2x1 16\n") != 2 || strings.Contains(out.String(), "thumbnail_QOI") {
+		t.Errorf("unexpected generic markers: %q", out)
+	}
+	unknown := &BlockThumbnail{Body: qoi.Body}
+	unknown.header.Format = 42
+	if got := unknown.Render(); !strings.Contains(got, "; thumbnail begin") {
+		t.Errorf("unexpected marker for unknown format: %q", got)
+	}
+
+	// Transcode reads the thumbnails back, whatever their layout.
+	out.Reset()
+	checkErr(t, f.RenderTo(out, WithSections(SectionThumbnails), WithThumbnailLineWidth(3)))
+	bgcode := &bytes.Buffer{}
+	checkErr(t, Transcode(bgcode, strings.NewReader(out.String())))
+	got, err := Decode(bgcode)
+	checkErr(t, err)
+	if len(got.Thumbnails) != 2 || got.Thumbnails[0].Format() != BlockThumbnailFormatQOI || string(got.Thumbnails[1].Body) != "0123456789" {
+		t.Errorf("unexpected thumbnails read back: %v", got.Thumbnails)
+	}
+
+	bgcodeFixture, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	parsed, err := Parse(bytes.NewReader(bgcodeFixture), WithRenderOptions(WithThumbnailLineWidth(60)))
+	checkErr(t, err)
+	out.Reset()
+	checkErr(t, decodeFixture(t).RenderTo(out, WithThumbnailLineWidth(60)))
+	if parsed != out.String() {
+		t.Error("Parse output does not match RenderTo")
+	}
+}
+
+func TestWithRenderer(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f := decodeFixture(t)
+	slicer := RendererFunc(func(w io.Writer, block BlockRenderer) error {
+		_, err := fmt.Fprintf(w, "; %d slicer settings\n", len(block.(*BlockSlicerMetadata).Values))
+		return err
+	})
+	upper := RendererFunc(func(w io.Writer, block BlockRenderer) error {
+		_, err := io.WriteString(w, strings.ToUpper(block.Render()))
+		return err
+	})
+	opts := []RenderOption{
+		WithRenderer(BlockHeaderTypeSlicerMetadata, slicer),
+		WithRenderer(BlockHeaderTypeGCode, upper),
+	}
+	out := &strings.Builder{}
+	checkErr(t, f.RenderTo(out, opts...))
+	want := strings.Replace(f.Render(), f.SlicerMetadata.Render(), fmt.Sprintf("; %d slicer settings\n", len(f.SlicerMetadata.Values)), 1)
+	for _, gcode := range f.GCode {
+		want = strings.Replace(want, gcode.Render(), strings.ToUpper(gcode.Render()), 1)
+	}
+	if out.String() != want {
+		t.Error("unexpected RenderTo output")
+	}
+	parsed, err := Parse(bytes.NewReader(bgcode), WithRenderOptions(opts...))
+	checkErr(t, err)
+	if parsed != want {
+		t.Error("Parse output does not match RenderTo")
+	}
+
+	errRender := errors.New("cannot render")
+	failing := RendererFunc(func(io.Writer, BlockRenderer) error { return errRender })
+	for _, bht := range []BlockHeaderType{BlockHeaderTypeThumbnail, BlockHeaderTypeGCode} {
+		if err := f.RenderTo(io.Discard, WithRenderer(bht, failing)); !errors.Is(err, errRender) {
+			t.Errorf("%v: unexpected error: %v", bht, err)
+		}
+		if _, err := Parse(bytes.NewReader(bgcode), WithRenderOptions(WithRenderer(bht, failing))); !errors.Is(err, errRender) {
+			t.Errorf("%v: unexpected Parse error: %v", bht, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RepairedBlock reports a block whose checksum footer was rewritten by
+// Repair.
+type RepairedBlock struct {
+	Type     BlockHeaderType
+	Index    int    // Position of the block in the file, starting at 0
+	Offset   int64  // Position of the block header in the input
+	Stored   []byte // Footer read from the input
+	Computed []byte // Footer written to the output
+}
+
+// Repair copies the BGCode input r to w, rewriting the checksum footers that
+// do not match the contents of their blocks, and reports the blocks it
+// fixed. Every block is decoded along the way, so that blocks whose contents
+// cannot be decoded fail the repair instead of being stamped with a checksum
+// that would hide the damage. For the same reason, blocks of unknown type
+// are only copied when their checksum matches.
+func Repair(w io.Writer, r io.Reader) ([]RepairedBlock, error) {
+	capture := &bytes.Buffer{}
+	o := newDecodeOptions(nil)
+	o.SkipChecksum = true
+	o.SkipUnknownBlocks = true
+	br, err := newReader(io.TeeReader(r, capture), o)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(capture.Bytes()); err != nil {
+		return nil, fmt.Errorf("cannot write file header: %w", err)
+	}
+	var repaired []RepairedBlock
+	for {
+		capture.Reset()
+		b, err := br.nextBlock()
+		if errors.Is(err, io.EOF) {
+			return repaired, nil
+		} else if err != nil {
+			return repaired, err
+		}
+		br.cur = b
+		known := b.Header.Type().IsValid()
+		if known {
+			_, err = b.Decode()
+		} else {
+			err = b.Skip()
+		}
+		if err != nil {
+			return repaired, err
+		}
+		block := capture.Bytes()
+		contents, footer, computed := br.Header.ChecksumType.checkFooter(block)
+		if !bytes.Equal(footer, computed) {
+			if !known {
+				return repaired, b.blockErr(&ChecksumError{
+					Type:     br.Header.ChecksumType,
+					Stored:   footer,
+					Computed: computed,
+					Start:    b.Offset,
+					End:      b.Offset + int64(len(contents)),
+				})
+			}
+			repaired = append(repaired, RepairedBlock{
+				Type:     b.Header.Type(),
+				Index:    b.Index,
+				Offset:   b.Offset,
+				Stored:   bytes.Clone(footer),
+				Computed: computed,
+			})
+			block = append(contents, computed...)
+		}
+		if _, err := w.Write(block); err != nil {
+			return repaired, b.blockErr(fmt.Errorf("cannot write %v block: %w", b.Header.Type(), err))
+		}
+	}
+}
+
+// checkFooter splits a block, as read from the input, into its contents and
+// its checksum footer, and computes the checksum of the contents. The footer
+// and the checksum are nil when the file has no checksums.
+func (ct ChecksumType) checkFooter(block []byte) (contents, footer, computed []byte) {
+	sum := ct.newHash()
+	if sum == nil || len(block) < sum.Size() {
+		return block, nil, nil
+	}
+	contents, footer = block[:len(block)-sum.Size()], block[len(block)-sum.Size():]
+	sum.Write(contents)
+	return contents, footer, sum.Sum(nil)
+}
@@ -0,0 +1,66 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRepair(t *testing.T) {
+	input, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	r, err := NewReader(bytes.NewReader(input))
+	checkErr(t, err)
+	var ends []int64 // offset of the end of each block
+	for {
+		b, err := r.NextBlock()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		checkErr(t, err)
+		if len(ends) > 0 {
+			ends[len(ends)-1] = b.Offset
+		}
+		ends = append(ends, int64(len(input)))
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		var buf bytes.Buffer
+		repaired, err := Repair(&buf, bytes.NewReader(input))
+		checkErr(t, err)
+		if len(repaired) != 0 || !bytes.Equal(buf.Bytes(), input) {
+			t.Errorf("unexpected repair of intact file: %v", repaired)
+		}
+	})
+	t.Run("footers", func(t *testing.T) {
+		damaged := bytes.Clone(input)
+		damaged[ends[2]-1] ^= 0xff
+		damaged[ends[6]-4] ^= 0x01
+		var buf bytes.Buffer
+		repaired, err := Repair(&buf, bytes.NewReader(damaged))
+		checkErr(t, err)
+		want := []RepairedBlock{
+			{Type: BlockHeaderTypeThumbnail, Index: 2, Offset: ends[1], Stored: damaged[ends[2]-4 : ends[2]], Computed: input[ends[2]-4 : ends[2]]},
+			{Type: BlockHeaderTypeGCode, Index: 6, Offset: ends[5], Stored: damaged[ends[6]-4 : ends[6]], Computed: input[ends[6]-4 : ends[6]]},
+		}
+		if diff := cmp.Diff(want, repaired); diff != "" {
+			t.Errorf("Repair() mismatch (-want +got):\n%s", diff)
+		}
+		if !bytes.Equal(buf.Bytes(), input) {
+			t.Error("repaired file differs from the original")
+		}
+	})
+	t.Run("contents", func(t *testing.T) {
+		damaged := bytes.Clone(input)
+		damaged[ends[6]-100] ^= 0xff
+		_, err := Repair(io.Discard, bytes.NewReader(damaged))
+		var be *BlockError
+		if !errors.As(err, &be) || be.Index != 6 {
+			t.Errorf("expected error on block 6, got: %v", err)
+		}
+	})
+}
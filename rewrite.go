@@ -0,0 +1,114 @@
+package bgcodego
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Rewrite copies the BGCode input r to w block by block, handing each block
+// to edit, which may decode it and call Block.Replace to substitute other
+// blocks for it, or Block.Insert to add blocks ahead of it. Blocks that are
+// not replaced are copied byte for byte, checksum included, and blocks of
+// unknown type are copied without being handed to edit. New blocks are
+// written with the checksum type of the input and the compression of the
+// block they replace or precede, and G-code blocks keep their encoding.
+func Rewrite(w io.Writer, r io.Reader, edit func(*Block) error) error {
+	capture := &bytes.Buffer{}
+	o := newDecodeOptions(nil)
+	o.SkipUnknownBlocks = true
+	br, err := newReader(io.TeeReader(r, capture), o)
+	if err != nil {
+		return err
+	}
+	bw := &Writer{
+		w: w,
+		opts: &EncodeOptions{
+			MetadataEncoding: BlockEncodingINI,
+			LineEnding:       LineEndingLF,
+			ChecksumType:     br.Header.ChecksumType,
+			CompressionLevel: zlib.DefaultCompression,
+		},
+		wroteHeader: true,
+	}
+	if _, err := w.Write(capture.Bytes()); err != nil {
+		return fmt.Errorf("cannot write file header: %w", err)
+	}
+	for {
+		capture.Reset()
+		b, err := br.nextBlock()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		br.cur = b
+		if b.Header.Type().IsValid() {
+			if err := edit(b); err != nil {
+				return b.fail(err)
+			}
+		}
+		if err := b.Skip(); err != nil {
+			return err
+		}
+		if br.err != nil {
+			return br.err
+		}
+		bw.opts.Compression = b.Header.Compression()
+		for _, block := range b.inserted {
+			if err := bw.writeBlockRenderer(block); err != nil {
+				return b.blockErr(err)
+			}
+		}
+		if !b.replaced {
+			if _, err := w.Write(capture.Bytes()); err != nil {
+				return b.blockErr(fmt.Errorf("cannot write %v block: %w", b.Header.Type(), err))
+			}
+			continue
+		}
+		for _, block := range b.replacements {
+			if err := bw.writeBlockRenderer(block); err != nil {
+				return b.blockErr(err)
+			}
+		}
+	}
+}
+
+// Replace substitutes blocks for the block being rewritten by Rewrite, and
+// has no effect otherwise. Blocks are of the types returned by Decode, save
+// for those of types registered with RegisterBlockType. Replacing a block
+// with nothing removes it, and replacing it with itself, as decoded, along
+// with other blocks inserts them around it.
+func (b *Block) Replace(blocks ...BlockRenderer) {
+	b.replaced = true
+	b.replacements = blocks
+}
+
+// Insert writes blocks ahead of the block being rewritten by Rewrite, which
+// is kept unless replaced, and has no effect otherwise.
+func (b *Block) Insert(blocks ...BlockRenderer) {
+	b.inserted = append(b.inserted, blocks...)
+}
+
+// writeBlockRenderer writes a block of one of the types returned by
+// Block.Decode.
+func (w *Writer) writeBlockRenderer(block BlockRenderer) error {
+	switch block := block.(type) {
+	case *BlockFileMetadata:
+		return w.WriteFileMetadata(block.Values)
+	case *BlockPrinterMetadata:
+		return w.WritePrinterMetadata(block.Values)
+	case *BlockPrintMetadata:
+		return w.WritePrintMetadata(block.Values)
+	case *BlockSlicerMetadata:
+		return w.WriteSlicerMetadata(block.Values)
+	case *BlockThumbnail:
+		return w.WriteThumbnail(block.Format(), block.Width(), block.Height(), block.Body)
+	case *BlockGCode:
+		w.opts.GCodeEncoding = block.Encoding()
+		return w.writeGCode(block.Body)
+	}
+	return fmt.Errorf("cannot write %T blocks", block)
+}
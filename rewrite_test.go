@@ -0,0 +1,128 @@
+package bgcodego
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRewrite(t *testing.T) {
+	input, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	want, err := Decode(bytes.NewReader(input))
+	checkErr(t, err)
+
+	t.Run("untouched", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := Rewrite(&buf, bytes.NewReader(input), func(b *Block) error {
+			if b.Header.Type() == BlockHeaderTypeThumbnail {
+				_, err := b.Decode()
+				return err
+			}
+			return nil
+		})
+		checkErr(t, err)
+		if !bytes.Equal(buf.Bytes(), input) {
+			t.Error("untouched blocks must be copied verbatim")
+		}
+	})
+	t.Run("metadata", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := Rewrite(&buf, bytes.NewReader(input), func(b *Block) error {
+			if b.Header.Type() != BlockHeaderTypePrinterMetadata {
+				return nil
+			}
+			block, err := b.Decode()
+			if err != nil {
+				return err
+			}
+			bprm := block.(*BlockPrinterMetadata)
+			bprm.Values.Set("printer_model", "MK4S")
+			b.Replace(bprm)
+			return nil
+		})
+		checkErr(t, err)
+		checkErr(t, Verify(bytes.NewReader(buf.Bytes())))
+		got, err := Decode(bytes.NewReader(buf.Bytes()))
+		checkErr(t, err)
+		if v := got.PrinterMetadata.Values.First("printer_model"); v != "MK4S" {
+			t.Errorf("unexpected printer model: %q", v)
+		}
+		want.PrinterMetadata.Values.Set("printer_model", "MK4S")
+		if diff := cmp.Diff(want.Render(), got.Render()); diff != "" {
+			t.Errorf("unexpected rewrite: %s", diff)
+		}
+	})
+	t.Run("deflate", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := Rewrite(&buf, bytes.NewReader(input), func(b *Block) error {
+			if b.Header.Type() != BlockHeaderTypeSlicerMetadata {
+				return nil
+			}
+			block, err := b.Decode()
+			if err != nil {
+				return err
+			}
+			b.Replace(block)
+			return nil
+		})
+		checkErr(t, err)
+		report, err := Inspect(bytes.NewReader(buf.Bytes()))
+		checkErr(t, err)
+		for _, b := range report.Blocks {
+			if b.Type == BlockHeaderTypeSlicerMetadata && (b.Compression != BlockHeaderCompressionDeflate || b.CompressionRatio < 2) {
+				t.Errorf("rewritten slicer metadata must stay compressed: %+v", b)
+			}
+		}
+	})
+	t.Run("thumbnails", func(t *testing.T) {
+		qoi := &BlockThumbnail{Body: []byte("qoif")}
+		qoi.header.Format = BlockThumbnailFormatQOI
+		qoi.header.Width, qoi.header.Height = 1, 1
+		var (
+			buf  bytes.Buffer
+			seen int
+		)
+		err := Rewrite(&buf, bytes.NewReader(input), func(b *Block) error {
+			if b.Header.Type() != BlockHeaderTypeThumbnail {
+				return nil
+			}
+			switch seen++; seen {
+			case 1:
+				b.Replace()
+			case len(want.Thumbnails):
+				block, err := b.Decode()
+				if err != nil {
+					return err
+				}
+				b.Replace(block, qoi)
+			}
+			return nil
+		})
+		checkErr(t, err)
+		checkErr(t, Verify(bytes.NewReader(buf.Bytes())))
+		got, err := Decode(bytes.NewReader(buf.Bytes()))
+		checkErr(t, err)
+		if len(got.Thumbnails) != len(want.Thumbnails) {
+			t.Fatalf("unexpected thumbnail count: %d", len(got.Thumbnails))
+		}
+		if diff := cmp.Diff(want.Thumbnails[1].Body, got.Thumbnails[0].Body); diff != "" {
+			t.Errorf("unexpected first thumbnail: %s", diff)
+		}
+		if last := got.Thumbnails[len(got.Thumbnails)-1]; last.Format() != BlockThumbnailFormatQOI || string(last.Body) != "qoif" {
+			t.Errorf("unexpected inserted thumbnail: %v", last.Render())
+		}
+		var wantGCode, gotGCode string
+		for _, g := range want.GCode {
+			wantGCode += g.Body
+		}
+		for _, g := range got.GCode {
+			gotGCode += g.Body
+		}
+		if wantGCode != gotGCode {
+			t.Error("G-code must survive the rewrite")
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package bgcodego
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrinterMetadata is the typed form of the printer metadata table. Per
+// extruder values are listed in extruder order. Fields whose key is missing
+// are left to their zero value.
+type PrinterMetadata struct {
+	PrinterModel    string    // printer_model
+	FilamentType    []string  // filament_type
+	NozzleDiameter  []float64 // nozzle_diameter, in millimeters
+	BedTemperature  []float64 // bed_temperature, in °C
+	Temperature     []float64 // temperature, in °C
+	BrimWidth       float64   // brim_width, in millimeters
+	FillDensity     float64   // fill_density, in percent
+	LayerHeight     float64   // layer_height, in millimeters
+	Ironing         bool      // ironing
+	SupportMaterial bool      // support_material
+	MaxLayerZ       float64   // max_layer_z, in millimeters
+
+	// ExtruderColour is read from extruder_colour or, when missing, from
+	// filament_colour.
+	ExtruderColour []string
+
+	FilamentUsedMM  []float64 // filament used [mm]
+	FilamentUsedCM3 []float64 // filament used [cm3]
+	FilamentUsedG   []float64 // filament used [g]
+	FilamentCost    []float64 // filament cost
+
+	// EstimatedTime is read from "estimated printing time (normal mode)"
+	// or, as written by older slicers, "estimated printing time".
+	EstimatedTime time.Duration
+}
+
+// PrintMetadata is the typed form of the print metadata table. Per extruder
+// values are listed in extruder order. Fields whose key is missing are left
+// to their zero value.
+type PrintMetadata struct {
+	FilamentUsedMM  []float64 // filament used [mm]
+	FilamentUsedCM3 []float64 // filament used [cm3]
+	FilamentUsedG   []float64 // filament used [g]
+	FilamentCost    []float64 // filament cost
+
+	// TotalFilamentUsedG is read from "total filament used [g]" or, as
+	// written by OrcaSlicer, "total filament weight [g]".
+	TotalFilamentUsedG float64
+	TotalFilamentCost  float64 // total filament cost
+
+	// EstimatedTime is read from "estimated printing time (normal mode)"
+	// or, as written by older slicers, "estimated printing time".
+	EstimatedTime           time.Duration
+	EstimatedSilentTime     time.Duration // estimated printing time (silent mode)
+	EstimatedFirstLayerTime time.Duration // estimated first layer printing time (normal mode)
+}
+
+// ExtruderMetadata gathers the values of the per-extruder vectors of the
+// metadata that apply to one extruder. Values missing from a shorter vector
+// are left to their zero value.
+type ExtruderMetadata struct {
+	FilamentType    string
+	NozzleDiameter  float64
+	BedTemperature  float64
+	Temperature     float64
+	Colour          string
+	FilamentUsedMM  float64
+	FilamentUsedCM3 float64
+	FilamentUsedG   float64
+	FilamentCost    float64
+}
+
+// Extruders splits the per-extruder vectors by extruder. There are as many
+// extruders as values in the longest vector.
+func (pm *PrinterMetadata) Extruders() []ExtruderMetadata {
+	n := max(len(pm.FilamentType), len(pm.NozzleDiameter), len(pm.BedTemperature),
+		len(pm.Temperature), len(pm.ExtruderColour), len(pm.FilamentUsedMM),
+		len(pm.FilamentUsedCM3), len(pm.FilamentUsedG), len(pm.FilamentCost))
+	extruders := make([]ExtruderMetadata, n)
+	for i := range extruders {
+		extruders[i] = ExtruderMetadata{
+			FilamentType:    extruderValue(pm.FilamentType, i),
+			NozzleDiameter:  extruderValue(pm.NozzleDiameter, i),
+			BedTemperature:  extruderValue(pm.BedTemperature, i),
+			Temperature:     extruderValue(pm.Temperature, i),
+			Colour:          extruderValue(pm.ExtruderColour, i),
+			FilamentUsedMM:  extruderValue(pm.FilamentUsedMM, i),
+			FilamentUsedCM3: extruderValue(pm.FilamentUsedCM3, i),
+			FilamentUsedG:   extruderValue(pm.FilamentUsedG, i),
+			FilamentCost:    extruderValue(pm.FilamentCost, i),
+		}
+	}
+	return extruders
+}
+
+// Extruders splits the filament usage by extruder. There are as many
+// extruders as values in the longest vector.
+func (pm *PrintMetadata) Extruders() []ExtruderMetadata {
+	n := max(len(pm.FilamentUsedMM), len(pm.FilamentUsedCM3), len(pm.FilamentUsedG), len(pm.FilamentCost))
+	extruders := make([]ExtruderMetadata, n)
+	for i := range extruders {
+		extruders[i] = ExtruderMetadata{
+			FilamentUsedMM:  extruderValue(pm.FilamentUsedMM, i),
+			FilamentUsedCM3: extruderValue(pm.FilamentUsedCM3, i),
+			FilamentUsedG:   extruderValue(pm.FilamentUsedG, i),
+			FilamentCost:    extruderValue(pm.FilamentCost, i),
+		}
+	}
+	return extruders
+}
+
+func extruderValue[T any](values []T, i int) T {
+	var zero T
+	if i < len(values) {
+		return values[i]
+	}
+	return zero
+}
+
+// PrinterMetadata maps the printer metadata table to its typed form. Keys
+// missing from the printer metadata are looked up in the slicer metadata,
+// which holds the full slicer configuration.
+func (m *Metadata) PrinterMetadata() (*PrinterMetadata, error) {
+	tv := &typedValues{tables: []KeyValues{m.Printer, m.Slicer}}
+	pm := &PrinterMetadata{}
+	tv.text(&pm.PrinterModel, "printer_model")
+	tv.list(&pm.FilamentType, "filament_type")
+	tv.floats(&pm.NozzleDiameter, "nozzle_diameter")
+	tv.floats(&pm.BedTemperature, "bed_temperature")
+	tv.floats(&pm.Temperature, "temperature")
+	tv.float(&pm.BrimWidth, "brim_width")
+	tv.float(&pm.FillDensity, "fill_density")
+	tv.float(&pm.LayerHeight, "layer_height")
+	tv.flag(&pm.Ironing, "ironing")
+	tv.flag(&pm.SupportMaterial, "support_material")
+	tv.float(&pm.MaxLayerZ, "max_layer_z")
+	tv.list(&pm.ExtruderColour, "extruder_colour")
+	if pm.ExtruderColour == nil {
+		// filament_colour is a distinct setting, used only in place
+		// of a missing extruder_colour.
+		tv.list(&pm.ExtruderColour, "filament_colour")
+	}
+	tv.floats(&pm.FilamentUsedMM, "filament used [mm]")
+	tv.floats(&pm.FilamentUsedCM3, "filament used [cm3]")
+	tv.floats(&pm.FilamentUsedG, "filament used [g]")
+	tv.floats(&pm.FilamentCost, "filament cost")
+	tv.duration(&pm.EstimatedTime, "estimated printing time (normal mode)")
+	if tv.err != nil {
+		return nil, fmt.Errorf("cannot map printer metadata: %w", tv.err)
+	}
+	return pm, nil
+}
+
+// PrintMetadata maps the print metadata table to its typed form. Keys
+// missing from the print metadata are looked up in the printer metadata,
+// which repeats the print statistics.
+func (m *Metadata) PrintMetadata() (*PrintMetadata, error) {
+	tv := &typedValues{tables: []KeyValues{m.Print, m.Printer}}
+	pm := &PrintMetadata{}
+	tv.floats(&pm.FilamentUsedMM, "filament used [mm]")
+	tv.floats(&pm.FilamentUsedCM3, "filament used [cm3]")
+	tv.floats(&pm.FilamentUsedG, "filament used [g]")
+	tv.floats(&pm.FilamentCost, "filament cost")
+	tv.float(&pm.TotalFilamentUsedG, "total filament used [g]")
+	tv.float(&pm.TotalFilamentCost, "total filament cost")
+	tv.duration(&pm.EstimatedTime, "estimated printing time (normal mode)")
+	tv.duration(&pm.EstimatedSilentTime, "estimated printing time (silent mode)")
+	tv.duration(&pm.EstimatedFirstLayerTime, "estimated first layer printing time (normal mode)")
+	if tv.err != nil {
+		return nil, fmt.Errorf("cannot map print metadata: %w", tv.err)
+	}
+	return pm, nil
+}
+
+// typedValues looks up canonical keys, and their aliases, in key-value
+// tables by order of precedence, and keeps the first parsing error.
+type typedValues struct {
+	tables []KeyValues
+	err    error
+}
+
+func (tv *typedValues) lookup(key string) (KeyValues, string, bool) {
+	names := keyNames(key)
+	for _, kv := range tv.tables {
+		for _, name := range names {
+			if kv.Has(name) {
+				return kv, name, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+func (tv *typedValues) text(dst *string, key string) {
+	if kv, name, ok := tv.lookup(key); ok {
+		*dst = strings.TrimSpace(kv.First(name))
+	}
+}
+
+func (tv *typedValues) list(dst *[]string, key string) {
+	if kv, name, ok := tv.lookup(key); ok && tv.err == nil {
+		*dst, tv.err = kv.Strings(name)
+	}
+}
+
+func (tv *typedValues) float(dst *float64, key string) {
+	kv, name, ok := tv.lookup(key)
+	if !ok || tv.err != nil {
+		return
+	}
+	if v := strings.TrimSpace(kv.First(name)); strings.HasSuffix(v, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil {
+			tv.err = fmt.Errorf("cannot parse %q: %w", name, err)
+		}
+		*dst = f
+		return
+	}
+	*dst, tv.err = kv.Float(name)
+}
+
+func (tv *typedValues) floats(dst *[]float64, key string) {
+	if kv, name, ok := tv.lookup(key); ok && tv.err == nil {
+		*dst, tv.err = kv.Floats(name)
+	}
+}
+
+func (tv *typedValues) duration(dst *time.Duration, key string) {
+	if kv, name, ok := tv.lookup(key); ok && tv.err == nil {
+		*dst, tv.err = kv.Duration(name)
+	}
+}
+
+func (tv *typedValues) flag(dst *bool, key string) {
+	if kv, name, ok := tv.lookup(key); ok && tv.err == nil {
+		*dst, tv.err = kv.Bool(name)
+	}
+}
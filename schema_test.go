@@ -0,0 +1,103 @@
+package bgcodego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetadata_PrinterMetadata(t *testing.T) {
+	got, err := decodeFixture(t).Metadata().PrinterMetadata()
+	checkErr(t, err)
+	want := &PrinterMetadata{
+		PrinterModel:    "MINI",
+		FilamentType:    []string{"PETG"},
+		NozzleDiameter:  []float64{0.4},
+		BedTemperature:  []float64{90},
+		Temperature:     []float64{240},
+		FillDensity:     15,
+		LayerHeight:     0.15,
+		MaxLayerZ:       18.05,
+		ExtruderColour:  []string{""},
+		FilamentUsedMM:  []float64{986.61},
+		FilamentUsedCM3: []float64{2.37},
+		FilamentUsedG:   []float64{3.01},
+		FilamentCost:    []float64{0.08},
+		EstimatedTime:   32*time.Minute + 6*time.Second,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("PrinterMetadata() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMetadata_PrintMetadata(t *testing.T) {
+	got, err := decodeFixture(t).Metadata().PrintMetadata()
+	checkErr(t, err)
+	want := &PrintMetadata{
+		FilamentUsedMM:          []float64{986.61},
+		FilamentUsedCM3:         []float64{2.37},
+		FilamentUsedG:           []float64{3.01},
+		FilamentCost:            []float64{0.08},
+		TotalFilamentUsedG:      3.01,
+		TotalFilamentCost:       0.08,
+		EstimatedTime:           32*time.Minute + 6*time.Second,
+		EstimatedFirstLayerTime: time.Minute + 8*time.Second,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("PrintMetadata() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMetadata_aliases(t *testing.T) {
+	m := &Metadata{
+		Print: KeyValues{
+			{Key: "total filament weight [g]", Value: "12.5"},
+			{Key: "estimated printing time", Value: "1h 2m"},
+		},
+		Slicer: KeyValues{
+			{Key: "printer_model", Value: "MK4S"},
+			{Key: "filament_colour", Value: `"#FF8000";"#000000"`},
+		},
+	}
+	pm, err := m.PrintMetadata()
+	checkErr(t, err)
+	if pm.TotalFilamentUsedG != 12.5 || pm.EstimatedTime != time.Hour+2*time.Minute {
+		t.Errorf("unexpected print metadata: %+v", pm)
+	}
+	prm, err := m.PrinterMetadata()
+	checkErr(t, err)
+	if prm.PrinterModel != "MK4S" || !cmp.Equal(prm.ExtruderColour, []string{"#FF8000", "#000000"}) {
+		t.Errorf("unexpected printer metadata: %+v", prm)
+	}
+
+	m.Print = KeyValues{{Key: "total filament cost", Value: "cheap"}}
+	if _, err := m.PrintMetadata(); err == nil {
+		t.Error("expected error for malformed value")
+	}
+}
+
+func TestPrinterMetadata_Extruders(t *testing.T) {
+	m := &Metadata{Printer: KeyValues{
+		{Key: "filament_type", Value: "PLA;PETG;PLA"},
+		{Key: "nozzle_diameter", Value: "0.4,0.4,0.6"},
+		{Key: "filament used [g]", Value: "12.3, 0, 4.5"},
+		{Key: "extruder_colour", Value: `"#FF8000";"";"#000000"`},
+	}}
+	pm, err := m.PrinterMetadata()
+	checkErr(t, err)
+	want := []ExtruderMetadata{
+		{FilamentType: "PLA", NozzleDiameter: 0.4, Colour: "#FF8000", FilamentUsedG: 12.3},
+		{FilamentType: "PETG", NozzleDiameter: 0.4},
+		{FilamentType: "PLA", NozzleDiameter: 0.6, Colour: "#000000", FilamentUsedG: 4.5},
+	}
+	if diff := cmp.Diff(want, pm.Extruders()); diff != "" {
+		t.Errorf("Extruders() mismatch (-want +got):\n%s", diff)
+	}
+
+	print, err := m.PrintMetadata()
+	checkErr(t, err)
+	if got := print.Extruders(); len(got) != 3 || got[2].FilamentUsedG != 4.5 {
+		t.Errorf("unexpected print extruders: %+v", got)
+	}
+}
@@ -3,25 +3,26 @@ package bgcodego
 import (
 	"bufio"
 	"bytes"
-	"compress/zlib"
+	"context"
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
 	"slices"
 	"strings"
 
-	heatshrink "github.com/currantlabs/goheatshrink"
+	"cirello.io/bgcodego/meatpack"
 )
 
 // FileHeaderVersion for FileHeader
 // Refer to https://github.com/prusa3d/libbgcode/blob/main/doc/specifications.md#file-header
 type FileHeaderVersion uint32
 
+// IsValid reports whether the version is one of SupportedVersions.
 func (fhv FileHeaderVersion) IsValid() bool {
-	return fhv == Version1
+	_, ok := layouts[fhv]
+	return ok
 }
 
 const (
@@ -32,8 +33,24 @@ const (
 // Refer to https://github.com/prusa3d/libbgcode/blob/main/doc/specifications.md#file-header
 type ChecksumType uint16
 
+// IsValid reports whether the checksum type is known, either from the
+// specification or through RegisterChecksum.
 func (ct ChecksumType) IsValid() bool {
-	return ct == ChecksumTypeNone || ct == ChecksumTypeCRC32
+	if ct == ChecksumTypeNone {
+		return true
+	}
+	_, ok := lookupChecksum(ct)
+	return ok
+}
+
+func (ct ChecksumType) String() string {
+	if ct == ChecksumTypeNone {
+		return "None"
+	}
+	if c, ok := lookupChecksum(ct); ok {
+		return c.Name
+	}
+	return "Unknown"
 }
 
 const (
@@ -41,6 +58,9 @@ const (
 	ChecksumTypeCRC32 ChecksumType = 1
 )
 
+// magicNumber is "GCDE" in little-endian order.
+const magicNumber = 1162101575
+
 // FileHeader implements https://github.com/prusa3d/libbgcode/blob/main/doc/specifications.md#file-header
 type FileHeader struct {
 	MagicNumber  uint32
@@ -49,17 +69,27 @@ type FileHeader struct {
 }
 
 func (fh *FileHeader) Parse(r io.Reader) error {
-	if err := binary.Read(r, binary.LittleEndian, fh); err != nil {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
 		return err
 	}
-	if fh.MagicNumber != 1162101575 {
-		return errors.New("invalid BGCode file")
+	fh.MagicNumber = binary.LittleEndian.Uint32(buf[:4])
+	if fh.MagicNumber != magicNumber {
+		return ErrNotBGCode
+	}
+	if _, err := io.ReadFull(r, buf[4:]); err != nil {
+		return noEOF(err)
 	}
-	if !fh.Version.IsValid() {
-		return fmt.Errorf("non-supported bgcode version: %v", fh.Version)
+	fh.Version = FileHeaderVersion(binary.LittleEndian.Uint32(buf[4:]))
+	l, ok := layouts[fh.Version]
+	if !ok {
+		return &UnsupportedVersionError{Version: fh.Version}
+	}
+	if err := l.parseFileHeader(fh, r); err != nil {
+		return noEOF(err)
 	}
 	if !fh.ChecksumType.IsValid() {
-		return fmt.Errorf("non-supported checksum type: %v", fh.ChecksumType)
+		return &UnsupportedChecksumError{Type: fh.ChecksumType}
 	}
 	return nil
 }
@@ -67,14 +97,35 @@ func (fh *FileHeader) Parse(r io.Reader) error {
 // BlockHeaderCompression according to https://github.com/prusa3d/libbgcode/blob/main/doc/specifications.md#block-header
 type BlockHeaderType uint16
 
+func (bht BlockHeaderType) String() string {
+	switch bht {
+	case BlockHeaderTypeFileMetadata:
+		return "FileMetadata"
+	case BlockHeaderTypeGCode:
+		return "GCode"
+	case BlockHeaderTypeSlicerMetadata:
+		return "SlicerMetadata"
+	case BlockHeaderTypePrinterMetadata:
+		return "PrinterMetadata"
+	case BlockHeaderTypePrintMetadata:
+		return "PrintMetadata"
+	case BlockHeaderTypeThumbnail:
+		return "Thumbnail"
+	}
+	if bt, ok := lookupBlockType(bht); ok {
+		return bt.name
+	}
+	return "Unknown"
+}
+
+// IsValid reports whether the block type is known, either from the
+// specification or through RegisterBlockType.
 func (bht BlockHeaderType) IsValid() bool {
-	return bht == BlockHeaderTypeFileMetadata ||
-		bht == BlockHeaderTypeGCode ||
-		bht == BlockHeaderTypeSlicerMetadata ||
-		bht == BlockHeaderTypePrinterMetadata ||
-		bht == BlockHeaderTypePrintMetadata ||
-		bht == BlockHeaderTypeThumbnail
-
+	if builtinBlock(bht) != nil {
+		return true
+	}
+	_, ok := lookupBlockType(bht)
+	return ok
 }
 
 const (
@@ -90,26 +141,23 @@ const (
 type BlockHeaderCompression uint16
 
 func (bhc BlockHeaderCompression) String() string {
-	switch bhc {
-	case BlockHeaderCompressionNone:
+	if bhc == BlockHeaderCompressionNone {
 		return "None"
-	case BlockHeaderCompressionDeflate:
-		return "Deflate"
-	case BlockHeaderCompressionHeatshrink114:
-		return "Heatshrink114"
-	case BlockHeaderCompressionHeatshrink124:
-		return "Heatshrink124"
-	default:
-		return "Unknown"
 	}
-
+	if c, ok := lookupCompression(bhc); ok {
+		return c.Name
+	}
+	return "Unknown"
 }
 
+// IsValid reports whether the compression algorithm is known, either from
+// the specification or through RegisterCompression.
 func (bhc BlockHeaderCompression) IsValid() bool {
-	return bhc == BlockHeaderCompressionNone ||
-		bhc == BlockHeaderCompressionDeflate ||
-		bhc == BlockHeaderCompressionHeatshrink114 ||
-		bhc == BlockHeaderCompressionHeatshrink124
+	if bhc == BlockHeaderCompressionNone {
+		return true
+	}
+	_, ok := lookupCompression(bhc)
+	return ok
 }
 
 const (
@@ -129,27 +177,58 @@ type BlockHeader struct {
 	extended struct {
 		CompressedSize uint32
 	}
+	fileLayout *layout  // layout of the file the header belongs to
+	offset     int64    // position of the header in the input it was read from
+	scratch    [12]byte // read buffer, so that parsing does not allocate
+}
+
+// BlockHeaderFields holds the fields of a block header, as returned by
+// BlockHeader.Fields.
+type BlockHeaderFields struct {
+	Type             BlockHeaderType        `json:"type"`
+	Compression      BlockHeaderCompression `json:"compression"`
+	UncompressedSize uint32                 `json:"uncompressed_size"`
+	CompressedSize   uint32                 `json:"compressed_size"` // Size of the data as stored, which is UncompressedSize for uncompressed blocks
+	Offset           int64                  `json:"offset"`          // Position of the block header in the input, when read by a Reader or Index
+}
+
+// Fields returns the fields of the block header.
+func (bh *BlockHeader) Fields() BlockHeaderFields {
+	return BlockHeaderFields{
+		Type:             bh.Type(),
+		Compression:      bh.Compression(),
+		UncompressedSize: bh.UncompressedSize(),
+		CompressedSize:   bh.Length(),
+		Offset:           bh.offset,
+	}
 }
 
 func (bh *BlockHeader) Type() BlockHeaderType {
 	return bh.basic.Type
 }
 
+// ParametersSize reports the size of the block parameters that sit between
+// the block header and the block data. It is zero for blocks of unknown type
+// whose parameters the layout of the file does not define.
+func (bh *BlockHeader) ParametersSize() int {
+	n, _ := bh.layout().parametersSize(bh.basic.Type)
+	return n
+}
+
+// Parse reads a block header laid out as in Version1 files, or as in the
+// file the header was obtained from.
 func (bh *BlockHeader) Parse(r io.Reader) error {
-	if err := binary.Read(r, binary.LittleEndian, &bh.basic); err != nil {
+	if err := bh.layout().parseBlockHeader(bh, r); err != nil {
 		return err
 	}
+	// The header type is validated last so that a block of unknown type
+	// is still fully read and can be skipped by the caller, provided that
+	// the size of its parameters is known.
 	if !bh.basic.Type.IsValid() {
-		return fmt.Errorf("non-supported header type: %v", bh.basic.Type)
-	}
-	if !bh.basic.Compression.IsValid() {
-		return fmt.Errorf("non-supported compression algorithm: %v", bh.basic.Compression)
-	}
-	if bh.basic.Compression == BlockHeaderCompressionNone {
-		return nil
-	}
-	if err := binary.Read(r, binary.LittleEndian, &bh.extended); err != nil {
-		return err
+		if _, ok := bh.layout().parametersSize(bh.basic.Type); !ok {
+			return &UnsupportedBlockTypeError{Type: bh.basic.Type}
+		}
+		return fmt.Errorf("%w: %d", ErrUnknownBlockType, bh.basic.Type)
 	}
 	return nil
 }
@@ -161,27 +240,87 @@ func (bh *BlockHeader) Length() uint32 {
 	return bh.extended.CompressedSize
 }
 
+// UncompressedSize reports the size of the block data once inflated.
+func (bh *BlockHeader) UncompressedSize() uint32 {
+	return bh.basic.UncompressedSize
+}
+
 func (bh *BlockHeader) Compression() BlockHeaderCompression {
 	return bh.basic.Compression
 }
 
 func (bh *BlockHeader) Inflate(body []byte) ([]byte, error) {
-	switch bh.Compression() {
-	case BlockHeaderCompressionDeflate:
-		r, err := zlib.NewReader(bytes.NewReader(body))
-		if err != nil {
-			return nil, fmt.Errorf("cannot create zlib inflator: %w", err)
-		}
-		return io.ReadAll(r)
-	case BlockHeaderCompressionHeatshrink114:
-		r := heatshrink.NewReader(bytes.NewReader(body), heatshrink.Window(11), heatshrink.Lookahead(4))
-		return io.ReadAll(r)
-	case BlockHeaderCompressionHeatshrink124:
-		r := heatshrink.NewReader(bytes.NewReader(body), heatshrink.Window(12), heatshrink.Lookahead(4))
-		return io.ReadAll(r)
-	default:
+	if bh.Compression() == BlockHeaderCompressionNone {
 		return body, nil
 	}
+	buf := &bytes.Buffer{}
+	if err := bh.inflateTo(buf, bytes.NewReader(body)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inflateTo decompresses the block data read from src into dst.
+func (bh *BlockHeader) inflateTo(dst *bytes.Buffer, src io.Reader) error {
+	r, release, err := bh.inflater(src)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if _, err := dst.ReadFrom(r); err != nil {
+		return fmt.Errorf("cannot inflate block data: %w", err)
+	}
+	return nil
+}
+
+// inflater wraps r with a streaming decompressor matching the block
+// compression. Calling release hands the decompressor back for reuse.
+func (bh *BlockHeader) inflater(r io.Reader) (_ io.Reader, release func(), _ error) {
+	bhc := bh.Compression()
+	if bhc == BlockHeaderCompressionNone {
+		return r, func() {}, nil
+	}
+	c, ok := lookupCompression(bhc)
+	if !ok {
+		return nil, nil, &UnsupportedCompressionError{Compression: bhc}
+	}
+	ir, err := getInflater(bhc, c, r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create %v inflator: %w", bhc, err)
+	}
+	return &boundedReader{r: ir, n: int64(bh.UncompressedSize())}, func() { putInflater(bhc, ir) }, nil
+}
+
+// errInflatedTooLarge is returned when block data inflates beyond the
+// uncompressed size declared by its header.
+var errInflatedTooLarge = errors.New("block data inflates beyond its declared size")
+
+// boundedReader fails once its underlying reader yields more than n bytes,
+// so that the size declared by block headers, checked against the decoding
+// limits, also bounds what compressed data inflates to.
+type boundedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (br *boundedReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if br.n <= 0 {
+		var probe [1]byte
+		n, err := br.r.Read(probe[:])
+		if n > 0 {
+			return 0, errInflatedTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > br.n {
+		p = p[:br.n]
+	}
+	n, err := br.r.Read(p)
+	br.n -= int64(n)
+	return n, err
 }
 
 type BlockEncoding uint16
@@ -208,14 +347,11 @@ func (bfm *BlockFileMetadata) Parse(r io.Reader, hdr *BlockHeader) error {
 	}
 	switch bfm.header.Encoding {
 	case BlockEncodingINI:
-		body := make([]byte, hdr.Length())
-		if _, err := io.ReadFull(r, body); err != nil {
-			return fmt.Errorf("cannot read block encoding: %w", err)
-		}
-		body, err := hdr.Inflate(body)
+		body, release, err := readBody(r, hdr)
 		if err != nil {
-			return fmt.Errorf("cannot create body inflator: %w", err)
+			return err
 		}
+		defer release()
 		v, err := iniDecode(body)
 		if err != nil {
 			return fmt.Errorf("cannot decode INI key-table: %w", err)
@@ -223,7 +359,7 @@ func (bfm *BlockFileMetadata) Parse(r io.Reader, hdr *BlockHeader) error {
 		bfm.Values = v
 		return nil
 	default:
-		return errors.New("bad encoding")
+		return fmt.Errorf("%w: %d", ErrUnsupportedEncoding, bfm.header.Encoding)
 	}
 }
 
@@ -245,14 +381,11 @@ func (bprm *BlockPrinterMetadata) Parse(r io.Reader, hdr *BlockHeader) error {
 	}
 	switch bprm.header.Encoding {
 	case BlockEncodingINI:
-		body := make([]byte, hdr.Length())
-		if _, err := io.ReadFull(r, body); err != nil {
-			return fmt.Errorf("cannot read block encoding: %w", err)
-		}
-		body, err := hdr.Inflate(body)
+		body, release, err := readBody(r, hdr)
 		if err != nil {
-			return fmt.Errorf("cannot create body inflator: %w", err)
+			return err
 		}
+		defer release()
 		v, err := iniDecode(body)
 		if err != nil {
 			return fmt.Errorf("cannot decode INI key-table: %w", err)
@@ -260,7 +393,7 @@ func (bprm *BlockPrinterMetadata) Parse(r io.Reader, hdr *BlockHeader) error {
 		bprm.Values = v
 		return nil
 	default:
-		return errors.New("bad encoding")
+		return fmt.Errorf("%w: %d", ErrUnsupportedEncoding, bprm.header.Encoding)
 	}
 }
 
@@ -296,19 +429,54 @@ type BlockThumbnail struct {
 	Body []byte
 }
 
+// Format reports the image format of the thumbnail.
+func (bt *BlockThumbnail) Format() BlockThumbnailFormat {
+	return bt.header.Format
+}
+
+// Width reports the declared width of the thumbnail in pixels.
+func (bt *BlockThumbnail) Width() int {
+	return int(bt.header.Width)
+}
+
+// Height reports the declared height of the thumbnail in pixels.
+func (bt *BlockThumbnail) Height() int {
+	return int(bt.header.Height)
+}
+
 func (bt *BlockThumbnail) Render() string {
+	return bt.render(&RenderOptions{})
+}
+
+// render writes the thumbnail as base64-encoded comments, laid out according
+// to the thumbnail options of o.
+func (bt *BlockThumbnail) render(o *RenderOptions) string {
+	if o.Klipper && bt.Format() != BlockThumbnailFormatPNG {
+		// Moonraker only extracts PNG thumbnails.
+		if png, err := bt.Convert(BlockThumbnailFormatPNG); err == nil {
+			bt = png
+		}
+	}
+	prefix, width := o.thumbnailLayout()
+	marker := "thumbnail"
+	switch bt.Format() {
+	case BlockThumbnailFormatJPG, BlockThumbnailFormatQOI:
+		if !o.GenericThumbnailMarkers && !o.Klipper {
+			marker += "_" + bt.Format().String()
+		}
+	}
 	out := &strings.Builder{}
-	fmt.Fprintln(out, ";")
+	fmt.Fprintln(out, prefix)
 	encoded := base64.StdEncoding.EncodeToString(bt.Body)
-	fmt.Fprintf(out, "; thumbnail begin %vx%v %v\n", bt.header.Width, bt.header.Height, len(encoded))
-	for len(encoded) > 78 {
-		chunk, rest := encoded[:78], encoded[78:]
-		fmt.Fprintln(out, ";", chunk)
+	fmt.Fprintf(out, "%s %s begin %vx%v %v\n", prefix, marker, bt.header.Width, bt.header.Height, len(encoded))
+	for len(encoded) > width {
+		chunk, rest := encoded[:width], encoded[width:]
+		fmt.Fprintln(out, prefix, chunk)
 		encoded = rest
 	}
-	fmt.Fprintln(out, ";", encoded)
-	fmt.Fprintf(out, "; thumbnail end\n")
-	fmt.Fprintln(out, ";")
+	fmt.Fprintln(out, prefix, encoded)
+	fmt.Fprintf(out, "%s %s end\n", prefix, marker)
+	fmt.Fprintln(out, prefix)
 
 	return out.String()
 }
@@ -340,14 +508,11 @@ func (bprm *BlockPrintMetadata) Parse(r io.Reader, hdr *BlockHeader) error {
 	}
 	switch bprm.header.Encoding {
 	case BlockEncodingINI:
-		body := make([]byte, hdr.Length())
-		if _, err := io.ReadFull(r, body); err != nil {
-			return fmt.Errorf("cannot read block encoding: %w", err)
-		}
-		body, err := hdr.Inflate(body)
+		body, release, err := readBody(r, hdr)
 		if err != nil {
-			return fmt.Errorf("cannot create body inflator: %w", err)
+			return err
 		}
+		defer release()
 		v, err := iniDecode(body)
 		if err != nil {
 			return fmt.Errorf("cannot decode INI key-table: %w", err)
@@ -355,7 +520,7 @@ func (bprm *BlockPrintMetadata) Parse(r io.Reader, hdr *BlockHeader) error {
 		bprm.Values = v
 		return nil
 	default:
-		return errors.New("bad encoding")
+		return fmt.Errorf("%w: %d", ErrUnsupportedEncoding, bprm.header.Encoding)
 	}
 }
 
@@ -382,14 +547,11 @@ func (bsm *BlockSlicerMetadata) Parse(r io.Reader, hdr *BlockHeader) error {
 	}
 	switch bsm.header.Encoding {
 	case BlockEncodingINI:
-		body := make([]byte, hdr.Length())
-		if _, err := io.ReadFull(r, body); err != nil {
-			return fmt.Errorf("cannot read block encoding: %w", err)
-		}
-		body, err := hdr.Inflate(body)
+		body, release, err := readBody(r, hdr)
 		if err != nil {
-			return fmt.Errorf("cannot create body inflator: %w", err)
+			return err
 		}
+		defer release()
 		v, err := iniDecode(body)
 		if err != nil {
 			return fmt.Errorf("cannot decode INI key-table: %w", err)
@@ -397,7 +559,7 @@ func (bsm *BlockSlicerMetadata) Parse(r io.Reader, hdr *BlockHeader) error {
 		bsm.Values = v
 		return nil
 	default:
-		return errors.New("bad encoding")
+		return fmt.Errorf("%w: %d", ErrUnsupportedEncoding, bsm.header.Encoding)
 	}
 }
 
@@ -416,6 +578,21 @@ type BlockGCode struct {
 		Encoding GCodeEncoding
 	}
 	Body string
+
+	keepPacked bool
+	filters    []gcodeFilter
+	packed     []byte
+}
+
+// Encoding reports how the G-code of the block is encoded in the file.
+func (bg *BlockGCode) Encoding() GCodeEncoding {
+	return bg.header.Encoding
+}
+
+// Packed returns the decompressed but still Meatpack-encoded body of the
+// block. It is only retained when decoding with WithKeepPacked.
+func (bg *BlockGCode) Packed() []byte {
+	return bg.packed
 }
 
 func (bg *BlockGCode) Render() string {
@@ -426,30 +603,59 @@ func (bg *BlockGCode) Parse(r io.Reader, hdr *BlockHeader) error {
 	if err := binary.Read(r, binary.LittleEndian, &bg.header); err != nil {
 		return err
 	}
-	body := make([]byte, hdr.Length())
-	if _, err := io.ReadFull(r, body); err != nil {
-		return err
-	}
-	body, err := hdr.Inflate(body)
+	body, release, err := readBody(r, hdr)
 	if err != nil {
 		return err
 	}
-	bg.Body = unbinarize(body)
+	defer release()
+	if bg.keepPacked {
+		bg.packed = bytes.Clone(body)
+	}
+	var gcode []byte
+	switch bg.header.Encoding {
+	case GCodeEncodingNone:
+		gcode = body
+	case GCodeEncodingMeatpack, GCodeEncodingMeatpackWithComments:
+		gcode = meatpack.NewDecoder().Append(make([]byte, 0, len(body)), body)
+	default:
+		return fmt.Errorf("%w: %d", ErrUnsupportedEncoding, bg.header.Encoding)
+	}
+	bg.Body = string(applyFilters(gcode, bg.filters))
 	return nil
 }
 
+// decodeGCode returns the G-code held in r, the decompressed data of a G-code
+// block with the given encoding, filtered as the decoding options require.
+func decodeGCode(r io.Reader, encoding GCodeEncoding, o *DecodeOptions) (io.Reader, error) {
+	switch encoding {
+	case GCodeEncodingNone:
+	case GCodeEncodingMeatpack, GCodeEncodingMeatpackWithComments:
+		r = meatpack.NewReader(r)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedEncoding, encoding)
+	}
+	for _, f := range o.gcodeFilters() {
+		r = &filterReader{r: r, f: f}
+	}
+	return r, nil
+}
+
 type KeyValues []KeyValue
 
 func (kv KeyValues) First(key string) string {
-	idx := slices.IndexFunc(kv, func(kv KeyValue) bool {
-		return kv.Key == key
-	})
+	idx := kv.index(key)
 	if idx == -1 {
 		return ""
 	}
 	return kv[idx].Value
 }
 
+func (kv KeyValues) index(key string) int {
+	return slices.IndexFunc(kv, func(kv KeyValue) bool {
+		return kv.Key == key
+	})
+}
+
 func (kvs KeyValues) Render() string {
 	out := &strings.Builder{}
 	for _, kv := range kvs {
@@ -467,9 +673,12 @@ type KeyValue struct {
 
 func iniDecode(body []byte) (KeyValues, error) {
 	var res KeyValues
-	scanner := bufio.NewScanner(bytes.NewReader(body))
-	for scanner.Scan() {
-		key, value, ok := strings.Cut(scanner.Text(), "=")
+	// Lines are split by hand, as bufio.Scanner gives up on lines longer
+	// than its buffer, such as long custom G-code in slicer settings.
+	for rest := string(body); rest != ""; {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		key, value, ok := strings.Cut(strings.TrimSuffix(line, "\r"), "=")
 		if !ok {
 			return nil, errors.New("malformed key-value pair")
 		}
@@ -484,83 +693,191 @@ func iniDecode(body []byte) (KeyValues, error) {
 type BlockRenderer interface{ Render() string }
 
 // Parse converts a BGCode input into regular GCode output
-func Parse(fd io.Reader) (string, error) {
+func Parse(fd io.Reader, opts ...DecodeOption) (string, error) {
 	out := &strings.Builder{}
-	fh := &FileHeader{}
-	if err := fh.Parse(fd); err != nil {
-		return "", fmt.Errorf("cannot parse file header: %w", err)
+	if err := parseBuffered(out, fd, newDecodeOptions(opts)); err != nil {
+		return "", err
 	}
-	blocks := make(map[BlockHeaderType][]BlockRenderer)
+	return out.String(), nil
+}
+
+// ParseBytes converts BGCode held in memory into regular GCode output.
+func ParseBytes(data []byte, opts ...DecodeOption) (string, error) {
+	return Parse(bytes.NewReader(data), opts...)
+}
+
+// ParseFile converts the BGCode file at path into regular GCode output.
+func ParseFile(path string, opts ...DecodeOption) (string, error) {
+	fd, opts, err := openFile(path, opts)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	return Parse(bufio.NewReaderSize(fd, fileBufferSize), opts...)
+}
+
+// ParseContext is like Parse, but stops with the context error as soon as
+// ctx is done, be it between blocks or while reading a block.
+func ParseContext(ctx context.Context, fd io.Reader, opts ...DecodeOption) (string, error) {
+	o := newDecodeOptions(opts)
+	o.ctx = ctx
+	out := &strings.Builder{}
+	if err := parseBuffered(out, fd, o); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// ParseTo converts a BGCode input into regular GCode output written to w.
+// Unlike Parse, the G-code is streamed block by block, so memory usage does
+// not grow with the size of the print. Blocks due before the G-code, such as
+// printer metadata or thumbnails, may still follow the G-code blocks: when fd
+// is an io.ReadSeeker, its block headers are scanned first and such files
+// are decoded as Parse does; otherwise they fail with ErrBlockOrder, as their
+// section is already written by then.
+func ParseTo(w io.Writer, fd io.Reader, opts ...DecodeOption) error {
+	return parseTo(w, fd, newDecodeOptions(opts))
+}
+
+// AppendGCode converts a BGCode input into regular GCode output, appending it
+// to dst and returning the extended buffer. As with the built-in append, dst
+// is grown only when its capacity is insufficient, so callers decoding many
+// files may reuse the returned slice (truncated to dst[:0]) across calls. On
+// error, dst is returned unmodified.
+func AppendGCode(dst []byte, fd io.Reader, opts ...DecodeOption) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	if err := parseBuffered(buf, fd, newDecodeOptions(opts)); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseBuffered decodes a BGCode input into a File, which takes its blocks in
+// any order, and renders it into w.
+func parseBuffered(w io.Writer, fd io.Reader, o *DecodeOptions) error {
+	f, err := decode(fd, o)
+	if err != nil {
+		return err
+	}
+	if lim := o.maxTotalSize(); lim > 0 {
+		w = &limitWriter{w: w, max: lim}
+	}
+	return f.render(w, &o.Render)
+}
+
+// lateBlock reports whether a seekable input holds a block due before the
+// G-code after its G-code blocks, reading the block headers alone. The input
+// is rewound afterwards. Errors are left for the decoding that follows.
+func lateBlock(rs io.ReadSeeker, o *DecodeOptions) (bool, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		// Pipes and the like are streamed regardless.
+		return false, nil
+	}
+	so := *o
+	so.Progress = nil
+	so.seekSkipped = true
+	before, _ := o.Render.splitSections()
+	late := false
+	if r, err := newReader(rs, &so); err == nil {
+		inGCode := false
+		for !late {
+			b, err := r.NextBlock()
+			if err != nil {
+				break
+			}
+			switch bht := b.Header.Type(); {
+			case !so.wants(bht) || !so.Render.renders(bht):
+			case bht == BlockHeaderTypeGCode:
+				inGCode = true
+			case inGCode:
+				late = slices.Contains(before, sectionOf(bht))
+			}
+		}
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return false, fmt.Errorf("cannot rewind input: %w", err)
+	}
+	return late, nil
+}
+
+func parseTo(w io.Writer, fd io.Reader, o *DecodeOptions) error {
+	if rs, ok := fd.(io.ReadSeeker); ok && !o.DetectContainers {
+		late, err := lateBlock(rs, o)
+		if err != nil {
+			return err
+		} else if late {
+			return parseBuffered(w, fd, o)
+		}
+	}
+	if lim := o.maxTotalSize(); lim > 0 {
+		w = &limitWriter{w: w, max: lim}
+	}
+	out := &errWriter{w: w}
+	r, err := newReader(fd, o)
+	if err != nil {
+		return err
+	}
+	// Metadata and thumbnails are small and kept until their section is
+	// due, whereas G-code blocks are written out as soon as decoded.
+	f := &File{Header: r.Header}
+	gw, done := o.Render.gcodeWriter(out)
+	gj := &gcodeJoiner{out: gw}
+	before, after := o.Render.splitSections()
+	inGCode := false
 	for {
-		buf := &bytes.Buffer{}
-		r := io.TeeReader(fd, buf)
-		hdr := &BlockHeader{}
-		err := hdr.Parse(r)
+		b, err := r.NextBlock()
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
-			return "", fmt.Errorf("cannot parse block header: %w", err)
-		}
-
-		var block interface {
-			Parse(r io.Reader, hdr *BlockHeader) error
+			return err
 		}
-		switch hdr.Type() {
-		case BlockHeaderTypeFileMetadata:
-			block = &BlockFileMetadata{}
-		case BlockHeaderTypeGCode:
-			block = &BlockGCode{}
-		case BlockHeaderTypeSlicerMetadata:
-			block = &BlockSlicerMetadata{}
-		case BlockHeaderTypePrinterMetadata:
-			block = &BlockPrinterMetadata{}
-		case BlockHeaderTypePrintMetadata:
-			block = &BlockPrintMetadata{}
-		case BlockHeaderTypeThumbnail:
-			block = &BlockThumbnail{}
+		if !r.o.wants(b.Header.Type()) || !o.Render.renders(b.Header.Type()) {
+			if err := b.Skip(); err != nil {
+				return err
+			}
+			continue
 		}
-		if err := block.Parse(r, hdr); err != nil {
-			return "", fmt.Errorf("cannot parse %q block: %w", hdr.Type(), err)
+		if inGCode && slices.Contains(before, sectionOf(b.Header.Type())) {
+			// Its section was written out when the G-code started.
+			return b.blockErr(ErrBlockOrder)
 		}
-		if fh.ChecksumType == ChecksumTypeCRC32 {
-			var crc32footer uint32
-			err := binary.Read(fd, binary.LittleEndian, &crc32footer)
+		if b.Header.Type() != BlockHeaderTypeGCode {
+			block, err := b.Decode()
 			if err != nil {
-				return "", fmt.Errorf("cannot read CRC32 footer: %w", err)
-			}
-			if crc32footer != crc32.ChecksumIEEE(buf.Bytes()) {
-				return "", errors.New("bad checksum")
+				return err
 			}
+			f.add(block)
+			continue
 		}
-		blocks[hdr.Type()] = append(blocks[hdr.Type()], block.(BlockRenderer))
-	}
-
-	if b, ok := blocks[BlockHeaderTypeFileMetadata]; ok {
-		fmt.Fprint(out, b[0].Render())
-	}
-	if b, ok := blocks[BlockHeaderTypePrinterMetadata]; ok {
-		fmt.Fprintln(out)
-		fmt.Fprint(out, b[0].Render())
-	}
-	if thumbnails, ok := blocks[BlockHeaderTypeThumbnail]; ok {
-		for _, thumbnail := range thumbnails {
+		if !inGCode {
+			for _, s := range before {
+				f.renderSection(out, s, &o.Render)
+			}
 			fmt.Fprintln(out)
-			fmt.Fprint(out, thumbnail.Render())
+			inGCode = true
 		}
-	}
-	if gcodes, ok := blocks[BlockHeaderTypeGCode]; ok {
-		fmt.Fprintln(out)
-		for _, gcode := range gcodes {
-			fmt.Fprint(out, gcode.Render())
+		if _, ok := o.Render.Renderers[BlockHeaderTypeGCode]; ok {
+			block, err := b.Decode()
+			if err != nil {
+				return err
+			}
+			o.Render.renderGCode(gj, out, block.(*BlockGCode))
+			continue
+		}
+		gj.begin()
+		if err := b.writeGCode(gj); err != nil {
+			return err
 		}
 	}
-	if b, ok := blocks[BlockHeaderTypePrintMetadata]; ok {
-		fmt.Fprintln(out)
-		fmt.Fprint(out, b[0].Render())
+	done()
+	if !inGCode {
+		for _, s := range before {
+			f.renderSection(out, s, &o.Render)
+		}
 	}
-	if b, ok := blocks[BlockHeaderTypeSlicerMetadata]; ok {
-		fmt.Fprintln(out)
-		fmt.Fprint(out, b[0].Render())
+	for _, s := range after {
+		f.renderSection(out, s, &o.Render)
 	}
-	return out.String(), nil
+	return out.err
 }
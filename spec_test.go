@@ -1,7 +1,12 @@
 package bgcodego
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -22,6 +27,259 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseBytes(t *testing.T) {
+	expected, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	data, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	got, err := ParseBytes(data)
+	checkErr(t, err)
+	if diff := cmp.Diff(string(expected), got); diff != "" {
+		t.Errorf("ParseBytes() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	expected, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	var last ProgressEvent
+	got, err := ParseFile("_testdata/mini_cube_b.bgcode", WithProgress(func(ev ProgressEvent) { last = ev }))
+	checkErr(t, err)
+	if diff := cmp.Diff(string(expected), got); diff != "" {
+		t.Errorf("ParseFile() mismatch (-want +got):\n%s", diff)
+	}
+	if last.TotalBytes != last.BytesRead || last.TotalBytes == 0 {
+		t.Errorf("last progress event = %+v, want all bytes read", last)
+	}
+	if _, err := ParseFile("_testdata/missing.bgcode"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ParseFile() error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestParseTo(t *testing.T) {
+	expected, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	out := &bytes.Buffer{}
+	checkErr(t, ParseTo(out, fd))
+	if diff := cmp.Diff(string(expected), out.String()); diff != "" {
+		t.Errorf("ParseTo() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseTo_writeError(t *testing.T) {
+	fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	errWrite := errors.New("write failure")
+	if err := ParseTo(failingWriter{errWrite}, fd); !errors.Is(err, errWrite) {
+		t.Errorf("expected write error, got: %v", err)
+	}
+}
+
+// lateBlockFixture encodes a file whose printer metadata follows the G-code.
+func lateBlockFixture(t *testing.T) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf)
+	checkErr(t, err)
+	checkErr(t, w.WriteFileMetadata(KeyValues{{Key: "Producer", Value: "x"}}))
+	checkErr(t, w.WriteGCode("G1 X1\n"))
+	checkErr(t, w.WritePrinterMetadata(KeyValues{{Key: "printer_model", Value: "MINI"}}))
+	return buf.Bytes()
+}
+
+func TestParseTo_lateBlock(t *testing.T) {
+	buf := bytes.NewBuffer(lateBlockFixture(t))
+
+	f, err := Decode(bytes.NewReader(buf.Bytes()))
+	checkErr(t, err)
+	want := f.Render()
+	if !strings.Contains(want, "; printer_model = MINI\n") {
+		t.Errorf("unexpected rendering:\n%s", want)
+	}
+	got, err := Parse(bytes.NewReader(buf.Bytes()))
+	checkErr(t, err)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Parse() mismatch (-want +got):\n%s", diff)
+	}
+	seekable := &strings.Builder{}
+	checkErr(t, ParseTo(seekable, bytes.NewReader(buf.Bytes())))
+	if diff := cmp.Diff(want, seekable.String()); diff != "" {
+		t.Errorf("ParseTo() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Without seeking, the printer metadata comes too late to be streamed.
+	var be *BlockError
+	err = ParseTo(io.Discard, struct{ io.Reader }{bytes.NewReader(buf.Bytes())})
+	if !errors.Is(err, ErrBlockOrder) || !errors.As(err, &be) || be.Type != BlockHeaderTypePrinterMetadata {
+		t.Errorf("expected ErrBlockOrder for the printer metadata, got: %v", err)
+	}
+
+	// Blocks rendered after the G-code may follow it.
+	sections := []Section{SectionFileMetadata, SectionGCode, SectionPrinterMetadata}
+	streamed := &strings.Builder{}
+	checkErr(t, ParseTo(streamed, struct{ io.Reader }{bytes.NewReader(buf.Bytes())}, WithRenderOptions(WithSections(sections...))))
+	rendered := &strings.Builder{}
+	checkErr(t, f.RenderTo(rendered, WithSections(sections...)))
+	if diff := cmp.Diff(rendered.String(), streamed.String()); diff != "" {
+		t.Errorf("ParseTo() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+type failingWriter struct{ err error }
+
+func (fw failingWriter) Write([]byte) (int, error) { return 0, fw.err }
+
+func TestParse_unterminatedGCodeBlock(t *testing.T) {
+	fd, err := os.Open("_testdata/unterminated_gcode_block.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	got, err := Parse(fd)
+	checkErr(t, err)
+	const expected = "; generated by PrusaSlicer 2.6.0\n\n\nG28\nG1 X10\nG1 Y10\n"
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("Parse() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParse_maxTotalSize(t *testing.T) {
+	expected, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+
+	_, err = Parse(bytes.NewReader(bgcode), WithMaxTotalSize(100_000))
+	var blockErr *BlockError
+	if !errors.As(err, &blockErr) || !errors.Is(err, ErrOutputTooLarge) {
+		t.Fatalf("expected ErrOutputTooLarge block error, got: %v", err)
+	}
+	if blockErr.Index != 7 {
+		t.Errorf("expected the limit to trip on the second G-code block, got block %d", blockErr.Index)
+	}
+
+	if _, err := Parse(bytes.NewReader(bgcode), WithMaxTotalSize(int64(len(expected))-1)); !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("expected ErrOutputTooLarge from the metadata epilogue, got: %v", err)
+	}
+	got, err := Parse(bytes.NewReader(bgcode), WithMaxTotalSize(int64(len(expected))))
+	checkErr(t, err)
+	if got != string(expected) {
+		t.Error("unexpected output at the exact limit")
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	expected, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+
+	got, err := ParseContext(context.Background(), bytes.NewReader(bgcode))
+	checkErr(t, err)
+	if got != string(expected) {
+		t.Error("unexpected output")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseContext(ctx, bytes.NewReader(bgcode)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	blocks := 0
+	_, err = ParseContext(ctx, bytes.NewReader(bgcode), WithProgress(func(ev ProgressEvent) {
+		blocks = ev.Blocks
+		if ev.Blocks == 3 {
+			cancel()
+		}
+	}))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+	if blocks != 3 {
+		t.Errorf("expected decoding to stop after 3 blocks, got %d", blocks)
+	}
+}
+
+func TestAppendGCode(t *testing.T) {
+	expected, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	t.Cleanup(func() { fd.Close() })
+	const prefix = "; prefix\n"
+	got, err := AppendGCode([]byte(prefix), fd)
+	checkErr(t, err)
+	if diff := cmp.Diff(prefix+string(expected), string(got)); diff != "" {
+		t.Errorf("AppendGCode() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(bytes.NewReader(bgcode)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBlockHeader_Parse(b *testing.B) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	header := bgcode[5743 : 5743+12] // compressed G-code block
+	r := bytes.NewReader(header)
+	bh := &BlockHeader{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(header)
+		if err := bh.Parse(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFileHeader_Parse(b *testing.B) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(bgcode[:10])
+	fh := &FileHeader{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(bgcode[:10])
+		if err := fh.Parse(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendGCode(b *testing.B) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		buf, err = AppendGCode(buf[:0], bytes.NewReader(bgcode))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func checkErr(t *testing.T, err error) {
 	t.Helper()
 	if err != nil {
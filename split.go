@@ -0,0 +1,94 @@
+package bgcodego
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// metadataSections names the INI sections written by ParseSplit.
+var metadataSections = map[BlockHeaderType]string{
+	BlockHeaderTypeFileMetadata:    "file",
+	BlockHeaderTypePrinterMetadata: "printer",
+	BlockHeaderTypePrintMetadata:   "print",
+	BlockHeaderTypeSlicerMetadata:  "slicer",
+}
+
+// ParseSplit converts a BGCode input in a single pass, writing the G-code
+// blocks alone to gcode, and the metadata blocks to metadata as an INI
+// summary, with the sections [file], [printer], [print] and [slicer], in file
+// order. Thumbnails and blocks of custom types are left out. The G-code is
+// streamed block by block, as ParseTo does, and adapted to Klipper with the
+// Klipper render option.
+func ParseSplit(gcode, metadata io.Writer, fd io.Reader, opts ...DecodeOption) error {
+	return parseSplit(gcode, metadata, fd, newDecodeOptions(opts))
+}
+
+func parseSplit(gcode, metadata io.Writer, fd io.Reader, o *DecodeOptions) error {
+	if lim := o.maxTotalSize(); lim > 0 {
+		gcode = &limitWriter{w: gcode, max: lim}
+	}
+	gout, mout := &errWriter{w: gcode}, &errWriter{w: metadata}
+	r, err := newReader(fd, o)
+	if err != nil {
+		return err
+	}
+	gw, done := o.Render.gcodeWriter(gout)
+	gj := &gcodeJoiner{out: gw}
+	sections := 0
+	for {
+		b, err := r.NextBlock()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		bht := b.Header.Type()
+		section, isMetadata := metadataSections[bht]
+		if !r.o.wants(bht) || (!isMetadata && bht != BlockHeaderTypeGCode) {
+			if err := b.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		if bht == BlockHeaderTypeGCode {
+			gj.begin()
+			if err := b.writeGCode(gj); err != nil {
+				return err
+			}
+			continue
+		}
+		block, err := b.Decode()
+		if err != nil {
+			return err
+		}
+		if sections > 0 {
+			fmt.Fprintln(mout)
+		}
+		sections++
+		fmt.Fprintf(mout, "[%s]\n", section)
+		for _, kv := range metadataValues(block) {
+			fmt.Fprintf(mout, "%s = %s\n", kv.Key, kv.Value)
+		}
+	}
+	done()
+	if gout.err != nil {
+		return gout.err
+	}
+	return mout.err
+}
+
+// metadataValues returns the values of a metadata block.
+func metadataValues(block BlockRenderer) KeyValues {
+	switch b := block.(type) {
+	case *BlockFileMetadata:
+		return b.Values
+	case *BlockPrinterMetadata:
+		return b.Values
+	case *BlockPrintMetadata:
+		return b.Values
+	case *BlockSlicerMetadata:
+		return b.Values
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package bgcodego
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseSplit(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f := decodeFixture(t)
+	gcode, metadata := &strings.Builder{}, &strings.Builder{}
+	checkErr(t, ParseSplit(gcode, metadata, bytes.NewReader(bgcode)))
+
+	want := &strings.Builder{}
+	checkErr(t, f.RenderTo(want, WithSections(SectionGCode)))
+	if "\n"+gcode.String() != want.String() {
+		t.Error("unexpected G-code output")
+	}
+	if strings.Contains(gcode.String(), "; prusaslicer_config") || strings.Contains(gcode.String(), "thumbnail") {
+		t.Error("metadata found in the G-code output")
+	}
+
+	got := metadata.String()
+	if !strings.HasPrefix(got, "[file]\nProducer = ") {
+		t.Errorf("unexpected metadata output: %q", got[:min(len(got), 40)])
+	}
+	for _, section := range []string{"\n\n[printer]\nprinter_model = MINI\n", "\n\n[print]\n", "\n\n[slicer]\n"} {
+		if !strings.Contains(got, section) {
+			t.Errorf("missing %q in metadata output", section)
+		}
+	}
+	config, err := ParseSlicerConfig(strings.NewReader(got[strings.Index(got, "[slicer]\n")+len("[slicer]\n"):]))
+	checkErr(t, err)
+	if config.Values.First("printer_model") != f.SlicerMetadata.Values.First("printer_model") || len(config.Values) != len(f.SlicerMetadata.Values) {
+		t.Error("slicer section does not round trip")
+	}
+
+	gcode.Reset()
+	metadata.Reset()
+	checkErr(t, ParseSplit(gcode, metadata, bytes.NewReader(bgcode), WithRenderOptions(WithKlipper())))
+	if !strings.Contains(gcode.String(), "\n; M862.3") || strings.Contains(gcode.String(), "\nM862") {
+		t.Error("G-code not adapted to Klipper")
+	}
+
+	gcode.Reset()
+	metadata.Reset()
+	checkErr(t, NewDecoder(WithOnlyTypes(BlockHeaderTypeGCode)).ParseSplit(gcode, metadata, bytes.NewReader(bgcode)))
+	if metadata.Len() != 0 || "\n"+gcode.String() != want.String() {
+		t.Error("block filter not honored")
+	}
+}
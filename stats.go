@@ -0,0 +1,40 @@
+package bgcodego
+
+// BlockTotals adds up the sizes of blocks. Sizes are those of the block data,
+// leaving headers, parameters and checksums out.
+type BlockTotals struct {
+	Blocks           int   `json:"blocks"`
+	CompressedSize   int64 `json:"compressed_size"`   // Size of the data as stored
+	UncompressedSize int64 `json:"uncompressed_size"` // Size of the data once inflated
+}
+
+// CompressionRatio reports the uncompressed size over the compressed size.
+func (bt BlockTotals) CompressionRatio() float64 {
+	if bt.CompressedSize == 0 {
+		return 1
+	}
+	return float64(bt.UncompressedSize) / float64(bt.CompressedSize)
+}
+
+func (bt *BlockTotals) add(hdr *BlockHeader) {
+	bt.Blocks++
+	bt.CompressedSize += int64(hdr.Length())
+	bt.UncompressedSize += int64(hdr.UncompressedSize())
+}
+
+// BlockStats totals the blocks of a file, overall and by type. Blocks
+// skipped while decoding, such as those of unknown type, are counted too.
+type BlockStats struct {
+	BlockTotals
+	ByType map[BlockHeaderType]BlockTotals `json:"by_type"`
+}
+
+func (bs *BlockStats) add(hdr *BlockHeader) {
+	bs.BlockTotals.add(hdr)
+	if bs.ByType == nil {
+		bs.ByType = make(map[BlockHeaderType]BlockTotals)
+	}
+	bt := bs.ByType[hdr.Type()]
+	bt.add(hdr)
+	bs.ByType[hdr.Type()] = bt
+}
@@ -0,0 +1,46 @@
+package bgcodego
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStats(t *testing.T) {
+	f := decodeFixture(t)
+	want := BlockTotals{Blocks: 16, CompressedSize: 148972, UncompressedSize: 369669}
+	if diff := cmp.Diff(want, f.Stats.BlockTotals); diff != "" {
+		t.Errorf("unexpected totals (-want +got):\n%s", diff)
+	}
+	gcode := BlockTotals{Blocks: 10, CompressedSize: 139672, UncompressedSize: 354007}
+	if diff := cmp.Diff(gcode, f.Stats.ByType[BlockHeaderTypeGCode]); diff != "" {
+		t.Errorf("unexpected G-code totals (-want +got):\n%s", diff)
+	}
+	if got := f.Stats.ByType[BlockHeaderTypeThumbnail].CompressionRatio(); got != 1 {
+		t.Errorf("unexpected thumbnail compression ratio: %v", got)
+	}
+	if got := (BlockTotals{}).CompressionRatio(); got != 1 {
+		t.Errorf("unexpected empty compression ratio: %v", got)
+	}
+
+	fd, err := os.Open("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	defer fd.Close()
+	report, err := Inspect(fd)
+	checkErr(t, err)
+	if diff := cmp.Diff(f.Stats, report.Stats); diff != "" {
+		t.Errorf("unexpected report stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestStats_unknownBlock(t *testing.T) {
+	fd, err := os.Open("_testdata/future_block.bgcode")
+	checkErr(t, err)
+	defer fd.Close()
+	f, err := Decode(fd, WithSkipUnknownBlocks())
+	checkErr(t, err)
+	if got := f.Stats.ByType[BlockHeaderType(99)].Blocks; got != 1 || f.Stats.Blocks != 3 {
+		t.Errorf("unexpected stats: %+v", f.Stats)
+	}
+}
@@ -0,0 +1,197 @@
+package bgcodego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ErrNoChecksum is returned when verification is requested for a file that
+// does not carry checksums.
+var ErrNoChecksum = errors.New("file has no checksums to verify")
+
+// NewVerifyingReader returns a reader that yields the decoded G-code of a
+// BGCode input while verifying the checksum of every block as it streams.
+// Blocks are never buffered as a whole: the checksum is computed
+// incrementally and checked once the block is fully read, so the first
+// mismatch surfaces as a *BlockError wrapping ErrBadChecksum right after
+// the contents of the offending block. Inputs without checksums are
+// rejected with ErrNoChecksum. Blocks of unknown type are verified and
+// skipped when decoding with WithSkipUnknownBlocks.
+func NewVerifyingReader(r io.Reader, opts ...DecodeOption) (io.Reader, error) {
+	vr := &verifyingReader{
+		o:  newDecodeOptions(opts),
+		cr: &countingReader{r: r},
+	}
+	if vr.o.Progress != nil {
+		vr.total = vr.o.totalSize(r)
+	}
+	if err := vr.fh.Parse(vr.cr); err != nil {
+		return nil, fmt.Errorf("cannot parse file header: %w", err)
+	}
+	vr.sum = vr.fh.ChecksumType.newHash()
+	if vr.sum == nil {
+		return nil, ErrNoChecksum
+	}
+	return vr, nil
+}
+
+type verifyingReader struct {
+	o     *DecodeOptions
+	cr    *countingReader
+	fh    FileHeader
+	sum   hash.Hash
+	total int64 // size of the input, for progress reporting
+	err   error
+
+	idx     int
+	offset  int64
+	hdr     *BlockHeader
+	data    io.Reader // remaining block data, as read from the input
+	gcode   io.Reader // decoded G-code of the current block
+	release func()    // hands the decompressor of the current block back
+	last    byte      // last byte of decoded G-code yielded so far
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	if vr.err != nil {
+		return 0, vr.err
+	}
+	for {
+		if vr.gcode == nil {
+			if err := vr.nextGCodeBlock(); err != nil {
+				vr.err = err
+				return 0, err
+			}
+		}
+		n, err := vr.gcode.Read(p)
+		if errors.Is(err, io.EOF) {
+			vr.gcode = nil
+			if err := vr.endBlock(); err != nil {
+				vr.err = err
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		} else if err != nil {
+			vr.err = vr.blockErr(err)
+			return n, vr.err
+		}
+		return n, nil
+	}
+}
+
+// nextGCodeBlock advances to the next G-code block, verifying the blocks of
+// other types on the way.
+func (vr *verifyingReader) nextGCodeBlock() error {
+	for ; ; vr.idx++ {
+		vr.offset = vr.cr.n
+		vr.sum.Reset()
+		r := io.TeeReader(vr.cr, vr.sum)
+		vr.hdr = &BlockHeader{fileLayout: vr.fh.layout()}
+		err := vr.hdr.Parse(r)
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		unknown := skippable(err)
+		if err != nil && !(unknown && vr.o.SkipUnknownBlocks) {
+			return vr.blockErr(fmt.Errorf("cannot parse block header: %w", err))
+		}
+		if err := vr.o.checkLimits(vr.hdr, vr.idx); err != nil {
+			return vr.blockErr(err)
+		}
+		if vr.hdr.Type() != BlockHeaderTypeGCode {
+			if err := skipBlock(r, vr.hdr); err != nil {
+				return vr.blockErr(fmt.Errorf("cannot skip %v block: %w", vr.hdr.Type(), err))
+			}
+			if err := vr.verify(); err != nil {
+				return err
+			}
+			continue
+		}
+		var encoding GCodeEncoding
+		if err := binary.Read(r, binary.LittleEndian, &encoding); err != nil {
+			return vr.blockErr(fmt.Errorf("cannot read block parameters: %w", err))
+		}
+		vr.data = io.LimitReader(r, int64(vr.hdr.Length()))
+		inflater, release, err := vr.hdr.inflater(vr.data)
+		if err != nil {
+			return vr.blockErr(err)
+		}
+		vr.release = release
+		gcode, err := decodeGCode(inflater, encoding, vr.o)
+		if err != nil {
+			return vr.blockErr(err)
+		}
+		if vr.last != 0 && vr.last != '\n' {
+			// Keep the unterminated last line of the previous G-code
+			// block from merging with the first line of this one.
+			gcode = io.MultiReader(strings.NewReader("\n"), gcode)
+		}
+		vr.gcode = &lastByteReader{r: gcode, last: &vr.last}
+		return nil
+	}
+}
+
+// endBlock consumes whatever the decompressor left unread and verifies the
+// checksum of the current block.
+func (vr *verifyingReader) endBlock() error {
+	if _, err := io.Copy(io.Discard, vr.data); err != nil {
+		return vr.blockErr(err)
+	}
+	vr.release()
+	if err := vr.verify(); err != nil {
+		return err
+	}
+	vr.idx++
+	return nil
+}
+
+func (vr *verifyingReader) verify() error {
+	end := vr.cr.n
+	footer := make([]byte, vr.sum.Size())
+	if _, err := io.ReadFull(vr.cr, footer); err != nil {
+		return vr.blockErr(fmt.Errorf("cannot read checksum footer: %w", err))
+	}
+	if sum := vr.sum.Sum(nil); !bytes.Equal(footer, sum) {
+		return vr.blockErr(&ChecksumError{Type: vr.fh.ChecksumType, Stored: footer, Computed: sum, Start: vr.offset, End: end})
+	}
+	if vr.o.Progress != nil {
+		vr.o.Progress(ProgressEvent{
+			BytesRead:  vr.cr.n,
+			TotalBytes: vr.total,
+			Blocks:     vr.idx + 1,
+			BlockType:  vr.hdr.Type(),
+		})
+	}
+	return nil
+}
+
+func (vr *verifyingReader) blockErr(err error) error {
+	return &BlockError{
+		Type:   vr.hdr.Type(),
+		Index:  vr.idx,
+		Offset: vr.offset,
+		At:     vr.cr.n,
+		Err:    err,
+	}
+}
+
+type lastByteReader struct {
+	r    io.Reader
+	last *byte
+}
+
+func (lr *lastByteReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		*lr.last = p[n-1]
+	}
+	return n, err
+}
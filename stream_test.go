@@ -0,0 +1,129 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewVerifyingReader(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	f, err := Decode(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	var expected strings.Builder
+	for _, gcode := range f.GCode {
+		expected.WriteString(gcode.Body)
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		r, err := NewVerifyingReader(bytes.NewReader(bgcode))
+		checkErr(t, err)
+		got, err := io.ReadAll(r)
+		checkErr(t, err)
+		if diff := cmp.Diff(expected.String(), string(got)); diff != "" {
+			t.Errorf("NewVerifyingReader() mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("progress", func(t *testing.T) {
+		var events []ProgressEvent
+		r, err := NewVerifyingReader(bytes.NewReader(bgcode), WithProgress(func(ev ProgressEvent) {
+			events = append(events, ev)
+		}))
+		checkErr(t, err)
+		_, err = io.Copy(io.Discard, r)
+		checkErr(t, err)
+		if len(events) != 16 {
+			t.Fatalf("got %d progress events, want 16", len(events))
+		}
+		want := ProgressEvent{
+			BytesRead:  int64(len(bgcode)),
+			TotalBytes: int64(len(bgcode)),
+			Blocks:     16,
+			BlockType:  BlockHeaderTypeGCode,
+		}
+		if diff := cmp.Diff(want, events[len(events)-1]); diff != "" {
+			t.Errorf("last progress event mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("corrupted gcode block", func(t *testing.T) {
+		corrupted := bytes.Clone(bgcode)
+		corrupted[30000] ^= 0xFF // inside the second G-code block
+		r, err := NewVerifyingReader(bytes.NewReader(corrupted))
+		checkErr(t, err)
+		got, err := io.ReadAll(r)
+		var blockErr *BlockError
+		if !errors.As(err, &blockErr) {
+			t.Fatalf("expected *BlockError, got: %v", err)
+		}
+		if !errors.Is(err, ErrBadChecksum) || blockErr.Index != 7 || blockErr.Offset != 23961 {
+			t.Errorf("unexpected error: %v", err)
+		}
+		var checksumErr *ChecksumError
+		if !errors.As(err, &checksumErr) || checksumErr.Start != 23961 || checksumErr.End != blockErr.At-4 {
+			t.Errorf("unexpected checksum error: %v", err)
+		}
+		if !strings.HasPrefix(expected.String(), string(got[:len(f.GCode[0].Body)])) {
+			t.Error("expected the first G-code block to be streamed before the failure")
+		}
+	})
+	t.Run("corrupted metadata block", func(t *testing.T) {
+		corrupted := bytes.Clone(bgcode)
+		corrupted[5800] ^= 0xFF // inside the print metadata block
+		r, err := NewVerifyingReader(bytes.NewReader(corrupted))
+		checkErr(t, err)
+		got, err := io.ReadAll(r)
+		if !errors.Is(err, ErrBadChecksum) {
+			t.Errorf("expected ErrBadChecksum, got: %v", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("expected no output, got %d bytes", len(got))
+		}
+	})
+	t.Run("unterminated gcode block", func(t *testing.T) {
+		fd, err := os.Open("_testdata/unterminated_gcode_block.bgcode")
+		checkErr(t, err)
+		t.Cleanup(func() { fd.Close() })
+		r, err := NewVerifyingReader(fd)
+		checkErr(t, err)
+		got, err := io.ReadAll(r)
+		checkErr(t, err)
+		if diff := cmp.Diff("G28\nG1 X10\nG1 Y10\n", string(got)); diff != "" {
+			t.Errorf("NewVerifyingReader() mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("unknown block", func(t *testing.T) {
+		future, err := os.ReadFile("_testdata/future_block.bgcode")
+		checkErr(t, err)
+		r, err := NewVerifyingReader(bytes.NewReader(future))
+		checkErr(t, err)
+		if _, err := io.ReadAll(r); !errors.Is(err, ErrUnknownBlockType) {
+			t.Errorf("expected ErrUnknownBlockType, got: %v", err)
+		}
+		r, err = NewVerifyingReader(bytes.NewReader(future), WithSkipUnknownBlocks())
+		checkErr(t, err)
+		got, err := io.ReadAll(r)
+		checkErr(t, err)
+		f, err := Decode(bytes.NewReader(future), WithSkipUnknownBlocks())
+		checkErr(t, err)
+		var want strings.Builder
+		for _, gcode := range f.GCode {
+			want.WriteString(gcode.Body)
+		}
+		if diff := cmp.Diff(want.String(), string(got)); diff != "" {
+			t.Errorf("NewVerifyingReader() mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("no checksum", func(t *testing.T) {
+		corrupted := bytes.Clone(bgcode)
+		corrupted[8] = byte(ChecksumTypeNone)
+		if _, err := NewVerifyingReader(bytes.NewReader(corrupted)); !errors.Is(err, ErrNoChecksum) {
+			t.Errorf("expected ErrNoChecksum, got: %v", err)
+		}
+	})
+}
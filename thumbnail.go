@@ -0,0 +1,228 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"slices"
+)
+
+// ErrUnsupportedThumbnailFormat is returned when asked to decode a thumbnail
+// whose image format this package cannot handle.
+var ErrUnsupportedThumbnailFormat = errors.New("non-supported thumbnail format")
+
+// Thumbnails reads only the thumbnail blocks of a BGCode input. Other blocks
+// are skipped without being decompressed and, when r is an io.Seeker,
+// without being read nor verified.
+func Thumbnails(r io.Reader, opts ...DecodeOption) ([]*BlockThumbnail, error) {
+	o := newDecodeOptions(opts)
+	o.OnlyTypes = []BlockHeaderType{BlockHeaderTypeThumbnail}
+	o.seekSkipped = true
+	f, err := decode(r, o)
+	if err != nil {
+		return nil, err
+	}
+	return f.Thumbnails, nil
+}
+
+// Image decodes the thumbnail according to its declared format.
+func (bt *BlockThumbnail) Image() (image.Image, error) {
+	var (
+		img image.Image
+		err error
+	)
+	switch bt.Format() {
+	case BlockThumbnailFormatPNG:
+		img, err = png.Decode(bytes.NewReader(bt.Body))
+	case BlockThumbnailFormatJPG:
+		img, err = jpeg.Decode(bytes.NewReader(bt.Body))
+	case BlockThumbnailFormatQOI:
+		img, err = decodeQOI(bt.Body)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedThumbnailFormat, bt.Format())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %v thumbnail: %w", bt.Format(), err)
+	}
+	return img, nil
+}
+
+// NewThumbnail renders img as a thumbnail of the given format and size. The
+// image is scaled to fit, preserving its aspect ratio, and centered over a
+// transparent background.
+func NewThumbnail(img image.Image, format BlockThumbnailFormat, width, height int) (*BlockThumbnail, error) {
+	if width <= 0 || width > math.MaxUint16 || height <= 0 || height > math.MaxUint16 {
+		return nil, fmt.Errorf("invalid thumbnail size %dx%d", width, height)
+	}
+	body, err := encodeImage(scaleToFit(img, width, height), format)
+	if err != nil {
+		return nil, err
+	}
+	bt := &BlockThumbnail{Body: body}
+	bt.header.Format = format
+	bt.header.Width = uint16(width)
+	bt.header.Height = uint16(height)
+	return bt, nil
+}
+
+// Convert re-encodes the thumbnail in another image format, for consumers
+// that cannot handle its format, such as QOI. The thumbnail itself is
+// returned when it is in that format already.
+func (bt *BlockThumbnail) Convert(format BlockThumbnailFormat) (*BlockThumbnail, error) {
+	if bt.Format() == format {
+		return bt, nil
+	}
+	img, err := bt.Image()
+	if err != nil {
+		return nil, err
+	}
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		b := img.Bounds()
+		nrgba = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	}
+	body, err := encodeImage(nrgba, format)
+	if err != nil {
+		return nil, err
+	}
+	converted := &BlockThumbnail{Body: body}
+	converted.header = bt.header
+	converted.header.Format = format
+	return converted, nil
+}
+
+// encodeImage encodes img in the given thumbnail format.
+func encodeImage(img *image.NRGBA, format BlockThumbnailFormat) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	switch format {
+	case BlockThumbnailFormatPNG:
+		if err := png.Encode(buf, img); err != nil {
+			return nil, fmt.Errorf("cannot encode PNG thumbnail: %w", err)
+		}
+	case BlockThumbnailFormatJPG:
+		if err := jpeg.Encode(buf, img, nil); err != nil {
+			return nil, fmt.Errorf("cannot encode JPG thumbnail: %w", err)
+		}
+	case BlockThumbnailFormatQOI:
+		return encodeQOI(img), nil
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedThumbnailFormat, format)
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleToFit scales img to fit within width by height, preserving its aspect
+// ratio, and centers it over a transparent background. Each pixel averages
+// the pixels of img it covers.
+func scaleToFit(img image.Image, width, height int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	sb := img.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+	cw, ch := width, max(sh*width/sw, 1)
+	if ch > height {
+		cw, ch = max(sw*height/sh, 1), height
+	}
+	ox, oy := (width-cw)/2, (height-ch)/2
+	for y := 0; y < ch; y++ {
+		sy0 := sb.Min.Y + y*sh/ch
+		sy1 := max(sb.Min.Y+(y+1)*sh/ch, sy0+1)
+		for x := 0; x < cw; x++ {
+			sx0 := sb.Min.X + x*sw/cw
+			sx1 := max(sb.Min.X+(x+1)*sw/cw, sx0+1)
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			c := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)}
+			dst.Set(ox+x, oy+y, c)
+		}
+	}
+	return dst
+}
+
+// InjectThumbnails copies the BGCode input r to w, as Rewrite does, with the
+// given thumbnails. Each replaces the thumbnail of the same format and size,
+// if any; the others are added after the thumbnails of the input.
+func InjectThumbnails(w io.Writer, r io.Reader, thumbnails ...*BlockThumbnail) error {
+	pending := slices.Clone(thumbnails)
+	err := Rewrite(w, r, func(b *Block) error {
+		switch b.Header.Type() {
+		case BlockHeaderTypeFileMetadata, BlockHeaderTypePrinterMetadata:
+			return nil
+		case BlockHeaderTypeThumbnail:
+			block, err := b.Decode()
+			if err != nil {
+				return err
+			}
+			bt := block.(*BlockThumbnail)
+			i := slices.IndexFunc(pending, func(t *BlockThumbnail) bool {
+				return t.header == bt.header
+			})
+			if i >= 0 {
+				b.Replace(pending[i])
+				pending = slices.Delete(pending, i, i+1)
+			}
+			return nil
+		}
+		for _, bt := range pending {
+			b.Insert(bt)
+		}
+		pending = nil
+		return nil
+	})
+	if err == nil && len(pending) > 0 {
+		err = errors.New("cannot inject thumbnails: no block follows the thumbnails")
+	}
+	return err
+}
+
+// ThumbnailBySize returns the first thumbnail of exactly width by height
+// pixels, or nil if there is none.
+func (f *File) ThumbnailBySize(width, height int) *BlockThumbnail {
+	for _, bt := range f.Thumbnails {
+		if bt.Width() == width && bt.Height() == height {
+			return bt
+		}
+	}
+	return nil
+}
+
+// BestThumbnail returns the thumbnail best suited to be displayed at width by
+// height pixels: the smallest thumbnail covering that size, so that it only
+// needs to be scaled down, or else the largest thumbnail. Among thumbnails of
+// the same size, the first one is returned. It returns nil when the file has
+// no thumbnails.
+func (f *File) BestThumbnail(width, height int) *BlockThumbnail {
+	var best *BlockThumbnail
+	covers := func(bt *BlockThumbnail) bool {
+		return bt.Width() >= width && bt.Height() >= height
+	}
+	area := func(bt *BlockThumbnail) int {
+		return bt.Width() * bt.Height()
+	}
+	for _, bt := range f.Thumbnails {
+		switch {
+		case best == nil:
+			best = bt
+		case covers(bt) && (!covers(best) || area(bt) < area(best)):
+			best = bt
+		case !covers(bt) && !covers(best) && area(bt) > area(best):
+			best = bt
+		}
+	}
+	return best
+}
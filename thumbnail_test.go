@@ -0,0 +1,214 @@
+package bgcodego
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBlockThumbnail_Image(t *testing.T) {
+	f := decodeFixture(t)
+	for _, thumbnail := range f.Thumbnails {
+		img, err := thumbnail.Image()
+		checkErr(t, err)
+		if got, want := img.Bounds(), image.Rect(0, 0, thumbnail.Width(), thumbnail.Height()); got != want {
+			t.Errorf("unexpected bounds: %v, want %v", got, want)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	checkErr(t, jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 4, 3)), nil))
+	jpg := &BlockThumbnail{Body: buf.Bytes()}
+	jpg.header.Format = BlockThumbnailFormatJPG
+	img, err := jpg.Image()
+	checkErr(t, err)
+	if got := img.Bounds(); got != image.Rect(0, 0, 4, 3) {
+		t.Errorf("unexpected JPG bounds: %v", got)
+	}
+
+	jpg.header.Format = BlockThumbnailFormatPNG
+	if _, err := jpg.Image(); err == nil {
+		t.Error("expected error for mislabeled thumbnail")
+	}
+	jpg.header.Format = 42
+	if _, err := jpg.Image(); !errors.Is(err, ErrUnsupportedThumbnailFormat) {
+		t.Errorf("expected ErrUnsupportedThumbnailFormat, got: %v", err)
+	}
+}
+
+func TestThumbnails(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	thumbnails, err := Thumbnails(bytes.NewReader(bgcode))
+	checkErr(t, err)
+	if diff := cmp.Diff(decodeFixture(t).Thumbnails, thumbnails, cmp.AllowUnexported(BlockThumbnail{})); diff != "" {
+		t.Errorf("Thumbnails() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewThumbnail(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(10, 10, 110, 60))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	for _, format := range []BlockThumbnailFormat{BlockThumbnailFormatPNG, BlockThumbnailFormatJPG, BlockThumbnailFormatQOI} {
+		bt, err := NewThumbnail(src, format, 16, 16)
+		checkErr(t, err)
+		if bt.Format() != format || bt.Width() != 16 || bt.Height() != 16 {
+			t.Errorf("unexpected thumbnail: %v", bt.Render())
+		}
+		img, err := bt.Image()
+		checkErr(t, err)
+		if got := img.Bounds(); got != image.Rect(0, 0, 16, 16) {
+			t.Errorf("unexpected %v bounds: %v", format, got)
+		}
+		if format == BlockThumbnailFormatJPG {
+			continue
+		}
+		// The 2:1 image is letterboxed.
+		if _, _, _, a := img.At(8, 0).RGBA(); a != 0 {
+			t.Errorf("%v: expected transparent padding", format)
+		}
+		if r, _, _, a := img.At(8, 8).RGBA(); r != 0xffff || a != 0xffff {
+			t.Errorf("%v: expected opaque white center", format)
+		}
+	}
+	if _, err := NewThumbnail(src, 42, 16, 16); !errors.Is(err, ErrUnsupportedThumbnailFormat) {
+		t.Errorf("expected ErrUnsupportedThumbnailFormat, got: %v", err)
+	}
+	if _, err := NewThumbnail(src, BlockThumbnailFormatPNG, 0, 16); err == nil {
+		t.Error("expected error for empty thumbnail")
+	}
+}
+
+func TestInjectThumbnails(t *testing.T) {
+	input, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	want := decodeFixture(t)
+	src := image.NewGray(image.Rect(0, 0, 4, 4))
+	small, err := NewThumbnail(src, BlockThumbnailFormatPNG, 16, 16)
+	checkErr(t, err)
+	qoi, err := NewThumbnail(src, BlockThumbnailFormatQOI, 32, 32)
+	checkErr(t, err)
+
+	var buf bytes.Buffer
+	checkErr(t, InjectThumbnails(&buf, bytes.NewReader(input), small, qoi))
+	checkErr(t, Verify(bytes.NewReader(buf.Bytes())))
+	got, err := Decode(bytes.NewReader(buf.Bytes()))
+	checkErr(t, err)
+	wantThumbnails := []*BlockThumbnail{small, want.Thumbnails[1], qoi}
+	if diff := cmp.Diff(wantThumbnails, got.Thumbnails, cmp.AllowUnexported(BlockThumbnail{})); diff != "" {
+		t.Errorf("InjectThumbnails() mismatch (-want +got):\n%s", diff)
+	}
+	if len(got.Warnings) > 0 {
+		t.Errorf("unexpected warnings: %v", got.Warnings)
+	}
+}
+
+func TestFile_BestThumbnail(t *testing.T) {
+	thumbnail := func(width, height int) *BlockThumbnail {
+		bt := &BlockThumbnail{}
+		bt.header.Width, bt.header.Height = uint16(width), uint16(height)
+		return bt
+	}
+	small, wide, large, wideQOI := thumbnail(16, 16), thumbnail(313, 173), thumbnail(440, 240), thumbnail(313, 173)
+	wideQOI.header.Format = BlockThumbnailFormatQOI
+	f := &File{Thumbnails: []*BlockThumbnail{large, small, wide, wideQOI}}
+	tests := []struct {
+		width, height int
+		want          *BlockThumbnail
+	}{
+		{16, 16, small},
+		{10, 10, small},
+		{100, 50, wide},
+		{313, 173, wide},
+		{300, 200, large},
+		{1000, 1000, large},
+		{17, 1, wide},
+	}
+	for _, tt := range tests {
+		if got := f.BestThumbnail(tt.width, tt.height); got != tt.want {
+			t.Errorf("BestThumbnail(%d, %d) = %dx%d, want %dx%d", tt.width, tt.height, got.Width(), got.Height(), tt.want.Width(), tt.want.Height())
+		}
+	}
+	if got := f.ThumbnailBySize(313, 173); got != wide {
+		t.Errorf("unexpected thumbnail by size: %v", got)
+	}
+	if got := f.ThumbnailBySize(100, 100); got != nil {
+		t.Errorf("unexpected thumbnail by size: %v", got)
+	}
+	if got := (&File{}).BestThumbnail(16, 16); got != nil {
+		t.Errorf("unexpected thumbnail of empty file: %v", got)
+	}
+}
+
+func TestBlockThumbnail_Convert(t *testing.T) {
+	f := decodeFixture(t)
+	src := f.Thumbnails[0]
+	want, err := src.Image()
+	checkErr(t, err)
+	if got, err := src.Convert(BlockThumbnailFormatPNG); err != nil || got != src {
+		t.Errorf("expected the thumbnail itself, got: %v, %v", got, err)
+	}
+	qoi, err := src.Convert(BlockThumbnailFormatQOI)
+	checkErr(t, err)
+	if qoi.Format() != BlockThumbnailFormatQOI || qoi.Width() != src.Width() || qoi.Height() != src.Height() {
+		t.Fatalf("unexpected thumbnail: %v", qoi.Render())
+	}
+	png, err := qoi.Convert(BlockThumbnailFormatPNG)
+	checkErr(t, err)
+	got, err := png.Image()
+	checkErr(t, err)
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if w, g := color.NRGBAModel.Convert(want.At(x, y)), color.NRGBAModel.Convert(got.At(x-b.Min.X, y-b.Min.Y)); w != g {
+				t.Fatalf("pixel %d,%d: got %v, want %v", x, y, g, w)
+			}
+		}
+	}
+	if _, err := src.Convert(42); !errors.Is(err, ErrUnsupportedThumbnailFormat) {
+		t.Errorf("expected ErrUnsupportedThumbnailFormat, got: %v", err)
+	}
+}
+
+func BenchmarkBlockThumbnail_Render(b *testing.B) {
+	f, err := DecodeFile("_testdata/mini_cube_b.bgcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	bt := f.Thumbnails[len(f.Thumbnails)-1]
+	b.SetBytes(int64(len(bt.Body)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bt.Render()
+	}
+}
+
+func BenchmarkBlockThumbnail_Image(b *testing.B) {
+	f, err := DecodeFile("_testdata/mini_cube_b.bgcode")
+	if err != nil {
+		b.Fatal(err)
+	}
+	png := f.Thumbnails[len(f.Thumbnails)-1]
+	qoi, err := png.Convert(BlockThumbnailFormatQOI)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bt := range []*BlockThumbnail{png, qoi} {
+		b.Run(bt.Format().String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bt.Image(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package bgcodego
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// printerMetadataKeys lists, in order, the keys libbgcode gathers into the
+// printer metadata block when converting ASCII G-code.
+var printerMetadataKeys = []string{
+	"printer_model",
+	"filament_type",
+	"nozzle_diameter",
+	"bed_temperature",
+	"brim_width",
+	"fill_density",
+	"layer_height",
+	"temperature",
+	"ironing",
+	"support_material",
+	"max_layer_z",
+	"extruder_colour",
+	"filament used [mm]",
+	"filament used [cm3]",
+	"filament used [g]",
+	"filament cost",
+	"estimated printing time (normal mode)",
+}
+
+// DecodeGCode reads ASCII G-code, as produced by PrusaSlicer or by
+// File.Render, into its structured representation. The producer, thumbnails,
+// print statistics and slicer configuration that PrusaSlicer embeds as
+// comments become the matching metadata and thumbnail blocks, and the
+// remaining lines become G-code. When the input has no printer metadata
+// section, it is derived from the print statistics and slicer configuration
+// the same way libbgcode does.
+func DecodeGCode(r io.Reader) (*File, error) {
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read G-code: %w", err)
+	}
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	f := &File{
+		Header: FileHeader{
+			MagicNumber:  magicNumber,
+			Version:      Version1,
+			ChecksumType: ChecksumTypeCRC32,
+		},
+	}
+
+	start := 0
+	if len(lines) > 0 {
+		if producer, ok := strings.CutPrefix(trimEOL(lines[0]), "; generated by "); ok {
+			producer, _, _ = strings.Cut(producer, " on ")
+			f.FileMetadata = &BlockFileMetadata{Values: KeyValues{{Key: "Producer", Value: producer}}}
+			start++
+		}
+	}
+	start = skipBlankLines(lines, start)
+	var printer KeyValues
+	for ; start < len(lines); start++ {
+		kv, ok := commentKeyValue(lines[start])
+		if !ok || !slices.Contains(printerMetadataKeys, kv.Key) {
+			break
+		}
+		printer = append(printer, kv)
+	}
+	for start < len(lines) {
+		line := trimEOL(lines[start])
+		if line == "" || line == ";" {
+			start++
+			continue
+		}
+		thumbnail, n, err := parseThumbnail(lines[start:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start+1, err)
+		}
+		if thumbnail == nil {
+			break
+		}
+		f.Thumbnails = append(f.Thumbnails, thumbnail)
+		start += n
+	}
+
+	end := len(lines)
+	for end > start && trimEOL(lines[end-1]) == "" {
+		end--
+	}
+	if end > start && trimEOL(lines[end-1]) == "; prusaslicer_config = end" {
+		begin := end - 1
+		for begin > start && trimEOL(lines[begin-1]) != "; prusaslicer_config = begin" {
+			begin--
+		}
+		if begin == start {
+			return nil, fmt.Errorf("line %d: slicer configuration has no beginning", end)
+		}
+		var slicer KeyValues
+		for _, line := range lines[begin : end-1] {
+			if kv, ok := commentKeyValue(line); ok {
+				slicer = append(slicer, kv)
+			}
+		}
+		f.SlicerMetadata = &BlockSlicerMetadata{Values: slicer}
+		end = begin - 1
+		for end > start && trimEOL(lines[end-1]) == "" {
+			end--
+		}
+	}
+	stats := end
+	for stats > start {
+		kv, ok := commentKeyValue(lines[stats-1])
+		if !ok || !isPrintStatisticsKey(kv.Key) {
+			break
+		}
+		stats--
+	}
+	if stats < end {
+		f.PrintMetadata = &BlockPrintMetadata{}
+		for _, line := range lines[stats:end] {
+			kv, _ := commentKeyValue(line)
+			f.PrintMetadata.Values = append(f.PrintMetadata.Values, kv)
+		}
+		end = stats
+		for end > start && trimEOL(lines[end-1]) == "" {
+			end--
+		}
+	}
+
+	f.addGCode(&BlockGCode{Body: strings.Join(lines[start:end], "")})
+	if printer == nil {
+		printer = f.derivePrinterMetadata()
+	}
+	if printer != nil {
+		f.PrinterMetadata = &BlockPrinterMetadata{Values: printer}
+	}
+	return f, nil
+}
+
+// Transcode converts ASCII G-code into BGCode. See DecodeGCode for how the
+// input is interpreted.
+func Transcode(w io.Writer, r io.Reader, opts ...EncodeOption) error {
+	f, err := DecodeGCode(r)
+	if err != nil {
+		return err
+	}
+	return Encode(w, f, opts...)
+}
+
+// RoundTrip converts ASCII G-code into BGCode and back, returning the
+// G-code decoded from the BGCode, so that downstream tools can assert in
+// their tests that the conversion is lossless. It is for G-code laid out as
+// PrusaSlicer or File.Render write it, with line terminators matching
+// WithLineEnding: anything else comes back in that layout, and
+// GCodeEncodingMeatpack drops comments by design.
+func RoundTrip(gcode []byte, opts ...EncodeOption) ([]byte, error) {
+	bgcode := &bytes.Buffer{}
+	if err := Transcode(bgcode, bytes.NewReader(gcode), opts...); err != nil {
+		return nil, fmt.Errorf("cannot encode: %w", err)
+	}
+	out, err := AppendGCode(nil, bgcode)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode: %w", err)
+	}
+	return out, nil
+}
+
+// derivePrinterMetadata gathers the printer metadata from the print
+// statistics and the slicer configuration.
+func (f *File) derivePrinterMetadata() KeyValues {
+	var sources []KeyValues
+	if f.PrintMetadata != nil {
+		sources = append(sources, f.PrintMetadata.Values)
+	}
+	if f.SlicerMetadata != nil {
+		sources = append(sources, f.SlicerMetadata.Values)
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	var ret KeyValues
+	for _, key := range printerMetadataKeys {
+		if key == "max_layer_z" && len(f.layers) > 0 {
+			var z float64
+			for _, l := range f.layers {
+				z = max(z, l.Z)
+			}
+			ret = append(ret, KeyValue{Key: key, Value: strconv.FormatFloat(z, 'f', -1, 64)})
+			continue
+		}
+		for _, kvs := range sources {
+			if v, ok := kvs.Lookup(key); ok {
+				ret = append(ret, KeyValue{Key: key, Value: v})
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// parseThumbnail parses a thumbnail embedded in G-code comments, returning
+// the number of lines it spans. It returns a nil thumbnail if lines do not
+// start with one.
+func parseThumbnail(lines []string) (*BlockThumbnail, int, error) {
+	formats := map[string]BlockThumbnailFormat{
+		"thumbnail":     BlockThumbnailFormatPNG,
+		"thumbnail_JPG": BlockThumbnailFormatJPG,
+		"thumbnail_QOI": BlockThumbnailFormatQOI,
+	}
+	tag, params, ok := strings.Cut(strings.TrimPrefix(trimEOL(lines[0]), "; "), " begin ")
+	format, known := formats[tag]
+	if !ok || !known {
+		return nil, 0, nil
+	}
+	var width, height, size int
+	if _, err := fmt.Sscanf(params, "%dx%d %d", &width, &height, &size); err != nil {
+		return nil, 0, fmt.Errorf("malformed thumbnail header: %w", err)
+	}
+	encoded := &strings.Builder{}
+	for i, line := range lines[1:] {
+		line = trimEOL(line)
+		if line == "; "+tag+" end" {
+			body, err := base64.StdEncoding.DecodeString(encoded.String())
+			if err != nil {
+				return nil, 0, fmt.Errorf("cannot decode thumbnail: %w", err)
+			}
+			bt := &BlockThumbnail{Body: body}
+			bt.header.Format = format
+			bt.header.Width = uint16(width)
+			bt.header.Height = uint16(height)
+			return bt, i + 2, nil
+		}
+		encoded.WriteString(strings.TrimPrefix(line, "; "))
+	}
+	return nil, 0, fmt.Errorf("unterminated %dx%d thumbnail", width, height)
+}
+
+// commentKeyValue parses comments of the form "; key = value".
+func commentKeyValue(line string) (KeyValue, bool) {
+	comment, ok := strings.CutPrefix(trimEOL(line), "; ")
+	if !ok {
+		return KeyValue{}, false
+	}
+	key, value, ok := strings.Cut(comment, " =")
+	if !ok || key == "" {
+		return KeyValue{}, false
+	}
+	return KeyValue{Key: key, Value: strings.TrimSpace(value)}, true
+}
+
+// isPrintStatisticsKey reports whether key is one of the print statistics
+// PrusaSlicer appends after the G-code.
+func isPrintStatisticsKey(key string) bool {
+	for _, prefix := range []string{"filament used", "filament cost", "total ", "estimated "} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func skipBlankLines(lines []string, i int) int {
+	for i < len(lines) && trimEOL(lines[i]) == "" {
+		i++
+	}
+	return i
+}
+
+func trimEOL(line string) string {
+	return strings.TrimRight(line, "\r\n")
+}
@@ -0,0 +1,138 @@
+package bgcodego
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTranscode(t *testing.T) {
+	gcode, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	want := decodeFixture(t)
+	tests := []struct {
+		name string
+		opts []EncodeOption
+	}{
+		{"default", nil},
+		{"deflate meatpack", []EncodeOption{WithCompression(BlockHeaderCompressionDeflate), WithGCodeEncoding(GCodeEncodingMeatpackWithComments)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			checkErr(t, Transcode(out, bytes.NewReader(gcode), tt.opts...))
+			got, err := Decode(out, WithStrict())
+			checkErr(t, err)
+			if diff := cmp.Diff(want.Canonical(), got.Canonical()); diff != "" {
+				t.Errorf("Transcode() mismatch (-want +got):\n%s", diff)
+			}
+			if got.Render() != string(gcode) {
+				t.Error("unexpected rendered output")
+			}
+		})
+	}
+}
+
+func TestDecodeGCode_prusaSlicer(t *testing.T) {
+	const gcode = `; generated by PrusaSlicer 2.6.0 on 2023-06-20 at 10:20:25 UTC
+
+;
+; thumbnail_JPG begin 2x1 8
+; /9j/4AAQ
+; thumbnail_JPG end
+;
+
+M73 P0 R1
+;LAYER_CHANGE
+;Z:0.2
+G1 Z.2
+;LAYER_CHANGE
+;Z:0.4
+G1 Z.4
+
+; filament used [g] = 3.01
+; filament cost = 0.08
+; estimated printing time (normal mode) = 1m 8s
+
+; prusaslicer_config = begin
+; filament_type = PETG
+; printer_model = MINI
+; template_custom_gcode =
+; prusaslicer_config = end
+`
+	f, err := DecodeGCode(strings.NewReader(gcode))
+	checkErr(t, err)
+	if got := f.Metadata().Producer(); got != "PrusaSlicer 2.6.0" {
+		t.Errorf("unexpected producer: %q", got)
+	}
+	if len(f.Thumbnails) != 1 || f.Thumbnails[0].Format() != BlockThumbnailFormatJPG || f.Thumbnails[0].Width() != 2 {
+		t.Errorf("unexpected thumbnails: %+v", f.Thumbnails)
+	}
+	if want := "M73 P0 R1\n;LAYER_CHANGE\n;Z:0.2\nG1 Z.2\n;LAYER_CHANGE\n;Z:0.4\nG1 Z.4\n"; f.GCode[0].Body != want {
+		t.Errorf("unexpected G-code: %q", f.GCode[0].Body)
+	}
+	wantPrinter := KeyValues{
+		{Key: "printer_model", Value: "MINI"},
+		{Key: "filament_type", Value: "PETG"},
+		{Key: "max_layer_z", Value: "0.4"},
+		{Key: "filament used [g]", Value: "3.01"},
+		{Key: "filament cost", Value: "0.08"},
+		{Key: "estimated printing time (normal mode)", Value: "1m 8s"},
+	}
+	if diff := cmp.Diff(wantPrinter, f.PrinterMetadata.Values); diff != "" {
+		t.Errorf("printer metadata mismatch (-want +got):\n%s", diff)
+	}
+	if got := f.SlicerMetadata.Values.All("template_custom_gcode"); len(got) != 1 || got[0] != "" {
+		t.Errorf("unexpected empty slicer setting: %q", got)
+	}
+	if len(f.PrintMetadata.Values) != 3 {
+		t.Errorf("unexpected print metadata: %v", f.PrintMetadata.Values)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	fixture, err := os.ReadFile("_testdata/mini_cube_b.gcode")
+	checkErr(t, err)
+	inputs := []struct {
+		name  string
+		gcode string
+		opts  []EncodeOption
+	}{
+		{"prusaslicer", string(fixture), nil},
+		{"bare", "\nG28\nG1 X1 Y2 ; move\nM117 h\u00e9llo w\u00f6rld\n", nil},
+		{"unterminated", "\nG28\nG1 X1", nil},
+		{"crlf", "\nG28\r\nG1 X1 ; move\r\n", []EncodeOption{WithLineEnding(LineEndingCRLF)}},
+	}
+	compressions := []BlockHeaderCompression{
+		BlockHeaderCompressionNone,
+		BlockHeaderCompressionDeflate,
+		BlockHeaderCompressionHeatshrink114,
+		BlockHeaderCompressionHeatshrink124,
+	}
+	encodings := []GCodeEncoding{GCodeEncodingNone, GCodeEncodingMeatpackWithComments}
+	for _, in := range inputs {
+		for _, c := range compressions {
+			for _, e := range encodings {
+				t.Run(fmt.Sprintf("%s/%v/%v", in.name, c, e), func(t *testing.T) {
+					opts := append([]EncodeOption{WithCompression(c), WithGCodeEncoding(e)}, in.opts...)
+					got, err := RoundTrip([]byte(in.gcode), opts...)
+					checkErr(t, err)
+					if diff := cmp.Diff(in.gcode, string(got)); diff != "" {
+						t.Errorf("RoundTrip() mismatch (-want +got):\n%s", diff)
+					}
+				})
+			}
+		}
+	}
+	t.Run("meatpack drops comments", func(t *testing.T) {
+		got, err := RoundTrip([]byte("\nG28 ; home\n; comment\nG1 X1\n"), WithGCodeEncoding(GCodeEncodingMeatpack))
+		checkErr(t, err)
+		if want := "\nG28\nG1 X1\n"; string(got) != want {
+			t.Errorf("RoundTrip() = %q, want %q", got, want)
+		}
+	})
+}
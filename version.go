@@ -0,0 +1,121 @@
+package bgcodego
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+)
+
+// layout describes how a version of the specification lays out file and
+// block headers. Headers are parsed through the layout of the version
+// declared by the file header, so that future versions can be supported
+// alongside Version1 without changes to the exported API.
+type layout struct {
+	// parseFileHeader reads the fields that follow the magic number and
+	// the version.
+	parseFileHeader  func(fh *FileHeader, r io.Reader) error
+	writeFileHeader  func(w io.Writer, fh *FileHeader) error
+	parseBlockHeader func(bh *BlockHeader, r io.Reader) error
+	writeBlockHeader func(w io.Writer, bh *BlockHeader) error
+	// parametersSize reports the size of the parameters of a block type,
+	// and whether the layout defines it.
+	parametersSize func(bht BlockHeaderType) (int, bool)
+}
+
+var layouts = map[FileHeaderVersion]*layout{
+	Version1: &layoutV1,
+}
+
+// SupportedVersions lists, in ascending order, the versions of the
+// specification this package decodes.
+func SupportedVersions() []FileHeaderVersion {
+	versions := make([]FileHeaderVersion, 0, len(layouts))
+	for v := range layouts {
+		versions = append(versions, v)
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+// layout returns the layout of the version declared by the file header.
+func (fh *FileHeader) layout() *layout {
+	if l, ok := layouts[fh.Version]; ok {
+		return l
+	}
+	return &layoutV1
+}
+
+// layout returns the layout the block header is parsed with, which is
+// Version1 for headers that do not belong to a file.
+func (bh *BlockHeader) layout() *layout {
+	if bh.fileLayout != nil {
+		return bh.fileLayout
+	}
+	return &layoutV1
+}
+
+// layoutV1 implements https://github.com/prusa3d/libbgcode/blob/main/doc/specifications.md
+var layoutV1 = layout{
+	parseFileHeader: func(fh *FileHeader, r io.Reader) error {
+		var buf [2]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return err
+		}
+		fh.ChecksumType = ChecksumType(binary.LittleEndian.Uint16(buf[:]))
+		return nil
+	},
+	writeFileHeader: func(w io.Writer, fh *FileHeader) error {
+		return binary.Write(w, binary.LittleEndian, fh)
+	},
+	// Block headers are decoded by hand from the scratch buffer of the
+	// header, as binary.Read allocates and reflects on every call, which
+	// adds up for files with thousands of blocks.
+	parseBlockHeader: func(bh *BlockHeader, r io.Reader) error {
+		buf := bh.scratch[:]
+		if _, err := io.ReadFull(r, buf[:8]); err != nil {
+			return err
+		}
+		bh.basic.Type = BlockHeaderType(binary.LittleEndian.Uint16(buf[0:]))
+		bh.basic.Compression = BlockHeaderCompression(binary.LittleEndian.Uint16(buf[2:]))
+		bh.basic.UncompressedSize = binary.LittleEndian.Uint32(buf[4:])
+		if !bh.basic.Compression.IsValid() {
+			return &UnsupportedCompressionError{Compression: bh.basic.Compression}
+		}
+		if bh.basic.Compression != BlockHeaderCompressionNone {
+			if _, err := io.ReadFull(r, buf[8:12]); err != nil {
+				return noEOF(err)
+			}
+			bh.extended.CompressedSize = binary.LittleEndian.Uint32(buf[8:])
+		}
+		return nil
+	},
+	writeBlockHeader: func(w io.Writer, bh *BlockHeader) error {
+		if err := binary.Write(w, binary.LittleEndian, bh.basic); err != nil {
+			return err
+		}
+		if bh.basic.Compression == BlockHeaderCompressionNone {
+			return nil
+		}
+		return binary.Write(w, binary.LittleEndian, bh.extended)
+	},
+	// Every block carries 2 bytes of parameters, its encoding, but for
+	// thumbnails, which add their size. Blocks of types unknown to the
+	// specification are taken to carry 2 bytes as well, so that they can be
+	// skipped.
+	parametersSize: func(bht BlockHeaderType) (int, bool) {
+		if bht == BlockHeaderTypeThumbnail {
+			return 6, true
+		}
+		return 2, true
+	},
+}
+
+// noEOF reports io.EOF as io.ErrUnexpectedEOF, for reads of fields that are
+// not the first of a structure.
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
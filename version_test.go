@@ -0,0 +1,90 @@
+package bgcodego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSupportedVersions(t *testing.T) {
+	if diff := cmp.Diff([]FileHeaderVersion{Version1}, SupportedVersions()); diff != "" {
+		t.Errorf("SupportedVersions() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFileHeader_Parse_truncated(t *testing.T) {
+	bgcode, err := os.ReadFile("_testdata/mini_cube_b.bgcode")
+	checkErr(t, err)
+	for _, n := range []int{4, 8, 9} {
+		var fh FileHeader
+		if err := fh.Parse(bytes.NewReader(bgcode[:n])); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Parse() of %d bytes = %v, want io.ErrUnexpectedEOF", n, err)
+		}
+	}
+}
+
+func TestFileHeader_layout(t *testing.T) {
+	for _, v := range []FileHeaderVersion{Version1, 2} {
+		if got := (&FileHeader{Version: v}).layout(); got != &layoutV1 {
+			t.Errorf("layout() of version %d = %p, want layoutV1", v, got)
+		}
+	}
+}
+
+// testLayout is a made-up version whose block headers always carry the
+// compressed size, and whose parameters are undefined but for G-code blocks.
+func testLayout() *layout {
+	l := layoutV1
+	l.parseBlockHeader = func(bh *BlockHeader, r io.Reader) error {
+		if err := binary.Read(r, binary.LittleEndian, &bh.basic); err != nil {
+			return err
+		}
+		return noEOF(binary.Read(r, binary.LittleEndian, &bh.extended))
+	}
+	l.parametersSize = func(bht BlockHeaderType) (int, bool) {
+		return 2, bht == BlockHeaderTypeGCode
+	}
+	return &l
+}
+
+func TestBlockHeader_layout(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []any{BlockHeaderTypeGCode, BlockHeaderCompressionNone, uint32(10), uint32(10)} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	bh := &BlockHeader{fileLayout: testLayout()}
+	checkErr(t, bh.Parse(bytes.NewReader(buf.Bytes())))
+	if bh.Length() != 10 || bh.ParametersSize() != 2 {
+		t.Errorf("Parse() = %+v", bh.Fields())
+	}
+
+	buf.Reset()
+	for _, v := range []any{BlockHeaderType(99), BlockHeaderCompressionNone, uint32(10), uint32(10)} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	bh = &BlockHeader{fileLayout: testLayout()}
+	var ue *UnsupportedBlockTypeError
+	err := bh.Parse(bytes.NewReader(buf.Bytes()))
+	if !errors.As(err, &ue) || ue.Type != 99 || !errors.Is(err, ErrUnknownBlockType) || !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected *UnsupportedBlockTypeError, got: %v", err)
+	}
+}
+
+func TestParametersSize_unknownType(t *testing.T) {
+	// Version 1 blocks of unknown type carry 2 bytes of parameters.
+	var bh BlockHeader
+	bh.basic.Type = 99
+	if got := bh.ParametersSize(); got != 2 {
+		t.Errorf("ParametersSize() = %d, want 2", got)
+	}
+	future, err := os.ReadFile("_testdata/future_block.bgcode")
+	checkErr(t, err)
+	if _, err := Decode(bytes.NewReader(future), WithSkipUnknownBlocks()); err != nil {
+		t.Errorf("blocks of unknown type should be skipped, got: %v", err)
+	}
+}